@@ -5,17 +5,33 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 /**
 该代码主要包含了两个函数：
 
-Authenticate 函数用于处理认证请求。首先从请求中解析出邮箱和密码，然后根据邮箱从数据库中获取用户信息。接下来，验证密码是否匹配。如果认证成功，记录认证日志，并返回成功认证的响应。如果认证失败，返回相应的错误信息。
-logRequest 函数用于发送日志请求给日志服务。首先构建日志数据结构，然后将数据转换为 JSON 格式。接着，发送 POST 请求给日志服务，并将日志数据作为请求体发送。如果发送过程中出现错误，则返回错误信息。
+Authenticate 函数用于处理认证请求。首先从请求中解析出邮箱和密码，然后根据邮箱从数据库中获取用户信息。接下来，验证密码是否匹配，未启用（包括还没有验证邮箱）的用户不能登录。如果认证成功，记录认证日志，签发访问令牌和刷新令牌（见 tokens.go），并返回包含用户信息和令牌的响应。
+如果认证失败，记录登录失败的日志和原因，但无论邮箱不存在、密码错误还是用户未启用，都返回相同的 401 和错误信息；邮箱不存在时同样比较一次密码哈希，接口不能通过响应内容或响应时间探测哪些邮箱已经注册。
+认证日志的 attributes.outcome 为 success 或 failure，日志服务据此统计登录成功率。
+logRequest 函数用于发送日志请求给日志服务。首先构建日志数据结构（包括日志级别和结构化字段），然后将数据转换为 JSON 格式。接着，使用带超时的 logClient 发送 POST 请求给日志服务，并将日志数据作为请求体发送。如果发送过程中出现错误或者日志服务没有返回 202，则返回错误信息。
+日志服务不可用时调用方只打印错误，不影响登录、注册和重置密码的响应。
 总结：该代码是一个认证服务，用于处理认证请求。其中，Authenticate 函数处理认证请求，验证用户的邮箱和密码，并记录认证日志。logRequest 函数负责发送日志请求给日志服务。
 */
 
+// 认证失败时返回的错误，不区分失败的原因
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// 邮箱不存在时用于比较密码的哈希，使响应时间与密码错误时相同
+const dummyPasswordHash = "$2a$12$uHr2hdVRKpEL66ysEk3zAutd5IShF7tQuLT7rv0HjaRL8M93B6sva"
+
+// 发送日志使用的 HTTP 客户端
+var logClient = &http.Client{Timeout: 5 * time.Second}
+
 // 处理认证请求
 func (app *Config) Authenticate(w http.ResponseWriter, r *http.Request) {
 	// 定义请求的数据结构
@@ -33,21 +49,41 @@ func (app *Config) Authenticate(w http.ResponseWriter, r *http.Request) {
 	// 根据邮箱从数据库中获取用户
 	user, err := app.Models.User.GetByEmail(requestPayload.Email)
 	if err != nil {
-		app.errorJson(w, errors.New("invalid credentials"), http.StatusBadRequest) // 返回无效凭证的错误
+		_ = bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(requestPayload.Password))
+		app.logFailure(requestPayload.Email, "unknown email")
+		app.errorJson(w, errInvalidCredentials, http.StatusUnauthorized) // 返回无效凭证的错误
 		return
 	}
 
 	// 验证密码是否匹配
 	valid, err := user.PasswordMatches(requestPayload.Password)
 	if err != nil || !valid {
-		app.errorJson(w, errors.New("invalid credentials!"), http.StatusUnauthorized) // 返回无效凭证的错误
+		app.logFailure(requestPayload.Email, "wrong password")
+		app.errorJson(w, errInvalidCredentials, http.StatusUnauthorized) // 返回无效凭证的错误
 		return
 	}
 
-	// 记录认证日志
-	err = app.logRequest("authentication", fmt.Sprintf("%s logged in", user.Email))
+	// 未启用的用户不能登录，返回相同的错误，避免响应泄露密码是否正确
+	if user.Active != 1 {
+		app.logFailure(requestPayload.Email, "inactive account")
+		app.errorJson(w, errInvalidCredentials, http.StatusUnauthorized)
+		return
+	}
+
+	// 记录认证日志，日志服务不可用时不影响登录
+	err = app.logRequest("authentication", fmt.Sprintf("%s logged in", user.Email), "INFO", map[string]any{
+		"outcome": "success",
+		"email":   user.Email,
+	})
+	if err != nil {
+		log.Println("Error logging authentication:", err)
+	}
+
+	// 签发访问令牌和刷新令牌
+	tokens, err := app.issueTokens(user)
 	if err != nil {
-		app.errorJson(w, err) // 返回日志记录错误
+		log.Println("Error issuing tokens:", err)
+		app.errorJson(w, errors.New("error issuing tokens"), http.StatusInternalServerError)
 		return
 	}
 
@@ -55,23 +91,41 @@ func (app *Config) Authenticate(w http.ResponseWriter, r *http.Request) {
 	payload := jsonResponse{
 		Error:   false,
 		Message: fmt.Sprintf("Logged in user %s", user.Email),
-		Data:    user,
+		Data:    tokens,
 	}
 
 	app.writeJson(w, http.StatusAccepted, payload) // 返回成功认证的响应
 
 }
 
+// 记录登录失败的日志，日志服务不可用时只打印错误，不影响认证的响应
+func (app *Config) logFailure(email, reason string) {
+	err := app.logRequest("authentication", fmt.Sprintf("%s failed to log in: %s", email, reason), "WARNING", map[string]any{
+		"outcome": "failure",
+		"email":   email,
+		"reason":  reason,
+	})
+	if err != nil {
+		log.Println("Error logging failed authentication:", err)
+	}
+}
+
 // 记录日志请求
-func (app *Config) logRequest(name, data string) error {
+func (app *Config) logRequest(name, data, severity string, attributes map[string]any) error {
 	// 定义日志数据结构
 	var entry struct {
-		Name string `json:"name"` // 日志名称
-		Data string `json:"data"` // 日志数据
+		Name       string         `json:"name"`                 // 日志名称
+		Data       string         `json:"data"`                 // 日志数据
+		Severity   string         `json:"severity,omitempty"`   // 日志级别
+		Service    string         `json:"service,omitempty"`    // 产生日志的服务
+		Attributes map[string]any `json:"attributes,omitempty"` // 结构化字段，outcome 用于统计登录成功率
 	}
 
 	entry.Name = name
 	entry.Data = data
+	entry.Severity = severity
+	entry.Service = "authentication-service"
+	entry.Attributes = attributes
 
 	jsonData, _ := json.MarshalIndent(entry, "", "\t")
 
@@ -83,11 +137,16 @@ func (app *Config) logRequest(name, data string) error {
 		return err
 	}
 
-	client := http.Client{}
-	_, err = client.Do(request)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := logClient.Do(request)
 	if err != nil {
 		return err
 	}
+	defer response.Body.Close()
 
+	if response.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("logger service returned status %d", response.StatusCode)
+	}
 	return nil
 }
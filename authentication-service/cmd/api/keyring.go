@@ -0,0 +1,167 @@
+package main
+
+import (
+	"authentication/data"
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+)
+
+/**
+该代码定义了签名密钥环 Keyring，负责密钥的轮换和公钥的发布。
+密钥保存在 Postgres 的 signing_keys 表中，所有副本共享同一组密钥：最新的密钥用于签名，其余未过期的密钥只用于验证。
+最新的密钥使用超过 rotateEvery 后生成新的密钥；每个密钥的有效期是 rotateEvery 加上访问令牌的有效期，
+因此密钥停止签名后，用它签发的访问令牌在过期之前仍然可以验证。
+Run 定期从数据库重新加载密钥（获取其他副本生成的密钥）并在需要时轮换；遇到未知的 kid 时也会重新加载，但每 10 秒最多一次。
+JWKS 返回所有未过期密钥的公钥（RFC 7517 格式），其他服务据此验证访问令牌。
+*/
+
+const keyReloadInterval = time.Minute // 定期重新加载密钥的间隔
+
+// Keyring 是访问令牌的签名密钥环
+type Keyring struct {
+	Models      data.Models
+	Algorithm   string        // 新密钥使用的算法
+	RotateEvery time.Duration // 每个密钥用于签名的时间
+	TokenTTL    time.Duration // 访问令牌的有效期
+
+	mu       sync.RWMutex
+	keys     []*data.SigningKey // 最新的密钥在前
+	loadedAt time.Time
+}
+
+// Load 从数据库加载密钥，没有可用于签名的密钥时生成一个新的密钥
+func (k *Keyring) Load() error {
+	keys, err := k.Models.SigningKey.GetActive()
+	if err != nil {
+		return err
+	}
+
+	if len(keys) == 0 || time.Since(keys[0].CreatedAt) >= k.RotateEvery {
+		key, err := data.GenerateSigningKey(k.Algorithm, time.Now().Add(k.RotateEvery+k.TokenTTL))
+		if err != nil {
+			return err
+		}
+		if err := k.Models.SigningKey.Insert(key); err != nil {
+			return err
+		}
+		log.Printf("Generated %s signing key %s", key.Algorithm, key.KID)
+		keys = append([]*data.SigningKey{key}, keys...)
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.loadedAt = time.Now()
+	k.mu.Unlock()
+	return nil
+}
+
+// Run 定期重新加载并轮换密钥，删除过期的密钥，直到 ctx 结束
+func (k *Keyring) Run(ctx context.Context) {
+	ticker := time.NewTicker(keyReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := k.Load(); err != nil {
+				log.Println("Error reloading signing keys:", err)
+			}
+			if err := k.Models.SigningKey.DeleteExpired(); err != nil {
+				log.Println("Error deleting expired signing keys:", err)
+			}
+		}
+	}
+}
+
+// Current 返回用于签名的密钥
+func (k *Keyring) Current() (*data.SigningKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if len(k.keys) == 0 || time.Now().After(k.keys[0].ExpiresAt) {
+		return nil, errors.New("no signing key available")
+	}
+	return k.keys[0], nil
+}
+
+// Lookup 返回 kid 对应的未过期密钥，找不到时返回 nil
+func (k *Keyring) Lookup(kid string) *data.SigningKey {
+	if key := k.find(kid); key != nil {
+		return key
+	}
+
+	// 可能是其他副本刚生成的密钥
+	k.mu.RLock()
+	stale := time.Since(k.loadedAt) > 10*time.Second
+	k.mu.RUnlock()
+	if stale {
+		if err := k.Load(); err != nil {
+			log.Println("Error reloading signing keys:", err)
+			return nil
+		}
+		return k.find(kid)
+	}
+	return nil
+}
+
+func (k *Keyring) find(kid string) *data.SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, key := range k.keys {
+		if key.KID == kid && time.Now().Before(key.ExpiresAt) {
+			return key
+		}
+	}
+	return nil
+}
+
+// JWK 是一个 JSON Web Key
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"` // OKP
+	X         string `json:"x,omitempty"`   // OKP
+	N         string `json:"n,omitempty"`   // RSA
+	E         string `json:"e,omitempty"`   // RSA
+}
+
+// JWKS 返回所有未过期密钥的公钥
+func (k *Keyring) JWKS() []JWK {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	jwks := make([]JWK, 0, len(k.keys))
+	for _, key := range k.keys {
+		if time.Now().After(key.ExpiresAt) {
+			continue
+		}
+
+		jwk := JWK{KeyID: key.KID, Use: "sig", Algorithm: key.Algorithm}
+		switch pub := key.Public().(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		default:
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+	return jwks
+}
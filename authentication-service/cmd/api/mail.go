@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+/**
+该代码用于通过邮件服务发送邮件。
+sendMail 调用邮件服务的 POST /send 接口，template 是邮件服务中的模板名称，data 是模板中使用的字段；
+邮件服务的地址通过 MAILER_URL 环境变量配置，默认为 http://mailer-service。
+tokenLink 生成邮件中包含一次性令牌的链接。
+验证和重置密码的邮件通过 background 在后台发送，响应不必等待邮件服务，关闭服务时等待所有后台任务完成（见 main）；
+tokenMailAllowed 限制为同一个用户发送同一用途邮件的频率，避免接口被用来向用户发送大量邮件。
+*/
+
+// 为同一个用户发送两封同一用途邮件的最短间隔
+const tokenMailInterval = time.Minute
+
+// 发送邮件使用的 HTTP 客户端，邮件服务需要等待 SMTP 服务器响应，超时时间较长
+var mailClient = &http.Client{Timeout: 20 * time.Second}
+
+// 通过邮件服务发送一封使用 template 模板的邮件
+func (app *Config) sendMail(to, subject, template string, data map[string]any) error {
+	var msg struct {
+		To       string         `json:"to"`
+		Subject  string         `json:"subject"`
+		Template string         `json:"template"`
+		Data     map[string]any `json:"data"`
+	}
+	msg.To = to
+	msg.Subject = subject
+	msg.Template = template
+	msg.Data = data
+
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest("POST", app.MailerURL+"/send", bytes.NewReader(jsonData))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := mailClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("mail service returned status %d", response.StatusCode)
+	}
+	return nil
+}
+
+// 在 base 后面附加 token 查询参数，生成邮件中的链接
+func tokenLink(base, token string) (string, error) {
+	link, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	q := link.Query()
+	q.Set("token", token)
+	link.RawQuery = q.Encode()
+	return link.String(), nil
+}
+
+// 在后台执行 fn，关闭服务时等待它完成
+func (app *Config) background(fn func()) {
+	app.tasks.Add(1)
+	go func() {
+		defer app.tasks.Done()
+		fn()
+	}()
+}
+
+// 距离上次为用户签发用途为 purpose 的令牌不足 tokenMailInterval 时返回 false
+func (app *Config) tokenMailAllowed(userID int, purpose string) bool {
+	last, err := app.Models.UserToken.LastIssuedAt(userID, purpose)
+	if err != nil {
+		log.Println("Error checking when the last email was sent:", err)
+		return false
+	}
+	return time.Since(last) >= tokenMailInterval
+}
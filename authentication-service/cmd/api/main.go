@@ -2,11 +2,16 @@ package main
 
 import (
 	"authentication/data"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	_ "github.com/jackc/pgconn"
@@ -20,6 +25,16 @@ import (
 连接到 PostgreSQL 数据库。
 启动 HTTP 服务器并监听指定的端口。
 处理数据库连接的重试逻辑。
+创建认证服务需要的表，加载访问令牌的签名密钥并在后台定期轮换（见 keyring.go）。
+令牌通过环境变量配置：JWT_ALGORITHM（EdDSA 或 RS256，默认 EdDSA）、JWT_KEY_ROTATION（默认 24h）、JWT_ISSUER、JWT_AUDIENCE、
+ACCESS_TOKEN_TTL（默认 15m）和 REFRESH_TOKEN_TTL（默认 168h）。
+自助注册（见 register.go）通过邮件服务发送验证邮件：MAILER_URL 是邮件服务的地址（默认 http://mailer-service），
+VERIFY_URL 是邮件中验证链接的地址（默认 http://localhost:8080/verify），VERIFY_TOKEN_TTL 是验证链接的有效期（默认 24h）。
+忘记密码（见 password.go）同样通过邮件发送重置链接：RESET_URL 是重置密码页面的地址（默认 http://localhost/reset-password，即前端的重置密码页面），
+RESET_TOKEN_TTL 是重置链接的有效期（默认 1h）。
+设置了 ADMIN_EMAIL 并且还没有任何管理员时，启动时把该邮箱对应的已启用、已验证邮箱的用户设为管理员，只用于创建第一个管理员；
+之后的管理员通过用户管理接口设置，ADMIN_EMAIL 不再生效，部署文件中默认不设置它。
+收到 SIGTERM 或 SIGINT 信号（启动时就开始监听）或者 HTTP 服务器出错后优雅关闭：等待进行中的请求和后台发送的邮件完成（最长 SHUTDOWN_TIMEOUT），然后关闭数据库连接。
 总结：该程序启动一个身份验证服务，它通过连接到 PostgreSQL 数据库来提供身份验证功能。在连接数据库时，使用了重试逻辑，如果数据库尚未就绪，则会进行重试。一旦连接成功，程序将启动 HTTP 服务器，并使用指定的端口提供身份验证服务。
 */
 
@@ -28,23 +43,72 @@ const webPort = "80"
 var counts int64
 
 type Config struct {
-	DB     *sql.DB
-	Models data.Models
+	DB            *sql.DB
+	Models        data.Models
+	Keyring       *Keyring
+	Tokens        TokenConfig
+	Registration  RegistrationConfig
+	PasswordReset PasswordResetConfig
+	MailerURL     string
+
+	tasks sync.WaitGroup // 后台任务，例如发送验证邮件
 }
 
 func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run 启动认证服务，收到退出信号或者 HTTP 服务器出错时优雅关闭，返回导致退出的错误
+func run() error {
+	// 最先注册退出信号，连接数据库的过程中也可以退出
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	log.Println("Starting authentication service")
 
 	// 连接到数据库
-	conn := connectToDB()
+	conn := connectToDB(ctx)
 	if conn == nil {
-		log.Panic("无法连接到 Postgres 数据库！")
+		return errors.New("无法连接到 Postgres 数据库！")
 	}
 
 	// 设置配置
 	app := Config{
 		DB:     conn,
 		Models: data.New(conn),
+		Tokens: TokenConfig{
+			Issuer:     envString("JWT_ISSUER", "authentication-service"),
+			Audience:   envString("JWT_AUDIENCE", "go-micro"),
+			AccessTTL:  envDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+			RefreshTTL: envDuration("REFRESH_TOKEN_TTL", 7*24*time.Hour),
+		},
+		Registration: RegistrationConfig{
+			VerifyURL: envString("VERIFY_URL", "http://localhost:8080/verify"),
+			VerifyTTL: envDuration("VERIFY_TOKEN_TTL", 24*time.Hour),
+		},
+		PasswordReset: PasswordResetConfig{
+			ResetURL: envString("RESET_URL", "http://localhost/reset-password"),
+			ResetTTL: envDuration("RESET_TOKEN_TTL", time.Hour),
+		},
+		MailerURL: envString("MAILER_URL", "http://mailer-service"),
+	}
+
+	if err := data.Migrate(); err != nil {
+		return err
+	}
+	app.bootstrapAdmin(os.Getenv("ADMIN_EMAIL"))
+
+	// 加载签名密钥
+	app.Keyring = &Keyring{
+		Models:      app.Models,
+		Algorithm:   envString("JWT_ALGORITHM", data.AlgorithmEdDSA),
+		RotateEvery: envDuration("JWT_KEY_ROTATION", 24*time.Hour),
+		TokenTTL:    app.Tokens.AccessTTL,
+	}
+	if err := app.Keyring.Load(); err != nil {
+		return err
 	}
 
 	srv := &http.Server{
@@ -52,10 +116,139 @@ func main() {
 		Handler: app.routes(),
 	}
 
-	err := srv.ListenAndServe()
+	// 在后台启动 HTTP 服务器，服务器出错时通过 serverErr 通知
+	serverErr := make(chan error, 1)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- fmt.Errorf("HTTP 服务器出错: %w", err)
+		}
+	}()
+
+	// 在后台轮换密钥，清理过期的令牌
+	go app.Keyring.Run(ctx)
+	go app.purgeExpiredTokens(ctx)
+
+	// 等待退出信号或者服务器出错
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-serverErr:
+		// 停止后台的密钥轮换和令牌清理
+		stop()
+	}
+
+	log.Println("正在关闭认证服务...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+	defer cancel()
+
+	// 等待进行中的请求完成，然后关闭数据库连接
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Println("关闭 HTTP 服务器出错:", err)
+	}
+	if err := app.waitBackground(shutdownCtx); err != nil {
+		log.Println("等待后台任务完成出错:", err)
+	}
+	if err := conn.Close(); err != nil {
+		log.Println("关闭数据库连接出错:", err)
+	}
+	return err
+}
+
+// 还没有管理员时把 email 对应的用户设为管理员，用户不存在、未启用或者没有验证邮箱时只打印日志
+func (app *Config) bootstrapAdmin(email string) {
+	if email == "" {
+		return
+	}
+
+	admins, err := app.Models.User.CountByRole(data.RoleAdmin)
 	if err != nil {
-		log.Panic(err)
+		log.Printf("Cannot make %s an administrator: %v", email, err)
+		return
 	}
+	if admins > 0 {
+		log.Println("ADMIN_EMAIL ignored, an administrator already exists")
+		return
+	}
+
+	user, err := app.Models.User.GetByEmail(email)
+	if err != nil {
+		log.Printf("Cannot make %s an administrator: %v", email, err)
+		return
+	}
+	if user.Active != 1 || user.VerificationPending {
+		log.Printf("Cannot make %s an administrator: the user is not active", email)
+		return
+	}
+
+	user.Role = data.RoleAdmin
+	if err := user.Update(); err != nil {
+		log.Printf("Cannot make %s an administrator: %v", email, err)
+		return
+	}
+	log.Printf("Made %s an administrator", email)
+}
+
+// 等待所有后台任务完成，或者 ctx 被取消
+func (app *Config) waitBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		app.tasks.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 每小时删除一次过期的刷新令牌、一次性令牌，以及验证链接过期后仍然没有验证邮箱的用户
+func (app *Config) purgeExpiredTokens(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := app.Models.RefreshToken.DeleteExpired(); err != nil {
+				log.Println("Error deleting expired refresh tokens:", err)
+			}
+			if err := app.Models.UserToken.DeleteExpired(); err != nil {
+				log.Println("Error deleting expired user tokens:", err)
+			}
+			if _, err := app.Models.User.DeleteUnverified(time.Now().Add(-app.Registration.VerifyTTL)); err != nil {
+				log.Println("Error deleting unverified users:", err)
+			}
+		}
+	}
+}
+
+// 返回环境变量的值，未设置时返回 def
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// 返回环境变量表示的时间间隔，未设置或无效时返回 def
+func envDuration(key string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
+
+// 返回优雅关闭时等待进行中请求完成的最长时间，可通过 SHUTDOWN_TIMEOUT 环境变量配置
+func shutdownTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return 20 * time.Second
 }
 
 // 打开数据库连接
@@ -73,8 +266,8 @@ func openDB(dsn string) (*sql.DB, error) {
 	return db, nil
 }
 
-// 连接到数据库
-func connectToDB() *sql.DB {
+// 连接到数据库，ctx 被取消时停止重试并返回 nil
+func connectToDB(ctx context.Context) *sql.DB {
 	dsn := os.Getenv("DSN")
 
 	for {
@@ -93,7 +286,10 @@ func connectToDB() *sql.DB {
 		}
 
 		log.Println("等待两秒钟...")
-		time.Sleep(2 * time.Second)
-		continue
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(2 * time.Second):
+		}
 	}
 }
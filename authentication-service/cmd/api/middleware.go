@@ -0,0 +1,79 @@
+package main
+
+import (
+	"authentication/data"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+/**
+该代码定义了认证服务自己的授权中间件。
+requireRole 验证 Authorization: Bearer 请求头中的访问令牌，并从数据库中重新读取令牌对应的用户：
+用户被删除、停用、角色已经改变或者在令牌签发之后吊销了会话（重置密码等，见 tokens.go）时，即使访问令牌还没有过期也会被拒绝。
+没有令牌或令牌无效时返回 401，角色不符时返回 403；通过后可以用 currentUser 取出当前用户。
+*/
+
+type currentUserKey struct{}
+
+// 取出请求上下文中的当前用户
+func currentUser(ctx context.Context) *data.User {
+	user, _ := ctx.Value(currentUserKey{}).(*data.User)
+	return user
+}
+
+// 返回只允许 roles 中的角色访问的中间件
+func (app *Config) requireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+			if !strings.EqualFold(scheme, "Bearer") || token == "" {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				app.errorJson(w, errors.New("authentication required"), http.StatusUnauthorized)
+				return
+			}
+
+			claims, err := app.verifyAccessToken(token)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				app.errorJson(w, err, http.StatusUnauthorized)
+				return
+			}
+
+			id, err := strconv.Atoi(claims.Subject)
+			if err != nil {
+				app.errorJson(w, errInvalidAccessToken, http.StatusUnauthorized)
+				return
+			}
+			user, err := app.Models.User.GetOne(id)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				app.userError(w, err)
+				return
+			}
+			if err != nil || user.Active != 1 {
+				app.errorJson(w, errInvalidAccessToken, http.StatusUnauthorized)
+				return
+			}
+			revokedAt, err := app.Models.User.SessionsRevokedAt(user.ID)
+			if err != nil {
+				app.userError(w, err)
+				return
+			}
+			if sessionRevoked(claims.IssuedAt, revokedAt) {
+				app.errorJson(w, errInvalidAccessToken, http.StatusUnauthorized)
+				return
+			}
+
+			for _, role := range roles {
+				if user.Role == role {
+					next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), currentUserKey{}, user)))
+					return
+				}
+			}
+			app.errorJson(w, errors.New("permission denied"), http.StatusForbidden)
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"authentication/data"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+/**
+该代码定义了忘记密码时通过邮件重置密码的流程。
+ForgotPassword 处理 POST /password/forgot：为邮箱对应的已启用用户签发一个重置密码的一次性令牌（有效期 RESET_TOKEN_TTL，默认 1h），
+并通过邮件服务发送包含重置链接的邮件（password-reset 模板），链接是 RESET_URL 加上 token 查询参数。
+无论邮箱是否存在都返回 202，并且在后台发送邮件（关闭服务时等待邮件发送完成），避免通过响应内容或响应时间判断邮箱是否已经注册；
+同一个用户每 tokenMailInterval 最多收到一封重置邮件，超过频率的请求同样返回 202。
+RESET_URL 默认指向前端的重置密码页面（front-end 的 /reset-password），页面通过 broker 的 reset_password 动作提交令牌和新密码。
+ResetPassword 处理 POST /password/reset：校验新密码（见 validatePassword）并使用令牌，令牌只能使用一次，过期或已使用时返回 400；
+设置新密码后吊销该用户的会话（刷新令牌和此前签发的访问令牌，见 data.User.RevokeSessions），使用户在所有设备上退出登录，并把重置密码的事件记录到日志服务。
+*/
+
+// PasswordResetConfig 是重置密码的配置
+type PasswordResetConfig struct {
+	ResetURL string        // 邮件中重置链接的地址，token 作为查询参数附加在后面
+	ResetTTL time.Duration // 重置链接的有效期
+}
+
+// ForgotPassword 向用户发送重置密码的邮件
+func (app *Config) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var requestPayload struct {
+		Email string `json:"email"`
+	}
+	if err := app.readJson(w, r, &requestPayload); err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
+	email := data.NormalizeEmail(requestPayload.Email)
+	if err := validateEmail(email); err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.Models.User.GetByEmail(email)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		log.Printf("Password reset requested for unknown email %s", email)
+	case err != nil:
+		app.userError(w, err)
+		return
+	case user.Active != 1:
+		// 未启用的用户不能通过重置密码登录
+		log.Printf("Password reset requested for inactive user %s", email)
+	default:
+		app.background(func() {
+			if !app.tokenMailAllowed(user.ID, data.PurposeResetPassword) {
+				log.Printf("Password reset email for %s throttled", user.Email)
+				return
+			}
+			if err := app.sendPasswordReset(user); err != nil {
+				log.Println("Error sending password reset email:", err)
+			}
+		})
+	}
+
+	app.writeJson(w, http.StatusAccepted, jsonResponse{
+		Error:   false,
+		Message: "If the email belongs to an account, a password reset link has been sent to it",
+	})
+}
+
+// 签发重置密码的令牌并发送重置邮件
+func (app *Config) sendPasswordReset(user *data.User) error {
+	token, err := app.Models.UserToken.Insert(user.ID, data.PurposeResetPassword, app.PasswordReset.ResetTTL)
+	if err != nil {
+		return err
+	}
+
+	link, err := tokenLink(app.PasswordReset.ResetURL, token)
+	if err != nil {
+		return err
+	}
+
+	return app.sendMail(user.Email, "Reset your password", "password-reset", map[string]any{
+		"name":    user.FirstName,
+		"link":    link,
+		"expires": "in " + app.PasswordReset.ResetTTL.String(),
+	})
+}
+
+// ResetPassword 使用重置密码的令牌为用户设置新的密码
+func (app *Config) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var requestPayload struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := app.readJson(w, r, &requestPayload); err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
+	if requestPayload.Token == "" {
+		app.errorJson(w, errors.New("token is required"), http.StatusBadRequest)
+		return
+	}
+	// 先校验密码再使用令牌，密码不符合要求时用户可以用同一个链接重试
+	if err := validatePassword(requestPayload.Password); err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
+
+	errInvalidLink := errors.New("the password reset link is invalid or has expired")
+	userID, err := app.Models.UserToken.Consume(requestPayload.Token, data.PurposeResetPassword)
+	if errors.Is(err, data.ErrInvalidToken) {
+		app.errorJson(w, errInvalidLink, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		app.userError(w, err)
+		return
+	}
+
+	user, err := app.Models.User.GetOne(userID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && user.Active != 1) {
+		app.errorJson(w, errInvalidLink, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		app.userError(w, err)
+		return
+	}
+
+	if err := user.ResetPassword(requestPayload.Password); err != nil {
+		app.userError(w, err)
+		return
+	}
+	if err := user.RevokeSessions(); err != nil {
+		app.userError(w, err)
+		return
+	}
+
+	// 使用单独的日志名称，重置密码不是登录，不能计入登录成功率
+	err = app.logRequest("password_reset", fmt.Sprintf("%s reset their password", user.Email), "INFO", map[string]any{
+		"email":   user.Email,
+		"user_id": user.ID,
+	})
+	if err != nil {
+		log.Println("Error logging password reset:", err)
+	}
+
+	app.writeJson(w, http.StatusOK, jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("Reset password for %s, please log in again", user.Email),
+	})
+}
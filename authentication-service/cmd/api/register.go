@@ -0,0 +1,196 @@
+package main
+
+import (
+	"authentication/data"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+/**
+该代码定义了自助注册和邮箱验证。
+Register 处理 POST /register：校验邮箱、姓名和密码（与用户管理接口的规则相同），创建一个未启用（user_active = 0）、等待验证邮箱（verification_pending）的普通用户，
+签发一个验证邮箱的一次性令牌（有效期 VERIFY_TOKEN_TTL，默认 24h），并在后台通过邮件服务发送包含验证链接的邮件，验证链接是 VERIFY_URL 加上 token 查询参数。
+邮箱已经注册但还没有验证时，只重新发送验证邮件（同一个用户每 tokenMailInterval 最多发送一封），不修改已经保存的姓名和密码：
+任何知道邮箱的人都可以调用注册接口，如果再次注册可以修改密码，攻击者就能在用户点击验证链接之前换成自己的密码；用户验证邮箱后可以通过忘记密码修改密码。
+邮箱已经验证或者用户已经被管理员启用时不做任何操作。
+无论邮箱是否已经注册，Register 都返回相同的响应，查询数据库之后的邮件和日志都在后台处理，接口不能通过响应内容或响应时间探测哪些邮箱已经注册。
+最近一个验证链接过期后仍然没有验证的未启用用户由 purgeExpiredTokens 删除，邮箱可以重新注册。
+Verify 处理 GET /verify?token=...：使用令牌并启用对应的用户，令牌只能使用一次，过期或已使用时返回 400。
+未启用的用户不能登录（见 Authenticate）。
+*/
+
+// RegistrationConfig 是注册的配置
+type RegistrationConfig struct {
+	VerifyURL string        // 邮件中验证链接的地址，token 作为查询参数附加在后面
+	VerifyTTL time.Duration // 验证链接的有效期
+}
+
+// Register 注册一个新用户并发送验证邮件
+func (app *Config) Register(w http.ResponseWriter, r *http.Request) {
+	var requestPayload userPayload
+	if err := app.readJson(w, r, &requestPayload); err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// 注册的用户只能是普通用户，并且在验证邮箱之前不启用
+	requestPayload.Role = ""
+	requestPayload.Active = nil
+	if err := requestPayload.validate(); err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
+	if err := validatePassword(requestPayload.Password); err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.Models.User.GetByEmail(requestPayload.Email)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		err = app.registerUser(requestPayload)
+	case err != nil:
+	case user.VerificationPending && user.Active == 0:
+		app.reregisterUser(user)
+	default:
+		// 邮箱已经验证或用户已经启用，返回与注册成功相同的响应
+		log.Printf("Registration for verified email %s ignored", requestPayload.Email)
+	}
+	if err != nil {
+		app.userError(w, err)
+		return
+	}
+
+	app.writeJson(w, http.StatusAccepted, jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("If %s can be registered, a verification link has been sent to it", requestPayload.Email),
+	})
+}
+
+// 创建一个等待验证邮箱的用户并在后台发送验证邮件
+func (app *Config) registerUser(payload userPayload) error {
+	id, err := app.Models.User.Insert(data.User{
+		Email:               payload.Email,
+		FirstName:           payload.FirstName,
+		LastName:            payload.LastName,
+		Password:            payload.Password,
+		Role:                data.RoleUser,
+		Active:              0,
+		VerificationPending: true,
+	})
+	if errors.Is(err, data.ErrDuplicateEmail) {
+		// 同一个邮箱的另一个注册请求刚刚创建了用户
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	app.background(func() {
+		if err := app.sendVerification(id, payload.Email, payload.FirstName); err != nil {
+			log.Println("Error sending verification email:", err)
+		}
+
+		err := app.logRequest("registration", fmt.Sprintf("%s registered", payload.Email), "INFO", map[string]any{
+			"event":   "registered",
+			"email":   payload.Email,
+			"user_id": id,
+		})
+		if err != nil {
+			log.Println("Error logging registration:", err)
+		}
+	})
+	return nil
+}
+
+// 在后台为还没有验证邮箱的用户重新发送验证邮件，不修改用户的姓名和密码
+func (app *Config) reregisterUser(user *data.User) {
+	app.background(func() {
+		if !app.tokenMailAllowed(user.ID, data.PurposeVerifyEmail) {
+			log.Printf("Verification email for %s throttled", user.Email)
+			return
+		}
+		if err := app.sendVerification(user.ID, user.Email, user.FirstName); err != nil {
+			log.Println("Error sending verification email:", err)
+		}
+
+		err := app.logRequest("registration", fmt.Sprintf("%s registered again", user.Email), "INFO", map[string]any{
+			"event":   "reregistered",
+			"email":   user.Email,
+			"user_id": user.ID,
+		})
+		if err != nil {
+			log.Println("Error logging registration:", err)
+		}
+	})
+}
+
+// 签发验证令牌并发送验证邮件
+func (app *Config) sendVerification(userID int, email, name string) error {
+	token, err := app.Models.UserToken.Insert(userID, data.PurposeVerifyEmail, app.Registration.VerifyTTL)
+	if err != nil {
+		return err
+	}
+
+	link, err := tokenLink(app.Registration.VerifyURL, token)
+	if err != nil {
+		return err
+	}
+
+	return app.sendMail(email, "Verify your email address", "verify-email", map[string]any{
+		"name":    name,
+		"link":    link,
+		"expires": "in " + app.Registration.VerifyTTL.String(),
+	})
+}
+
+// Verify 使用验证令牌启用用户
+func (app *Config) Verify(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		app.errorJson(w, errors.New("token is required"), http.StatusBadRequest)
+		return
+	}
+
+	userID, err := app.Models.UserToken.Consume(token, data.PurposeVerifyEmail)
+	if errors.Is(err, data.ErrInvalidToken) {
+		app.errorJson(w, errors.New("the verification link is invalid or has expired"), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		app.userError(w, err)
+		return
+	}
+
+	user, err := app.Models.User.GetOne(userID)
+	if err != nil {
+		app.userError(w, err)
+		return
+	}
+	if !user.VerificationPending {
+		app.errorJson(w, errors.New("the verification link is invalid or has expired"), http.StatusBadRequest)
+		return
+	}
+	if err := user.MarkVerified(); err != nil {
+		app.userError(w, err)
+		return
+	}
+
+	err = app.logRequest("registration", fmt.Sprintf("%s verified their email", user.Email), "INFO", map[string]any{
+		"event":   "verified",
+		"email":   user.Email,
+		"user_id": user.ID,
+	})
+	if err != nil {
+		log.Println("Error logging verification:", err)
+	}
+
+	app.writeJson(w, http.StatusOK, jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("Verified %s, you can now log in", user.Email),
+	})
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"authentication/data"
 	"github.com/go-chi/chi/v5/middleware"
 	"net/http"
 
@@ -15,6 +16,10 @@ mux := chi.NewRouter() 创建一个新的路由器实例。
 mux.Use(cors.Handler(cors.Options{...})) 设置 CORS（跨域资源共享）中间件，指定允许连接的来源、方法、头部等。
 mux.Use(middleware.Heartbeat("/ping")) 添加心跳路由中间件，将 "/ping" 映射到一个简单的处理函数。
 mux.Post("/authenticate", app.Authenticate) 将 "/authenticate" 路由映射到 app.Authenticate 方法。
+/refresh 和 /logout 使用刷新令牌刷新或吊销令牌，/.well-known/jwks.json 发布验证访问令牌的公钥，/sessions/revoked 返回最近吊销过会话的用户（见 tokens.go）。
+/register 注册新用户并发送验证邮件，/verify 使用邮件中的链接启用用户（见 register.go）。
+/password/forgot 发送重置密码的邮件，/password/reset 使用邮件中的令牌设置新密码（见 password.go）。
+/users 下是只允许管理员访问的用户管理接口（见 users.go）。
 该方法返回一个 http.Handler 对象，可以用于处理 HTTP 请求。
 */
 
@@ -37,5 +42,31 @@ func (app *Config) routes() http.Handler {
 	// 将 /authenticate 路由映射到 app.Authenticate 方法
 	mux.Post("/authenticate", app.Authenticate)
 
+	// 自助注册
+	mux.Post("/register", app.Register)
+	mux.Get("/verify", app.Verify)
+
+	// 忘记密码
+	mux.Post("/password/forgot", app.ForgotPassword)
+	mux.Post("/password/reset", app.ResetPassword)
+
+	// 令牌
+	mux.Post("/refresh", app.Refresh)
+	mux.Post("/logout", app.Logout)
+	mux.Get("/.well-known/jwks.json", app.JWKS)
+	mux.Get("/sessions/revoked", app.RevokedSessions)
+
+	// 用户管理，只允许管理员访问
+	mux.Route("/users", func(mux chi.Router) {
+		mux.Use(app.requireRole(data.RoleAdmin))
+		mux.Get("/", app.ListUsers)
+		mux.Post("/", app.CreateUser)
+		mux.Get("/{id}", app.GetUser)
+		mux.Put("/{id}", app.UpdateUser)
+		mux.Delete("/{id}", app.DeleteUser)
+		mux.Put("/{id}/active", app.SetUserActive)
+		mux.Put("/{id}/password", app.ResetUserPassword)
+	})
+
 	return mux
 }
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"authentication/data"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+/**
+该代码定义了访问令牌和刷新令牌的签发与验证。
+登录成功后签发一个访问令牌（JWT，由 Keyring 中最新的密钥签名，头部包含 kid）和一个刷新令牌：
+访问令牌的 sub 是用户 ID，另外包含 email 和 role，有效期较短（ACCESS_TOKEN_TTL），其他服务通过 JWKS 验证，不需要访问认证服务；
+刷新令牌是保存在 Postgres 中的随机字符串，有效期较长（REFRESH_TOKEN_TTL）。
+Refresh 处理 POST /refresh：吊销请求中的刷新令牌并签发新的访问令牌和刷新令牌，用户不存在或已停用时返回 401。
+Logout 处理 POST /logout：吊销请求中的刷新令牌，all 为 true 时吊销该用户所有的刷新令牌；已签发的访问令牌在过期之前仍然有效。
+JWKS 处理 GET /.well-known/jwks.json，返回验证访问令牌使用的公钥。
+重置密码、管理员重置密码或停用用户时通过 data.User.RevokeSessions 吊销用户的会话，在此之前签发的访问令牌同样失效：
+认证服务自己的接口在 requireRole 中检查，broker 定期调用 RevokedSessions（GET /sessions/revoked）获取最近 ACCESS_TOKEN_TTL 内吊销过会话的用户，
+更早签发的访问令牌已经过期，不需要返回；broker 获取之前的短时间内（见 broker 的 REVOCATIONS_REFRESH）这些访问令牌仍然可以在 broker 使用。
+访问令牌的 iat 精确到秒，与吊销在同一秒内签发的访问令牌同样视为失效（见 sessionRevoked）。
+*/
+
+// TokenConfig 是令牌的配置
+type TokenConfig struct {
+	Issuer     string        // 访问令牌的 iss
+	Audience   string        // 访问令牌的 aud
+	AccessTTL  time.Duration // 访问令牌的有效期
+	RefreshTTL time.Duration // 刷新令牌的有效期
+}
+
+// Claims 是访问令牌中的声明
+type Claims struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// 登录和刷新令牌的响应，为了兼容旧的客户端，用户的字段仍然在最外层
+type tokenResponse struct {
+	*data.User
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"` // 访问令牌的有效期（秒）
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresIn int64  `json:"refresh_expires_in"` // 刷新令牌的有效期（秒）
+}
+
+// 刷新和注销请求的数据结构
+type refreshPayload struct {
+	RefreshToken string `json:"refresh_token"`
+	All          bool   `json:"all,omitempty"` // 仅用于注销：吊销该用户所有的刷新令牌
+}
+
+var errInvalidAccessToken = errors.New("invalid access token")
+
+// 为用户签发访问令牌
+func (app *Config) signAccessToken(user *data.User) (string, error) {
+	key, err := app.Keyring.Current()
+	if err != nil {
+		return "", err
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := Claims{
+		Email: user.Email,
+		Role:  user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    app.Tokens.Issuer,
+			Subject:   strconv.Itoa(user.ID),
+			Audience:  jwt.ClaimStrings{app.Tokens.Audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(app.Tokens.AccessTTL)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        hex.EncodeToString(jti),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.KID
+	return token.SignedString(key.PrivateKey)
+}
+
+// 为用户签发访问令牌，refreshToken 是已经签发的刷新令牌
+func (app *Config) tokenResponse(user *data.User, refreshToken string) (*tokenResponse, error) {
+	accessToken, err := app.signAccessToken(user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenResponse{
+		User:             user,
+		AccessToken:      accessToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        int64(app.Tokens.AccessTTL / time.Second),
+		RefreshToken:     refreshToken,
+		RefreshExpiresIn: int64(app.Tokens.RefreshTTL / time.Second),
+	}, nil
+}
+
+// 为用户签发访问令牌和新的刷新令牌
+func (app *Config) issueTokens(user *data.User) (*tokenResponse, error) {
+	refreshToken, _, err := app.Models.RefreshToken.Insert(user.ID, app.Tokens.RefreshTTL)
+	if err != nil {
+		return nil, err
+	}
+	return app.tokenResponse(user, refreshToken)
+}
+
+// 验证访问令牌的签名、签发者、受众和有效期，返回其中的声明
+func (app *Config) verifyAccessToken(tokenString string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		key := app.Keyring.Lookup(kid)
+		if key == nil {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("unexpected signing algorithm %q", token.Method.Alg())
+		}
+		return key.Public(), nil
+	},
+		jwt.WithValidMethods([]string{data.AlgorithmEdDSA, data.AlgorithmRS256}),
+		jwt.WithIssuer(app.Tokens.Issuer),
+		jwt.WithAudience(app.Tokens.Audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidAccessToken, err)
+	}
+	return &claims, nil
+}
+
+// Refresh 使用刷新令牌签发新的访问令牌和刷新令牌
+func (app *Config) Refresh(w http.ResponseWriter, r *http.Request) {
+	var requestPayload refreshPayload
+	if err := app.readJson(w, r, &requestPayload); err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
+	if requestPayload.RefreshToken == "" {
+		app.errorJson(w, errors.New("refresh_token is required"), http.StatusBadRequest)
+		return
+	}
+
+	refreshToken, rt, err := app.Models.RefreshToken.Rotate(requestPayload.RefreshToken, app.Tokens.RefreshTTL)
+	if errors.Is(err, data.ErrInvalidToken) {
+		app.errorJson(w, err, http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Println("Error rotating refresh token:", err)
+		app.errorJson(w, errors.New("error refreshing token"), http.StatusInternalServerError)
+		return
+	}
+
+	// 用户在签发刷新令牌之后可能被删除或停用
+	user, err := app.Models.User.GetOne(rt.UserID)
+	if err != nil || user.Active != 1 {
+		if err := app.Models.RefreshToken.RevokeAllForUser(rt.UserID); err != nil {
+			log.Println("Error revoking refresh tokens:", err)
+		}
+		app.errorJson(w, data.ErrInvalidToken, http.StatusUnauthorized)
+		return
+	}
+
+	response, err := app.tokenResponse(user, refreshToken)
+	if err != nil {
+		log.Println("Error signing access token:", err)
+		app.errorJson(w, errors.New("error refreshing token"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusAccepted, jsonResponse{
+		Error:   false,
+		Message: "Token refreshed",
+		Data:    response,
+	})
+}
+
+// Logout 吊销刷新令牌
+func (app *Config) Logout(w http.ResponseWriter, r *http.Request) {
+	var requestPayload refreshPayload
+	if err := app.readJson(w, r, &requestPayload); err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
+	if requestPayload.RefreshToken == "" {
+		app.errorJson(w, errors.New("refresh_token is required"), http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if requestPayload.All {
+		// 只有有效的刷新令牌才能让用户在所有设备上退出登录
+		rt, lookupErr := app.Models.RefreshToken.GetByToken(requestPayload.RefreshToken)
+		if errors.Is(lookupErr, data.ErrInvalidToken) {
+			app.errorJson(w, lookupErr, http.StatusUnauthorized)
+			return
+		}
+		err = lookupErr
+		if err == nil {
+			err = app.Models.RefreshToken.RevokeAllForUser(rt.UserID)
+		}
+	} else {
+		err = app.Models.RefreshToken.Revoke(requestPayload.RefreshToken)
+	}
+	if err != nil {
+		log.Println("Error revoking refresh token:", err)
+		app.errorJson(w, errors.New("error logging out"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusAccepted, jsonResponse{
+		Error:   false,
+		Message: "Logged out",
+	})
+}
+
+// 签发时间为 issuedAt 的访问令牌是否因为 revokedAt 的吊销而失效，iat 只精确到秒，同一秒内签发的令牌也视为失效
+func sessionRevoked(issuedAt *jwt.NumericDate, revokedAt time.Time) bool {
+	if revokedAt.IsZero() {
+		return false
+	}
+	return issuedAt == nil || !issuedAt.Time.After(revokedAt.Truncate(time.Second))
+}
+
+// RevokedSessions 返回最近 ACCESS_TOKEN_TTL 内吊销过会话的用户，broker 据此拒绝吊销之前签发的访问令牌
+func (app *Config) RevokedSessions(w http.ResponseWriter, r *http.Request) {
+	revocations, err := app.Models.User.SessionsRevokedSince(time.Now().Add(-app.Tokens.AccessTTL))
+	if err != nil {
+		log.Println("Error listing revoked sessions:", err)
+		app.errorJson(w, errors.New("error listing revoked sessions"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, struct {
+		Revocations []data.SessionRevocation `json:"revocations"`
+	}{Revocations: revocations})
+}
+
+// JWKS 返回验证访问令牌使用的公钥
+func (app *Config) JWKS(w http.ResponseWriter, r *http.Request) {
+	headers := http.Header{}
+	headers.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(keyReloadInterval/time.Second)))
+
+	app.writeJson(w, http.StatusOK, struct {
+		Keys []JWK `json:"keys"`
+	}{Keys: app.Keyring.JWKS()}, headers)
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"authentication/data"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-chi/chi/v5"
+)
+
+/**
+该代码定义了用户管理接口，所有接口都只允许管理员访问（见 routes.go 和 middleware.go）：
+ListUsers 处理 GET /users，按 search 模糊搜索邮箱和姓名，page 和 page_size 分页（page_size 最大为 100）；
+GetUser 处理 GET /users/{id}；CreateUser 处理 POST /users，active 默认为 true，role 默认为 user；
+UpdateUser 处理 PUT /users/{id}，修改邮箱、姓名和角色；SetUserActive 处理 PUT /users/{id}/active，启用或停用用户（启用还没有验证邮箱的自助注册用户时视为已经验证，见 data.User.Update）；
+DeleteUser 处理 DELETE /users/{id}；ResetUserPassword 处理 PUT /users/{id}/password，为用户设置新的密码。
+邮箱必须是有效的地址并且不能与其他用户重复（返回 409），密码需要满足 validatePassword 的要求。
+停用用户、重置密码时吊销该用户的会话（刷新令牌和此前签发的访问令牌，见 data.User.RevokeSessions）；管理员不能停用、删除自己或者取消自己的管理员角色，避免没有管理员可用。
+*/
+
+const (
+	defaultPageSize = 20  // 默认每页的用户数
+	maxPageSize     = 100 // 每页最多的用户数
+)
+
+var errSelfModification = errors.New("administrators cannot deactivate, delete or demote themselves")
+
+// 创建和修改用户的请求
+type userPayload struct {
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Password  string `json:"password,omitempty"` // 仅用于创建
+	Role      string `json:"role,omitempty"`     // 为空时创建为 user，修改时保持不变
+	Active    *bool  `json:"active,omitempty"`   // 仅用于创建，为空时为 true
+}
+
+// 去掉字段两端的空白、把邮箱转换为小写并校验
+func (p *userPayload) validate() error {
+	p.Email = data.NormalizeEmail(p.Email)
+	p.FirstName = strings.TrimSpace(p.FirstName)
+	p.LastName = strings.TrimSpace(p.LastName)
+	p.Role = strings.TrimSpace(p.Role)
+
+	if err := validateEmail(p.Email); err != nil {
+		return err
+	}
+	if len(p.FirstName) > 255 || len(p.LastName) > 255 {
+		return errors.New("first_name and last_name must be at most 255 characters")
+	}
+	if p.Role != "" && p.Role != data.RoleUser && p.Role != data.RoleAdmin {
+		return fmt.Errorf("invalid role %q, expected %s or %s", p.Role, data.RoleUser, data.RoleAdmin)
+	}
+	return nil
+}
+
+// 校验邮箱地址，只接受不带显示名称的地址
+func validateEmail(email string) error {
+	if email == "" {
+		return errors.New("email is required")
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || len(email) > 255 {
+		return fmt.Errorf("invalid email %q", email)
+	}
+	return nil
+}
+
+// 校验密码：长度为 8 到 72 个字节（bcrypt 只使用前 72 个字节），并且至少包含一个字母和一个数字
+func validatePassword(password string) error {
+	if len(password) < 8 {
+		return errors.New("password must be at least 8 characters")
+	}
+	if len(password) > 72 {
+		return errors.New("password must be at most 72 bytes")
+	}
+	if strings.IndexFunc(password, unicode.IsLetter) < 0 || strings.IndexFunc(password, unicode.IsDigit) < 0 {
+		return errors.New("password must contain at least one letter and one digit")
+	}
+	return nil
+}
+
+// 邮箱被其他用户使用时返回 ErrDuplicateEmail
+func (app *Config) checkEmailAvailable(email string, userID int) error {
+	existing, err := app.Models.User.GetByEmail(email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if existing.ID != userID {
+		return data.ErrDuplicateEmail
+	}
+	return nil
+}
+
+// 返回错误对应的响应
+func (app *Config) userError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		app.errorJson(w, errors.New("user not found"), http.StatusNotFound)
+	case errors.Is(err, data.ErrDuplicateEmail):
+		app.errorJson(w, err, http.StatusConflict)
+	case errors.Is(err, errSelfModification):
+		app.errorJson(w, err, http.StatusForbidden)
+	default:
+		log.Println("Error managing users:", err)
+		app.errorJson(w, errors.New("internal error"), http.StatusInternalServerError)
+	}
+}
+
+// 读取路径中的用户 ID 并查询用户，失败时写入错误响应并返回 nil
+func (app *Config) userFromURL(w http.ResponseWriter, r *http.Request) *data.User {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		app.errorJson(w, errors.New("invalid user id"), http.StatusBadRequest)
+		return nil
+	}
+
+	user, err := app.Models.User.GetOne(id)
+	if err != nil {
+		app.userError(w, err)
+		return nil
+	}
+	return user
+}
+
+// 读取查询参数中的正整数，未设置时返回 def
+func queryInt(r *http.Request, key string, def int) (int, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid %s %q", key, v)
+	}
+	return n, nil
+}
+
+// ListUsers 分页搜索用户
+func (app *Config) ListUsers(w http.ResponseWriter, r *http.Request) {
+	page, err := queryInt(r, "page", 1)
+	if err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
+	pageSize, err := queryInt(r, "page_size", defaultPageSize)
+	if err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	search := strings.TrimSpace(r.URL.Query().Get("search"))
+
+	users, total, err := app.Models.User.Search(search, pageSize, (page-1)*pageSize)
+	if err != nil {
+		app.userError(w, err)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("%d users found", total),
+		Data: struct {
+			Users    []*data.User `json:"users"`
+			Total    int          `json:"total"`
+			Page     int          `json:"page"`
+			PageSize int          `json:"page_size"`
+		}{users, total, page, pageSize},
+	})
+}
+
+// GetUser 返回一个用户
+func (app *Config) GetUser(w http.ResponseWriter, r *http.Request) {
+	user := app.userFromURL(w, r)
+	if user == nil {
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonResponse{
+		Error:   false,
+		Message: "User found",
+		Data:    user,
+	})
+}
+
+// CreateUser 创建一个用户
+func (app *Config) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var requestPayload userPayload
+	if err := app.readJson(w, r, &requestPayload); err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
+	if err := requestPayload.validate(); err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
+	if err := validatePassword(requestPayload.Password); err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
+	if err := app.checkEmailAvailable(requestPayload.Email, 0); err != nil {
+		app.userError(w, err)
+		return
+	}
+
+	active := 1
+	if requestPayload.Active != nil && !*requestPayload.Active {
+		active = 0
+	}
+
+	id, err := app.Models.User.Insert(data.User{
+		Email:     requestPayload.Email,
+		FirstName: requestPayload.FirstName,
+		LastName:  requestPayload.LastName,
+		Password:  requestPayload.Password,
+		Role:      requestPayload.Role,
+		Active:    active,
+	})
+	if err != nil {
+		app.userError(w, err)
+		return
+	}
+
+	user, err := app.Models.User.GetOne(id)
+	if err != nil {
+		app.userError(w, err)
+		return
+	}
+
+	app.writeJson(w, http.StatusCreated, jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("Created user %s", user.Email),
+		Data:    user,
+	})
+}
+
+// UpdateUser 修改用户的邮箱、姓名和角色
+func (app *Config) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	user := app.userFromURL(w, r)
+	if user == nil {
+		return
+	}
+
+	var requestPayload userPayload
+	if err := app.readJson(w, r, &requestPayload); err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
+	if err := requestPayload.validate(); err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
+	if requestPayload.Role != "" && requestPayload.Role != data.RoleAdmin && user.ID == currentUser(r.Context()).ID {
+		app.userError(w, errSelfModification)
+		return
+	}
+	if err := app.checkEmailAvailable(requestPayload.Email, user.ID); err != nil {
+		app.userError(w, err)
+		return
+	}
+
+	user.Email = requestPayload.Email
+	user.FirstName = requestPayload.FirstName
+	user.LastName = requestPayload.LastName
+	if requestPayload.Role != "" {
+		user.Role = requestPayload.Role
+	}
+	if err := user.Update(); err != nil {
+		app.userError(w, err)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("Updated user %s", user.Email),
+		Data:    user,
+	})
+}
+
+// SetUserActive 启用或停用用户
+func (app *Config) SetUserActive(w http.ResponseWriter, r *http.Request) {
+	user := app.userFromURL(w, r)
+	if user == nil {
+		return
+	}
+
+	var requestPayload struct {
+		Active *bool `json:"active"`
+	}
+	if err := app.readJson(w, r, &requestPayload); err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
+	if requestPayload.Active == nil {
+		app.errorJson(w, errors.New("active is required"), http.StatusBadRequest)
+		return
+	}
+	if !*requestPayload.Active && user.ID == currentUser(r.Context()).ID {
+		app.userError(w, errSelfModification)
+		return
+	}
+
+	user.Active = 0
+	if *requestPayload.Active {
+		user.Active = 1
+	}
+	if err := user.Update(); err != nil {
+		app.userError(w, err)
+		return
+	}
+
+	// 停用的用户不能再使用已经签发的令牌
+	if user.Active == 0 {
+		if err := user.RevokeSessions(); err != nil {
+			app.userError(w, err)
+			return
+		}
+	}
+
+	message := fmt.Sprintf("Activated user %s", user.Email)
+	if user.Active == 0 {
+		message = fmt.Sprintf("Deactivated user %s", user.Email)
+	}
+	app.writeJson(w, http.StatusOK, jsonResponse{
+		Error:   false,
+		Message: message,
+		Data:    user,
+	})
+}
+
+// DeleteUser 删除用户，用户的刷新令牌随之删除
+func (app *Config) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	user := app.userFromURL(w, r)
+	if user == nil {
+		return
+	}
+	if user.ID == currentUser(r.Context()).ID {
+		app.userError(w, errSelfModification)
+		return
+	}
+
+	if err := user.Delete(); err != nil {
+		app.userError(w, err)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("Deleted user %s", user.Email),
+	})
+}
+
+// ResetUserPassword 为用户设置新的密码，并使用户在所有设备上退出登录
+func (app *Config) ResetUserPassword(w http.ResponseWriter, r *http.Request) {
+	user := app.userFromURL(w, r)
+	if user == nil {
+		return
+	}
+
+	var requestPayload struct {
+		Password string `json:"password"`
+	}
+	if err := app.readJson(w, r, &requestPayload); err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
+	if err := validatePassword(requestPayload.Password); err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := user.ResetPassword(requestPayload.Password); err != nil {
+		app.userError(w, err)
+		return
+	}
+	if err := user.RevokeSessions(); err != nil {
+		app.userError(w, err)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("Reset password for user %s", user.Email),
+	})
+}
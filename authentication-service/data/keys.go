@@ -0,0 +1,133 @@
+package data
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+/**
+该代码定义了签名密钥模型 SigningKey，用于签名和验证访问令牌。
+密钥的私钥以 PKCS#8 DER 格式保存在 signing_keys 表中，支持 EdDSA（Ed25519）和 RS256（RSA 2048）两种算法。
+每个密钥有一个随机的 kid，写入访问令牌的头部，验证时据此选择公钥；ExpiresAt 之后密钥不再用于签名和验证。
+*/
+
+// 支持的签名算法
+const (
+	AlgorithmEdDSA = "EdDSA"
+	AlgorithmRS256 = "RS256"
+)
+
+// SigningKey 是一个签名密钥
+type SigningKey struct {
+	KID        string
+	Algorithm  string
+	PrivateKey crypto.Signer
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+}
+
+// Public 返回密钥的公钥
+func (k *SigningKey) Public() crypto.PublicKey {
+	return k.PrivateKey.Public()
+}
+
+// GenerateSigningKey 生成一个使用 algorithm 算法、在 expiresAt 过期的新密钥
+func GenerateSigningKey(algorithm string, expiresAt time.Time) (*SigningKey, error) {
+	var (
+		signer crypto.Signer
+		err    error
+	)
+	switch algorithm {
+	case AlgorithmEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	case AlgorithmRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	kid := make([]byte, 8)
+	if _, err := rand.Read(kid); err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		KID:        hex.EncodeToString(kid),
+		Algorithm:  algorithm,
+		PrivateKey: signer,
+		CreatedAt:  time.Now(),
+		ExpiresAt:  expiresAt,
+	}, nil
+}
+
+// Insert 保存一个密钥
+func (k *SigningKey) Insert(key *SigningKey) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key.PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	stmt := `insert into signing_keys (kid, algorithm, private_key, created_at, expires_at) values ($1, $2, $3, $4, $5)`
+	_, err = db.ExecContext(ctx, stmt, key.KID, key.Algorithm, der, key.CreatedAt, key.ExpiresAt)
+	return err
+}
+
+// GetActive 返回所有未过期的密钥，最新的密钥在前
+func (k *SigningKey) GetActive() ([]*SigningKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select kid, algorithm, private_key, created_at, expires_at from signing_keys
+		where expires_at > $1 order by created_at desc`
+
+	rows, err := db.QueryContext(ctx, query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*SigningKey
+	for rows.Next() {
+		var (
+			key SigningKey
+			der []byte
+		)
+		if err := rows.Scan(&key.KID, &key.Algorithm, &der, &key.CreatedAt, &key.ExpiresAt); err != nil {
+			return nil, err
+		}
+
+		parsed, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %s: %w", key.KID, err)
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("signing key %s: unsupported key type %T", key.KID, parsed)
+		}
+		key.PrivateKey = signer
+		keys = append(keys, &key)
+	}
+	return keys, rows.Err()
+}
+
+// DeleteExpired 删除已经过期的密钥
+func (k *SigningKey) DeleteExpired() error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `delete from signing_keys where expires_at < $1`, time.Now())
+	return err
+}
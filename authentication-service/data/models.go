@@ -19,13 +19,19 @@ func New(dbPool *sql.DB) Models {
 	db = dbPool
 
 	return Models{
-		User: User{}, // 初始化 Models 结构体中的 User 字段
+		User:         User{},         // 初始化 Models 结构体中的 User 字段
+		RefreshToken: RefreshToken{}, // 刷新令牌
+		SigningKey:   SigningKey{},   // 签名密钥
+		UserToken:    UserToken{},    // 一次性令牌
 	}
 }
 
 // Models 是 data 包的类型。请注意，任何在此类型中作为成员的模型都可以在整个应用程序中使用，只要使用 app 变量，同时也需要在 New 函数中添加相应的模型。
 type Models struct {
-	User User // 用户模型
+	User         User         // 用户模型
+	RefreshToken RefreshToken // 刷新令牌模型
+	SigningKey   SigningKey   // 签名密钥模型
+	UserToken    UserToken    // 一次性令牌模型
 }
 
 // User 是从数据库中获取的用户结构体。
@@ -36,8 +42,11 @@ type User struct {
 	LastName  string    `json:"last_name,omitempty"`  // 姓氏
 	Password  string    `json:"-"`                    // 密码，使用 "-" 表示不在 JSON 中显示
 	Active    int       `json:"active"`               // 活动状态
+	Role      string    `json:"role"`                 // 角色：user 或 admin
 	CreatedAt time.Time `json:"created_at"`           // 创建时间
 	UpdatedAt time.Time `json:"updated_at"`           // 更新时间
+
+	VerificationPending bool `json:"verification_pending,omitempty"` // 自助注册后还没有验证邮箱
 }
 
 // GetAll 返回按姓氏排序的所有用户的切片。
@@ -45,7 +54,7 @@ func (u *User) GetAll() ([]*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout) // 创建上下文并设置超时时间
 	defer cancel()                                                      // 延迟取消上下文
 
-	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at
+	query := `select id, email, first_name, last_name, password, user_active, role, verification_pending, created_at, updated_at
 	from users order by last_name` // 查询语句，按姓氏排序
 
 	rows, err := db.QueryContext(ctx, query) // 执行查询并获取结果集
@@ -65,6 +74,8 @@ func (u *User) GetAll() ([]*User, error) {
 			&user.LastName,
 			&user.Password,
 			&user.Active,
+			&user.Role,
+			&user.VerificationPending,
 			&user.CreatedAt,
 			&user.UpdatedAt,
 		)
@@ -84,10 +95,10 @@ func (u *User) GetByEmail(email string) (*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at from users where email = $1` // 根据邮箱查询用户
+	query := `select id, email, first_name, last_name, password, user_active, role, verification_pending, created_at, updated_at from users where lower(email) = $1` // 根据邮箱查询用户，不区分大小写
 
 	var user User
-	row := db.QueryRowContext(ctx, query, email) // 执行查询并返回一行结果
+	row := db.QueryRowContext(ctx, query, NormalizeEmail(email)) // 执行查询并返回一行结果
 
 	err := row.Scan(
 		&user.ID,
@@ -96,6 +107,8 @@ func (u *User) GetByEmail(email string) (*User, error) {
 		&user.LastName,
 		&user.Password,
 		&user.Active,
+		&user.Role,
+		&user.VerificationPending,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -112,7 +125,7 @@ func (u *User) GetOne(id int) (*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at from users where id = $1` // 根据 ID 查询用户
+	query := `select id, email, first_name, last_name, password, user_active, role, verification_pending, created_at, updated_at from users where id = $1` // 根据 ID 查询用户
 
 	var user User
 	row := db.QueryRowContext(ctx, query, id) // 执行查询并返回一行结果
@@ -124,6 +137,8 @@ func (u *User) GetOne(id int) (*User, error) {
 		&user.LastName,
 		&user.Password,
 		&user.Active,
+		&user.Role,
+		&user.VerificationPending,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -135,7 +150,7 @@ func (u *User) GetOne(id int) (*User, error) {
 	return &user, nil
 }
 
-// Update 根据接收者 u 中的信息更新数据库中的一个用户。
+// Update 根据接收者 u 中的信息更新数据库中的一个用户。启用的用户不再等待验证邮箱，verification_pending 同时清除。
 func (u *User) Update() error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
@@ -145,21 +160,29 @@ func (u *User) Update() error {
 		first_name = $2,
 		last_name = $3,
 		user_active = $4,
-		updated_at = $5
-		where id = $6
+		role = $5,
+		verification_pending = $6,
+		updated_at = $7
+		where id = $8
 	` // 更新用户信息的 SQL 语句
 
+	u.Email = NormalizeEmail(u.Email)
+	if u.Active == 1 {
+		u.VerificationPending = false
+	}
 	_, err := db.ExecContext(ctx, stmt,
 		u.Email,
 		u.FirstName,
 		u.LastName,
 		u.Active,
+		u.Role,
+		u.VerificationPending,
 		time.Now(),
 		u.ID,
 	)
 
 	if err != nil {
-		return err
+		return uniqueEmail(err)
 	}
 
 	return nil
@@ -205,28 +228,36 @@ func (u *User) Insert(user User) (int, error) {
 		return 0, err
 	}
 
+	// 没有指定角色时为普通用户
+	role := user.Role
+	if role == "" {
+		role = RoleUser
+	}
+
 	var newID int
-	stmt := `insert into users (email, first_name, last_name, password, user_active, created_at, updated_at)
-		values ($1, $2, $3, $4, $5, $6, $7) returning id` // 插入用户的 SQL 语句
+	stmt := `insert into users (email, first_name, last_name, password, user_active, role, verification_pending, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id` // 插入用户的 SQL 语句
 
 	err = db.QueryRowContext(ctx, stmt,
-		user.Email,
+		NormalizeEmail(user.Email),
 		user.FirstName,
 		user.LastName,
 		hashedPassword,
 		user.Active,
+		role,
+		user.VerificationPending,
 		time.Now(),
 		time.Now(),
 	).Scan(&newID)
 
 	if err != nil {
-		return 0, err
+		return 0, uniqueEmail(err)
 	}
 
 	return newID, nil
 }
 
-// ResetPassword 是用于更改用户密码的方法。
+// ResetPassword 是用于更改用户密码的方法。密码修改后，用户所有未使用的一次性令牌（验证邮箱、重置密码）同时失效。
 func (u *User) ResetPassword(password string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
@@ -236,13 +267,24 @@ func (u *User) ResetPassword(password string) error {
 		return err
 	}
 
-	stmt := `update users set password = $1 where id = $2` // 更新用户密码的 SQL 语句
-	_, err = db.ExecContext(ctx, stmt, hashedPassword, u.ID)
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	return nil
+	stmt := `update users set password = $1 where id = $2` // 更新用户密码的 SQL 语句
+	if _, err := tx.ExecContext(ctx, stmt, hashedPassword, u.ID); err != nil {
+		return err
+	}
+
+	// 修改密码之前发出的链接不能再使用
+	stmt = `update user_tokens set used_at = $1 where user_id = $2 and used_at is null`
+	if _, err := tx.ExecContext(ctx, stmt, time.Now(), u.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // PasswordMatches 使用 Go 的 bcrypt 包比较用户提供的密码和数据库中存储的密码哈希值。如果密码匹配，返回 true；否则，返回 false。
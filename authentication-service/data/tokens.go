@@ -0,0 +1,169 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"time"
+)
+
+/**
+该代码定义了刷新令牌模型 RefreshToken。
+刷新令牌是 32 字节的随机数（base64url 编码），数据库中只保存它的 SHA-256 哈希，数据库泄露时无法用其中的数据刷新令牌。
+Rotate 在事务中吊销旧令牌并签发新令牌，每个刷新令牌只能使用一次；已经吊销的令牌再次被使用说明令牌可能被盗用，
+此时吊销该用户所有的刷新令牌，用户需要重新登录。
+*/
+
+// ErrInvalidToken 表示令牌不存在、已过期或已被吊销
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// RefreshToken 是一个刷新令牌的记录
+type RefreshToken struct {
+	ID        int64      `json:"id"`
+	UserID    int        `json:"user_id"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// 生成一个随机令牌
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// 令牌在数据库中保存的哈希
+func hashToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// 执行 SQL 语句的接口，*sql.DB 和 *sql.Tx 都实现了它
+type execer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// 为用户插入一个刷新令牌
+func insertRefreshToken(ctx context.Context, q execer, userID int, ttl time.Duration) (string, *RefreshToken, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	rt := &RefreshToken{UserID: userID, CreatedAt: time.Now(), ExpiresAt: time.Now().Add(ttl)}
+	stmt := `insert into refresh_tokens (user_id, token_hash, expires_at, created_at) values ($1, $2, $3, $4) returning id`
+	err = q.QueryRowContext(ctx, stmt, userID, hashToken(token), rt.ExpiresAt, rt.CreatedAt).Scan(&rt.ID)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, rt, nil
+}
+
+// Insert 为用户签发一个有效期为 ttl 的刷新令牌，返回令牌本身和它的记录
+func (t *RefreshToken) Insert(userID int, ttl time.Duration) (string, *RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return insertRefreshToken(ctx, db, userID, ttl)
+}
+
+// Rotate 吊销 token 并为同一个用户签发一个新的刷新令牌，token 无效时返回 ErrInvalidToken
+func (t *RefreshToken) Rotate(token string, ttl time.Duration) (string, *RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	defer tx.Rollback()
+
+	var old RefreshToken
+	query := `select id, user_id, expires_at, revoked_at from refresh_tokens where token_hash = $1 for update`
+	err = tx.QueryRowContext(ctx, query, hashToken(token)).Scan(&old.ID, &old.UserID, &old.ExpiresAt, &old.RevokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil, ErrInvalidToken
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	if old.RevokedAt != nil {
+		// 已经使用过的令牌被再次使用，吊销该用户所有的刷新令牌
+		tx.Rollback()
+		if err := t.RevokeAllForUser(old.UserID); err != nil {
+			return "", nil, err
+		}
+		return "", nil, ErrInvalidToken
+	}
+	if time.Now().After(old.ExpiresAt) {
+		return "", nil, ErrInvalidToken
+	}
+
+	if _, err := tx.ExecContext(ctx, `update refresh_tokens set revoked_at = $1 where id = $2`, time.Now(), old.ID); err != nil {
+		return "", nil, err
+	}
+	newToken, rt, err := insertRefreshToken(ctx, tx, old.UserID, ttl)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", nil, err
+	}
+	return newToken, rt, nil
+}
+
+// GetByToken 返回一个未吊销且未过期的刷新令牌的记录，token 无效时返回 ErrInvalidToken
+func (t *RefreshToken) GetByToken(token string) (*RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, user_id, expires_at, revoked_at, created_at from refresh_tokens
+		where token_hash = $1 and revoked_at is null and expires_at > $2`
+
+	var rt RefreshToken
+	err := db.QueryRowContext(ctx, query, hashToken(token), time.Now()).Scan(&rt.ID, &rt.UserID, &rt.ExpiresAt, &rt.RevokedAt, &rt.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rt, nil
+}
+
+// Revoke 吊销一个刷新令牌，令牌不存在或已经吊销时不做任何事
+func (t *RefreshToken) Revoke(token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update refresh_tokens set revoked_at = $1 where token_hash = $2 and revoked_at is null`
+	_, err := db.ExecContext(ctx, stmt, time.Now(), hashToken(token))
+	return err
+}
+
+// RevokeAllForUser 吊销用户所有的刷新令牌，使用户在所有设备上退出登录
+func (t *RefreshToken) RevokeAllForUser(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update refresh_tokens set revoked_at = $1 where user_id = $2 and revoked_at is null`
+	_, err := db.ExecContext(ctx, stmt, time.Now(), userID)
+	return err
+}
+
+// DeleteExpired 删除已经过期的刷新令牌
+func (t *RefreshToken) DeleteExpired() error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `delete from refresh_tokens where expires_at < $1`, time.Now())
+	return err
+}
@@ -0,0 +1,326 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 测试使用的 refresh_tokens 表，由 tokenConnector 在内存中实现刷新令牌使用的 SQL 语句
+type tokenRow struct {
+	id        int64
+	userID    int64
+	hash      []byte
+	expiresAt time.Time
+	revokedAt *time.Time
+	createdAt time.Time
+}
+
+type tokenTable struct {
+	mu     sync.Mutex
+	rows   []*tokenRow
+	nextID int64
+}
+
+// 找到哈希为 hash 的令牌
+func (tt *tokenTable) byHash(hash []byte) *tokenRow {
+	for _, r := range tt.rows {
+		if bytes.Equal(r.hash, hash) {
+			return r
+		}
+	}
+	return nil
+}
+
+// 执行一条语句，返回查询结果的行
+func (tt *tokenTable) run(query string, args []driver.Value) ([][]driver.Value, int64, error) {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	query = strings.Join(strings.Fields(query), " ")
+	switch {
+	case strings.HasPrefix(query, "insert into refresh_tokens"):
+		tt.nextID++
+		tt.rows = append(tt.rows, &tokenRow{
+			id:        tt.nextID,
+			userID:    args[0].(int64),
+			hash:      args[1].([]byte),
+			expiresAt: args[2].(time.Time),
+			createdAt: args[3].(time.Time),
+		})
+		return [][]driver.Value{{tt.nextID}}, 1, nil
+
+	case strings.HasPrefix(query, "select id, user_id, expires_at, revoked_at from refresh_tokens where token_hash = $1"):
+		r := tt.byHash(args[0].([]byte))
+		if r == nil {
+			return nil, 0, nil
+		}
+		return [][]driver.Value{{r.id, r.userID, r.expiresAt, timeValue(r.revokedAt)}}, 0, nil
+
+	case strings.HasPrefix(query, "select id, user_id, expires_at, revoked_at, created_at from refresh_tokens"):
+		r := tt.byHash(args[0].([]byte))
+		if r == nil || r.revokedAt != nil || !r.expiresAt.After(args[1].(time.Time)) {
+			return nil, 0, nil
+		}
+		return [][]driver.Value{{r.id, r.userID, r.expiresAt, nil, r.createdAt}}, 0, nil
+
+	case strings.HasPrefix(query, "update refresh_tokens set revoked_at = $1 where"):
+		at := args[0].(time.Time)
+		var n int64
+		for _, r := range tt.rows {
+			var match bool
+			switch {
+			case strings.HasSuffix(query, "where id = $2"):
+				match = r.id == args[1].(int64)
+			case strings.HasSuffix(query, "where user_id = $2 and revoked_at is null"):
+				match = r.userID == args[1].(int64) && r.revokedAt == nil
+			case strings.HasSuffix(query, "where token_hash = $2 and revoked_at is null"):
+				match = bytes.Equal(r.hash, args[1].([]byte)) && r.revokedAt == nil
+			default:
+				return nil, 0, fmt.Errorf("unexpected statement %q", query)
+			}
+			if match {
+				r.revokedAt = &at
+				n++
+			}
+		}
+		return nil, n, nil
+	}
+	return nil, 0, fmt.Errorf("unexpected statement %q", query)
+}
+
+func timeValue(t *time.Time) driver.Value {
+	if t == nil {
+		return nil
+	}
+	return *t
+}
+
+// 快照和恢复，用于事务回滚
+func (tt *tokenTable) snapshot() []tokenRow {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	rows := make([]tokenRow, len(tt.rows))
+	for i, r := range tt.rows {
+		rows[i] = *r
+	}
+	return rows
+}
+
+func (tt *tokenTable) restore(rows []tokenRow) {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	tt.rows = tt.rows[:0]
+	for i := range rows {
+		tt.rows = append(tt.rows, &rows[i])
+	}
+}
+
+type tokenConnector struct{ table *tokenTable }
+
+func (c tokenConnector) Connect(context.Context) (driver.Conn, error) {
+	return &tokenConn{table: c.table}, nil
+}
+func (c tokenConnector) Driver() driver.Driver { return nil }
+
+type tokenConn struct{ table *tokenTable }
+
+func (c *tokenConn) Prepare(query string) (driver.Stmt, error) {
+	return &tokenStmt{table: c.table, query: query}, nil
+}
+func (c *tokenConn) Close() error { return nil }
+func (c *tokenConn) Begin() (driver.Tx, error) {
+	return &tokenTx{table: c.table, saved: c.table.snapshot()}, nil
+}
+
+type tokenTx struct {
+	table *tokenTable
+	saved []tokenRow
+}
+
+func (tx *tokenTx) Commit() error   { return nil }
+func (tx *tokenTx) Rollback() error { tx.table.restore(tx.saved); return nil }
+
+type tokenStmt struct {
+	table *tokenTable
+	query string
+}
+
+func (s *tokenStmt) Close() error  { return nil }
+func (s *tokenStmt) NumInput() int { return -1 }
+func (s *tokenStmt) Exec(args []driver.Value) (driver.Result, error) {
+	_, n, err := s.table.run(s.query, args)
+	return driver.RowsAffected(n), err
+}
+func (s *tokenStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows, _, err := s.table.run(s.query, args)
+	return &tokenRows{rows: rows}, err
+}
+
+type tokenRows struct{ rows [][]driver.Value }
+
+func (r *tokenRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+func (r *tokenRows) Close() error { return nil }
+func (r *tokenRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// 使用内存中的 refresh_tokens 表初始化 data 包
+func newTokenTable(t *testing.T) *tokenTable {
+	table := &tokenTable{}
+	pool := sql.OpenDB(tokenConnector{table: table})
+	t.Cleanup(func() { pool.Close() })
+	New(pool)
+	return table
+}
+
+func TestRefreshTokenRotate(t *testing.T) {
+	var rt RefreshToken
+
+	tests := []struct {
+		name string
+		// 准备要轮换的令牌，other 是同一个用户的另一个有效令牌
+		setup          func(t *testing.T) (token, other string)
+		wantErr        error
+		wantOtherValid bool // 轮换后 other 是否仍然有效
+	}{
+		{
+			name: "valid token",
+			setup: func(t *testing.T) (string, string) {
+				return insertTestToken(t, 1, time.Hour), insertTestToken(t, 1, time.Hour)
+			},
+			wantOtherValid: true,
+		},
+		{
+			name: "unknown token",
+			setup: func(t *testing.T) (string, string) {
+				token, _ := newToken()
+				return token, insertTestToken(t, 1, time.Hour)
+			},
+			wantErr:        ErrInvalidToken,
+			wantOtherValid: true,
+		},
+		{
+			name: "expired token",
+			setup: func(t *testing.T) (string, string) {
+				return insertTestToken(t, 1, -time.Minute), insertTestToken(t, 1, time.Hour)
+			},
+			wantErr:        ErrInvalidToken,
+			wantOtherValid: true,
+		},
+		{
+			name: "logged out token",
+			setup: func(t *testing.T) (string, string) {
+				token := insertTestToken(t, 1, time.Hour)
+				if err := rt.Revoke(token); err != nil {
+					t.Fatal(err)
+				}
+				return token, insertTestToken(t, 1, time.Hour)
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "reused token revokes the rotated one",
+			setup: func(t *testing.T) (string, string) {
+				token := insertTestToken(t, 1, time.Hour)
+				rotated, _, err := rt.Rotate(token, time.Hour)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return token, rotated
+			},
+			wantErr: ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := newTokenTable(t)
+			token, other := tt.setup(t)
+			// 其他用户的令牌不受影响
+			stranger := insertTestToken(t, 2, time.Hour)
+
+			newToken, record, err := rt.Rotate(token, time.Hour)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Rotate = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if record.UserID != 1 || newToken == token {
+					t.Errorf("Rotate = %q, %+v, want a new token for user 1", newToken, record)
+				}
+				// 每个刷新令牌只能使用一次
+				if _, err := rt.GetByToken(token); !errors.Is(err, ErrInvalidToken) {
+					t.Errorf("rotated token is still valid: %v", err)
+				}
+				if _, err := rt.GetByToken(newToken); err != nil {
+					t.Errorf("new token is invalid: %v", err)
+				}
+			}
+
+			if _, err := rt.GetByToken(other); (err == nil) != tt.wantOtherValid {
+				t.Errorf("other token of the user: GetByToken = %v, want valid %v", err, tt.wantOtherValid)
+			}
+			if _, err := rt.GetByToken(stranger); err != nil {
+				t.Errorf("token of another user: GetByToken = %v", err)
+			}
+
+			// 数据库中只保存令牌的哈希
+			for _, r := range table.snapshot() {
+				if string(r.hash) == token || string(r.hash) == newToken {
+					t.Error("plain token stored in the database")
+				}
+			}
+		})
+	}
+}
+
+func TestRefreshTokenRevokeAllForUser(t *testing.T) {
+	var rt RefreshToken
+	newTokenTable(t)
+
+	tokens := []string{insertTestToken(t, 1, time.Hour), insertTestToken(t, 1, time.Hour)}
+	stranger := insertTestToken(t, 2, time.Hour)
+
+	if err := rt.RevokeAllForUser(1); err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range tokens {
+		if _, err := rt.GetByToken(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("GetByToken = %v, want %v", err, ErrInvalidToken)
+		}
+		if _, _, err := rt.Rotate(token, time.Hour); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Rotate = %v, want %v", err, ErrInvalidToken)
+		}
+	}
+	if _, err := rt.GetByToken(stranger); err != nil {
+		t.Errorf("token of another user: GetByToken = %v", err)
+	}
+}
+
+// 为用户插入一个有效期为 ttl 的刷新令牌，ttl 为负数时令牌已经过期
+func insertTestToken(t *testing.T, userID int, ttl time.Duration) string {
+	t.Helper()
+	token, _, err := (&RefreshToken{}).Insert(userID, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
@@ -0,0 +1,99 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+/**
+该代码定义了一次性令牌模型 UserToken，例如注册后验证邮箱和忘记密码时重置密码使用的令牌。
+令牌与刷新令牌一样是 32 字节的随机数，数据库中只保存它的 SHA-256 哈希；每个令牌有用途（purpose）和过期时间，只能使用一次。
+为用户签发新令牌时，该用户同一用途未使用的旧令牌立即失效，只有最近一封邮件中的链接有效。
+*/
+
+// 一次性令牌的用途
+const (
+	PurposeVerifyEmail   = "verify_email"
+	PurposeResetPassword = "reset_password"
+)
+
+// UserToken 是一次性令牌模型
+type UserToken struct{}
+
+// Insert 为用户签发一个用途为 purpose、有效期为 ttl 的一次性令牌，并使该用户同一用途未使用的旧令牌失效
+func (t *UserToken) Insert(userID int, purpose string, ttl time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	stmt := `update user_tokens set used_at = $1 where user_id = $2 and purpose = $3 and used_at is null`
+	if _, err := tx.ExecContext(ctx, stmt, now, userID, purpose); err != nil {
+		return "", err
+	}
+
+	stmt = `insert into user_tokens (user_id, purpose, token_hash, expires_at, created_at) values ($1, $2, $3, $4, $5)`
+	if _, err := tx.ExecContext(ctx, stmt, userID, purpose, hashToken(token), now.Add(ttl), now); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Consume 使用一个用途为 purpose 的令牌并返回它所属的用户 ID；令牌不存在、已过期或已使用时返回 ErrInvalidToken
+func (t *UserToken) Consume(token, purpose string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	// 在一条语句中检查并标记令牌，同一个令牌并发使用时只有一个请求成功
+	stmt := `update user_tokens set used_at = $1
+		where token_hash = $2 and purpose = $3 and used_at is null and expires_at > $1
+		returning user_id`
+
+	var userID int
+	err := db.QueryRowContext(ctx, stmt, time.Now(), hashToken(token), purpose).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrInvalidToken
+	}
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// DeleteExpired 删除已经过期的一次性令牌
+func (t *UserToken) DeleteExpired() error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `delete from user_tokens where expires_at < $1`, time.Now())
+	return err
+}
+
+// LastIssuedAt 返回最近一次为用户签发用途为 purpose 的令牌的时间，从未签发过时返回零值
+func (t *UserToken) LastIssuedAt(userID int, purpose string) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var last sql.NullTime
+	err := db.QueryRowContext(ctx, `select max(created_at) from user_tokens where user_id = $1 and purpose = $2`, userID, purpose).Scan(&last)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return last.Time, nil
+}
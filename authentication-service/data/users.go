@@ -0,0 +1,190 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+/**
+该代码包含用户管理接口使用的查询。
+Search 按邮箱或姓名模糊搜索用户并分页，同时返回匹配的总数。
+CountByRole 返回某个角色的用户数，启动时用来判断是否需要创建第一个管理员。
+自助注册的用户在验证邮箱之前 verification_pending 为 true：MarkVerified 在验证后启用用户，管理员启用用户时（见 Update）同样清除 verification_pending，
+DeleteUnverified 删除最近一个验证链接过期后仍然没有验证的未启用用户。
+RevokeSessions 使用户在所有设备上退出登录：吊销用户所有的刷新令牌，并记录 sessions_revoked_at，在此之前签发的访问令牌同样失效；
+访问令牌由 broker 通过 JWKS 在本地验证，broker 定期通过 SessionsRevokedSince 获取最近吊销的用户（见 cmd/api/tokens.go 的 RevokedSessions）。
+邮箱不区分大小写：users 表的 lower(email) 上有唯一索引（见 schema.go），Insert 和 Update 保存 NormalizeEmail 之后的邮箱，
+GetByEmail 按 lower(email) 查询，违反唯一约束时返回 ErrDuplicateEmail。
+*/
+
+// ErrDuplicateEmail 表示邮箱已经被其他用户使用
+var ErrDuplicateEmail = errors.New("email is already in use")
+
+// NormalizeEmail 返回去掉两端空白并转换为小写的邮箱
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// 把违反唯一约束的错误转换为 ErrDuplicateEmail
+func uniqueEmail(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrDuplicateEmail
+	}
+	return err
+}
+
+// Search 返回邮箱或姓名包含 search 的用户（不区分大小写，search 为空时返回所有用户），按姓氏排序，
+// 跳过前 offset 个，最多返回 limit 个，同时返回匹配的总数
+func (u *User) Search(search string, limit, offset int) ([]*User, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	// 转义 like 的通配符，search 按字面匹配
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(search) + "%"
+
+	var total int
+	countQuery := `select count(*) from users
+		where email ilike $1 or first_name ilike $1 or last_name ilike $1`
+	if err := db.QueryRowContext(ctx, countQuery, pattern).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `select id, email, first_name, last_name, password, user_active, role, verification_pending, created_at, updated_at
+	from users where email ilike $1 or first_name ilike $1 or last_name ilike $1
+	order by last_name, id limit $2 offset $3`
+
+	rows, err := db.QueryContext(ctx, query, pattern, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		var user User
+		err := rows.Scan(
+			&user.ID,
+			&user.Email,
+			&user.FirstName,
+			&user.LastName,
+			&user.Password,
+			&user.Active,
+			&user.Role,
+			&user.VerificationPending,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if err != nil {
+			log.Println("Error scanning", err)
+			return nil, 0, err
+		}
+
+		users = append(users, &user)
+	}
+
+	return users, total, rows.Err()
+}
+
+// CountByRole 返回角色为 role 的用户数
+func (u *User) CountByRole(role string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var count int
+	err := db.QueryRowContext(ctx, `select count(*) from users where role = $1`, role).Scan(&count)
+	return count, err
+}
+
+// MarkVerified 标记用户已经验证邮箱并启用用户
+func (u *User) MarkVerified() error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update users set verification_pending = false, user_active = 1, updated_at = $1 where id = $2`
+	_, err := db.ExecContext(ctx, stmt, time.Now(), u.ID)
+	return err
+}
+
+// DeleteUnverified 删除 before 之前注册、before 之后没有再签发验证令牌并且还没有验证邮箱的未启用用户，返回删除的用户数
+func (u *User) DeleteUnverified(before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `delete from users u where u.verification_pending and u.user_active = 0 and u.created_at < $1
+		and not exists (select 1 from user_tokens t where t.user_id = u.id and t.purpose = $2 and t.created_at >= $1)`
+	result, err := db.ExecContext(ctx, stmt, before, PurposeVerifyEmail)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// SessionRevocation 表示用户在 RevokedAt 之前签发的访问令牌已经失效
+type SessionRevocation struct {
+	UserID    int       `json:"user_id"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+// RevokeSessions 吊销用户所有的刷新令牌，并使此前签发的访问令牌失效
+func (u *User) RevokeSessions() error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if _, err := tx.ExecContext(ctx, `update users set sessions_revoked_at = $1 where id = $2`, now, u.ID); err != nil {
+		return err
+	}
+	stmt := `update refresh_tokens set revoked_at = $1 where user_id = $2 and revoked_at is null`
+	if _, err := tx.ExecContext(ctx, stmt, now, u.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SessionsRevokedAt 返回用户最近一次吊销会话的时间，从未吊销过时返回零值
+func (u *User) SessionsRevokedAt(id int) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var revokedAt sql.NullTime
+	err := db.QueryRowContext(ctx, `select sessions_revoked_at from users where id = $1`, id).Scan(&revokedAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return revokedAt.Time, nil
+}
+
+// SessionsRevokedSince 返回 since 之后吊销过会话的用户
+func (u *User) SessionsRevokedSince(since time.Time) ([]SessionRevocation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `select id, sessions_revoked_at from users where sessions_revoked_at > $1 order by id`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revocations := []SessionRevocation{}
+	for rows.Next() {
+		var r SessionRevocation
+		if err := rows.Scan(&r.UserID, &r.RevokedAt); err != nil {
+			return nil, err
+		}
+		revocations = append(revocations, r)
+	}
+	return revocations, rows.Err()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"broker/config"
+	"broker/resilience"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// auth 动作：调用认证服务验证用户的邮箱和密码
+func init() {
+	actions.Register(newAction("auth", nil, func(app *Config, w http.ResponseWriter, r *http.Request, p *AuthPayload) {
+		app.authenticate(w, r, *p)
+	}))
+}
+
+type AuthPayload struct { // 定义 AuthPayload 结构体，用于认证的载荷
+	Email    string `json:"email" required:"true"`    // 邮箱
+	Password string `json:"password" required:"true"` // 密码
+}
+
+func (app *Config) authenticate(w http.ResponseWriter, r *http.Request, a AuthPayload) {
+	jsonData, _ := json.MarshalIndent(a, "", "\t") // 将认证载荷 a 转换为 JSON 格式的字节数据
+
+	var jsonFromService jsonResponse
+
+	// 认证请求是幂等的，失败时可以重试
+	err := app.call(r.Context(), config.ServiceAuth, true, func(ctx context.Context) error {
+		authServiceUrl, err := app.serviceURL(config.ServiceAuth, "/authenticate")
+		if err != nil {
+			return resilience.Permanent(err)
+		}
+
+		request, err := http.NewRequestWithContext(ctx, "POST", authServiceUrl, bytes.NewReader(jsonData)) // 创建 POST 请求
+		if err != nil {
+			return resilience.Permanent(err)
+		}
+		request.Header.Set("Content-Type", "application/json")
+
+		response, err := app.HTTPClient.Do(request) // 使用共享的客户端发送 HTTP 请求
+		if err != nil {
+			return err
+		}
+		defer drainAndClose(response.Body)
+
+		// 确保返回的状态码正确
+		switch {
+		case response.StatusCode == http.StatusUnauthorized:
+			return resilience.Permanent(errInvalidCredentials) // 如果状态码是 401 Unauthorized，则返回无效凭据的错误
+		case response.StatusCode >= http.StatusInternalServerError:
+			return fmt.Errorf("auth service returned status %d", response.StatusCode) // 服务端错误，可以重试
+		case response.StatusCode != http.StatusAccepted:
+			return resilience.Permanent(errors.New("error calling auth service")) // 如果状态码不是 202 Accepted，则返回调用认证服务时的错误
+		}
+
+		return json.NewDecoder(response.Body).Decode(&jsonFromService) // 从响应中解码 JSON 数据到 jsonFromService
+	})
+	if errors.Is(err, errInvalidCredentials) {
+		app.errorJson(w, errInvalidCredentials, http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		app.dependencyError(w, err)
+		return
+	}
+
+	if jsonFromService.Error {
+		app.errorJson(w, errors.New(jsonFromService.Message), http.StatusUnauthorized)
+		return
+	}
+
+	var payload jsonResponse
+	payload.Error = false
+	payload.Message = "Authenticated!"
+	payload.Data = jsonFromService.Data
+
+	app.writeJson(w, http.StatusAccepted, payload) // 调用 writeJson 方法将 payload 写入响应
+}
@@ -0,0 +1,23 @@
+package main
+
+import "net/http"
+
+// log 动作：按配置的传输方式把日志写入日志服务，需要登录
+func init() {
+	actions.Register(newAction("log", validateLog, func(app *Config, w http.ResponseWriter, r *http.Request, p *LogPayload) {
+		app.logItem(w, r, *p)
+	}, requireAuth()))
+}
+
+type LogPayload struct { // 定义 LogPayload 结构体，用于日志的载荷
+	Name string `json:"name" required:"true"` // 日志名称
+	Data string `json:"data"`                 // 日志数据
+
+	Severity   string         `json:"severity,omitempty"`   // 日志级别：INFO、WARNING 或 ERROR，为空时为 INFO
+	Service    string         `json:"service,omitempty"`    // 产生日志的服务
+	Host       string         `json:"host,omitempty"`       // 产生日志的主机
+	TraceID    string         `json:"trace_id,omitempty"`   // 请求或链路 ID，为空时使用 broker 的请求 ID
+	Attributes map[string]any `json:"attributes,omitempty"` // 任意的结构化字段
+
+	Transport string `json:"transport,omitempty"` // 本次请求优先使用的传输方式，为空时使用配置中的默认值
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"broker/config"
+	"broker/resilience"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+)
+
+// mail 动作：调用邮件服务发送邮件，需要登录
+func init() {
+	actions.Register(newAction("mail", validateMail, func(app *Config, w http.ResponseWriter, r *http.Request, p *MailPayload) {
+		app.sendMail(w, r, *p)
+	}, requireAuth()))
+}
+
+// 校验收件人和发件人的邮箱地址格式
+func validateMail(p *MailPayload) error {
+	if _, err := mail.ParseAddress(p.To); err != nil {
+		return fmt.Errorf("invalid to address: %w", err)
+	}
+	if p.From != "" {
+		if _, err := mail.ParseAddress(p.From); err != nil {
+			return fmt.Errorf("invalid from address: %w", err)
+		}
+	}
+	return nil
+}
+
+type MailPayload struct { // 定义 MailPayload 结构体，用于邮件的载荷
+	From    string `json:"from"`                    // 发件人
+	To      string `json:"to" required:"true"`      // 收件人
+	Subject string `json:"subject" required:"true"` // 主题
+	Message string `json:"message" required:"true"` // 内容
+}
+
+func (app *Config) sendMail(w http.ResponseWriter, r *http.Request, msg MailPayload) {
+	jsonData, _ := json.MarshalIndent(msg, "", "\t") // 将邮件载荷 msg 转换为 JSON 格式的字节数据
+
+	// 发送邮件不是幂等的，只在熔断器保护下调用一次
+	err := app.call(r.Context(), config.ServiceMailer, false, func(ctx context.Context) error {
+		// 调用邮件服务
+		mailServiceUrl, err := app.serviceURL(config.ServiceMailer, "/send")
+		if err != nil {
+			return resilience.Permanent(err)
+		}
+
+		// 发送 POST 请求到邮件服务
+		request, err := http.NewRequestWithContext(ctx, "POST", mailServiceUrl, bytes.NewReader(jsonData))
+		if err != nil {
+			return resilience.Permanent(err)
+		}
+		request.Header.Set("Content-Type", "application/json")
+
+		response, err := app.HTTPClient.Do(request) // 使用共享的客户端发送 HTTP 请求
+		if err != nil {
+			return err
+		}
+		defer drainAndClose(response.Body)
+
+		// 确保返回的状态码正确
+		switch {
+		case response.StatusCode >= http.StatusInternalServerError:
+			return fmt.Errorf("mail service returned status %d", response.StatusCode)
+		case response.StatusCode != http.StatusAccepted:
+			return resilience.Permanent(errors.New("error calling mail service")) // 如果状态码不是 202 Accepted，则返回调用邮件服务时的错误
+		}
+		return nil
+	})
+	if err != nil {
+		app.dependencyError(w, err)
+		return
+	}
+
+	// 发送 JSON 响应
+	var payload jsonResponse
+	payload.Error = false
+	payload.Message = "Message send to " + msg.To
+
+	app.writeJson(w, http.StatusAccepted, payload) // 调用 writeJson 方法将 payload 写入响应
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// register、forgot_password 和 reset_password 动作：注册新用户，以及忘记密码时通过邮件重置密码，不需要登录。
+// 这些调用会发送邮件或使用一次性令牌，因此不重试
+func init() {
+	actions.Register(newAction("register", nil, func(app *Config, w http.ResponseWriter, r *http.Request, p *RegisterPayload) {
+		app.proxyAuthService(w, r, "POST", "/register", p, false)
+	}))
+	actions.Register(newAction("forgot_password", nil, func(app *Config, w http.ResponseWriter, r *http.Request, p *ForgotPasswordPayload) {
+		app.proxyAuthService(w, r, "POST", "/password/forgot", p, false)
+	}))
+	actions.Register(newAction("reset_password", nil, func(app *Config, w http.ResponseWriter, r *http.Request, p *ResetPasswordPayload) {
+		app.proxyAuthService(w, r, "POST", "/password/reset", p, false)
+	}))
+}
+
+type RegisterPayload struct { // 定义 RegisterPayload 结构体，用于注册的载荷
+	Email     string `json:"email" required:"true"`    // 邮箱
+	FirstName string `json:"first_name,omitempty"`     // 名字
+	LastName  string `json:"last_name,omitempty"`      // 姓氏
+	Password  string `json:"password" required:"true"` // 密码
+}
+
+type ForgotPasswordPayload struct { // 定义 ForgotPasswordPayload 结构体，用于忘记密码的载荷
+	Email string `json:"email" required:"true"` // 邮箱
+}
+
+type ResetPasswordPayload struct { // 定义 ResetPasswordPayload 结构体，用于使用邮件中的令牌重置密码的载荷
+	Token    string `json:"token" required:"true"`    // 重置密码邮件中的令牌
+	Password string `json:"password" required:"true"` // 新的密码
+}
+
+// VerifyEmail 处理验证邮件中的链接 GET /verify?token=...，转发给认证服务启用用户。
+// 验证令牌只能使用一次，因此不重试
+func (app *Config) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	q := url.Values{}
+	q.Set("token", r.URL.Query().Get("token"))
+	app.proxyAuthService(w, r, "GET", "/verify?"+q.Encode(), nil, false)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"broker/config"
+	"broker/resilience"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// refresh 和 logout 动作：使用刷新令牌刷新或吊销认证服务签发的令牌
+func init() {
+	actions.Register(newAction("refresh", nil, func(app *Config, w http.ResponseWriter, r *http.Request, p *RefreshPayload) {
+		app.proxyAuthService(w, r, "POST", "/refresh", p, false)
+	}))
+	actions.Register(newAction("logout", nil, func(app *Config, w http.ResponseWriter, r *http.Request, p *RefreshPayload) {
+		app.proxyAuthService(w, r, "POST", "/logout", p, true)
+	}))
+}
+
+type RefreshPayload struct { // 定义 RefreshPayload 结构体，用于刷新和注销的载荷
+	RefreshToken string `json:"refresh_token" required:"true"` // 刷新令牌
+	All          bool   `json:"all,omitempty"`                 // 注销时吊销该用户所有的刷新令牌
+}
+
+// 调用认证服务的 path 并把它的响应原样返回给调用方，调用方的 Authorization 请求头会一起转发。
+// 刷新令牌只能使用一次，因此只有 idempotent 为 true 的调用才会重试
+func (app *Config) proxyAuthService(w http.ResponseWriter, r *http.Request, method, path string, body any, idempotent bool) {
+	var jsonData []byte
+	if body != nil {
+		var err error
+		if jsonData, err = json.Marshal(body); err != nil {
+			app.errorJson(w, err)
+			return
+		}
+	}
+
+	var (
+		status          int
+		jsonFromService jsonResponse
+	)
+	err := app.call(r.Context(), config.ServiceAuth, idempotent, func(ctx context.Context) error {
+		url, err := app.serviceURL(config.ServiceAuth, path)
+		if err != nil {
+			return resilience.Permanent(err)
+		}
+
+		var requestBody io.Reader
+		if jsonData != nil {
+			requestBody = bytes.NewReader(jsonData)
+		}
+		request, err := http.NewRequestWithContext(ctx, method, url, requestBody)
+		if err != nil {
+			return resilience.Permanent(err)
+		}
+		request.Header.Set("Content-Type", "application/json")
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			request.Header.Set("Authorization", auth)
+		}
+
+		response, err := app.HTTPClient.Do(request)
+		if err != nil {
+			return err
+		}
+		defer drainAndClose(response.Body)
+
+		if response.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("auth service returned status %d", response.StatusCode)
+		}
+
+		// 4xx 是调用方的错误，不计入熔断器的失败，原样返回
+		status = response.StatusCode
+		jsonFromService = jsonResponse{}
+		if err := json.NewDecoder(response.Body).Decode(&jsonFromService); err != nil {
+			return resilience.Permanent(fmt.Errorf("invalid response from auth service: %w", err))
+		}
+		return nil
+	})
+	if err != nil {
+		app.dependencyError(w, err)
+		return
+	}
+
+	app.writeJson(w, status, jsonFromService)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// 用户管理动作：调用认证服务的 /users 接口，只允许管理员调用。
+// 调用方的访问令牌会转发给认证服务，认证服务会再次检查调用方是否为管理员
+func init() {
+	admin := requireRoles(roleAdmin)
+
+	actions.Register(newAction("list_users", nil, func(app *Config, w http.ResponseWriter, r *http.Request, p *ListUsersPayload) {
+		q := url.Values{}
+		if p.Search != "" {
+			q.Set("search", p.Search)
+		}
+		if p.Page > 0 {
+			q.Set("page", strconv.Itoa(p.Page))
+		}
+		if p.PageSize > 0 {
+			q.Set("page_size", strconv.Itoa(p.PageSize))
+		}
+		path := "/users"
+		if len(q) > 0 {
+			path += "?" + q.Encode()
+		}
+		app.proxyAuthService(w, r, "GET", path, nil, true)
+	}, admin))
+
+	actions.Register(newAction("get_user", nil, func(app *Config, w http.ResponseWriter, r *http.Request, p *UserIDPayload) {
+		app.proxyAuthService(w, r, "GET", userPath(p.ID, ""), nil, true)
+	}, admin))
+
+	actions.Register(newAction("create_user", nil, func(app *Config, w http.ResponseWriter, r *http.Request, p *CreateUserPayload) {
+		app.proxyAuthService(w, r, "POST", "/users", p, false)
+	}, admin))
+
+	actions.Register(newAction("update_user", nil, func(app *Config, w http.ResponseWriter, r *http.Request, p *UpdateUserPayload) {
+		app.proxyAuthService(w, r, "PUT", userPath(p.ID, ""), p, true)
+	}, admin))
+
+	actions.Register(newAction("set_user_active", nil, func(app *Config, w http.ResponseWriter, r *http.Request, p *SetUserActivePayload) {
+		app.proxyAuthService(w, r, "PUT", userPath(p.ID, "/active"), p, true)
+	}, admin))
+
+	actions.Register(newAction("delete_user", nil, func(app *Config, w http.ResponseWriter, r *http.Request, p *UserIDPayload) {
+		app.proxyAuthService(w, r, "DELETE", userPath(p.ID, ""), nil, true)
+	}, admin))
+
+	actions.Register(newAction("reset_user_password", nil, func(app *Config, w http.ResponseWriter, r *http.Request, p *ResetUserPasswordPayload) {
+		app.proxyAuthService(w, r, "PUT", userPath(p.ID, "/password"), p, true)
+	}, admin))
+}
+
+// 用户在认证服务中的路径
+func userPath(id int, suffix string) string {
+	return fmt.Sprintf("/users/%d%s", id, suffix)
+}
+
+type ListUsersPayload struct { // 定义 ListUsersPayload 结构体，用于搜索用户的载荷
+	Search   string `json:"search,omitempty"`    // 按邮箱或姓名模糊搜索
+	Page     int    `json:"page,omitempty"`      // 页码，从 1 开始
+	PageSize int    `json:"page_size,omitempty"` // 每页的用户数
+}
+
+type UserIDPayload struct { // 定义 UserIDPayload 结构体，用于查询和删除用户的载荷
+	ID int `json:"id" required:"true"` // 用户 ID
+}
+
+type CreateUserPayload struct { // 定义 CreateUserPayload 结构体，用于创建用户的载荷
+	Email     string `json:"email" required:"true"`    // 邮箱
+	FirstName string `json:"first_name,omitempty"`     // 名字
+	LastName  string `json:"last_name,omitempty"`      // 姓氏
+	Password  string `json:"password" required:"true"` // 密码
+	Role      string `json:"role,omitempty"`           // 角色：user 或 admin，为空时为 user
+	Active    *bool  `json:"active,omitempty"`         // 是否启用，为空时启用
+}
+
+type UpdateUserPayload struct { // 定义 UpdateUserPayload 结构体，用于修改用户的载荷
+	ID        int    `json:"id" required:"true"`    // 用户 ID
+	Email     string `json:"email" required:"true"` // 邮箱
+	FirstName string `json:"first_name,omitempty"`  // 名字
+	LastName  string `json:"last_name,omitempty"`   // 姓氏
+	Role      string `json:"role,omitempty"`        // 角色，为空时保持不变
+}
+
+type SetUserActivePayload struct { // 定义 SetUserActivePayload 结构体，用于启用或停用用户的载荷
+	ID     int  `json:"id" required:"true"` // 用户 ID
+	Active bool `json:"active"`             // 是否启用
+}
+
+type ResetUserPasswordPayload struct { // 定义 ResetUserPasswordPayload 结构体，用于重置用户密码的载荷
+	ID       int    `json:"id" required:"true"`       // 用户 ID
+	Password string `json:"password" required:"true"` // 新的密码
+}
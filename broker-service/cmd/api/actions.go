@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/**
+该代码定义了 /handle 接口使用的动作注册表。
+每个动作实现 ActionHandler 接口：声明自己的名称和载荷结构，负责从 json.RawMessage 解码载荷、校验载荷并分发到下游服务。
+动作在各自的文件（action_*.go）中通过 init 函数调用 actions.Register 注册，新增动作时只需要新增一个文件。
+newAction 是一个泛型辅助函数，根据载荷类型自动完成解码、必填字段校验以及载荷结构的描述；
+通过 requireAuth、requireRoles 选项声明动作的访问策略（见 identity.go），不指定时允许匿名调用。
+ListActions 处理 GET /actions 请求，返回所有已注册的动作及其载荷结构和访问策略。
+*/
+
+var errUnknownAction = errors.New("unknown action")
+
+// ActionHandler 是 /handle 接口中一个动作的处理器
+type ActionHandler interface {
+	Name() string                            // 动作名称，对应请求中的 action 字段
+	Schema() []SchemaField                   // 载荷结构
+	Decode(raw json.RawMessage) (any, error) // 解码载荷
+	Validate(payload any) error              // 校验载荷
+	Policy() Policy                          // 访问策略
+	Dispatch(app *Config, w http.ResponseWriter, r *http.Request, payload any)
+}
+
+// SchemaField 描述载荷中的一个字段
+type SchemaField struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Required bool   `json:"required"`
+}
+
+// ActionRegistry 保存所有已注册的动作
+type ActionRegistry struct {
+	mu       sync.RWMutex
+	handlers map[string]ActionHandler
+}
+
+// NewActionRegistry 创建一个空的动作注册表
+func NewActionRegistry() *ActionRegistry {
+	return &ActionRegistry{handlers: make(map[string]ActionHandler)}
+}
+
+// actions 是 broker 使用的全局动作注册表
+var actions = NewActionRegistry()
+
+// Register 注册一个动作，重复注册同名动作会 panic
+func (r *ActionRegistry) Register(h ActionHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.handlers[h.Name()]; exists {
+		panic(fmt.Sprintf("action %q already registered", h.Name()))
+	}
+	r.handlers[h.Name()] = h
+}
+
+// Lookup 根据名称查找动作
+func (r *ActionRegistry) Lookup(name string) (ActionHandler, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	h, ok := r.handlers[name]
+	return h, ok
+}
+
+// List 返回按名称排序的所有动作
+func (r *ActionRegistry) List() []ActionHandler {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]ActionHandler, 0, len(r.handlers))
+	for _, h := range r.handlers {
+		list = append(list, h)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+// action 是 ActionHandler 的泛型实现，T 为载荷类型
+type action[T any] struct {
+	name     string
+	policy   Policy
+	validate func(*T) error
+	dispatch func(app *Config, w http.ResponseWriter, r *http.Request, payload *T)
+}
+
+// newAction 创建一个动作。载荷字段上的 `required:"true"` 标签表示必填，validate 可以为 nil
+func newAction[T any](name string, validate func(*T) error, dispatch func(app *Config, w http.ResponseWriter, r *http.Request, payload *T), opts ...ActionOption) ActionHandler {
+	a := &action[T]{
+		name:     name,
+		validate: validate,
+		dispatch: dispatch,
+	}
+	for _, opt := range opts {
+		opt(&a.policy)
+	}
+	return a
+}
+
+func (a *action[T]) Name() string {
+	return a.name
+}
+
+func (a *action[T]) Policy() Policy {
+	return a.policy
+}
+
+func (a *action[T]) Schema() []SchemaField {
+	return schemaOf(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+func (a *action[T]) Decode(raw json.RawMessage) (any, error) {
+	payload := new(T)
+	if len(raw) == 0 {
+		return payload, nil
+	}
+
+	if err := json.Unmarshal(raw, payload); err != nil {
+		return nil, fmt.Errorf("invalid %s payload: %w", a.name, err)
+	}
+	return payload, nil
+}
+
+func (a *action[T]) Validate(payload any) error {
+	p, ok := payload.(*T)
+	if !ok {
+		return fmt.Errorf("invalid %s payload type %T", a.name, payload)
+	}
+
+	if err := checkRequired(reflect.ValueOf(p).Elem()); err != nil {
+		return err
+	}
+	if a.validate != nil {
+		return a.validate(p)
+	}
+	return nil
+}
+
+func (a *action[T]) Dispatch(app *Config, w http.ResponseWriter, r *http.Request, payload any) {
+	a.dispatch(app, w, r, payload.(*T))
+}
+
+// 返回字段在 JSON 中的名称，忽略的字段返回空字符串
+func jsonName(f reflect.StructField) string {
+	tag := f.Tag.Get("json")
+	if tag == "-" || !f.IsExported() {
+		return ""
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name
+	}
+	return f.Name
+}
+
+// 根据载荷类型生成字段描述
+func schemaOf(t reflect.Type) []SchemaField {
+	var fields []SchemaField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := jsonName(f)
+		if name == "" {
+			continue
+		}
+
+		fields = append(fields, SchemaField{
+			Name:     name,
+			Type:     jsonType(f.Type),
+			Required: f.Tag.Get("required") == "true",
+		})
+	}
+	return fields
+}
+
+// 返回 Go 类型对应的 JSON 类型名称
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Pointer:
+		return jsonType(t.Elem())
+	default:
+		return "object"
+	}
+}
+
+// 检查带有 `required:"true"` 标签的字段是否为零值
+func checkRequired(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("required") != "true" {
+			continue
+		}
+		if v.Field(i).IsZero() {
+			return fmt.Errorf("%s is required", jsonName(f))
+		}
+	}
+	return nil
+}
+
+// ListActions 返回所有已注册的动作及其载荷结构
+func (app *Config) ListActions(w http.ResponseWriter, r *http.Request) {
+	type actionInfo struct {
+		Name   string        `json:"name"`
+		Schema []SchemaField `json:"schema"`
+		Policy Policy        `json:"policy"`
+	}
+
+	var list []actionInfo
+	for _, h := range actions.List() {
+		list = append(list, actionInfo{Name: h.Name(), Schema: h.Schema(), Policy: h.Policy()})
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("%d actions registered", len(list)),
+		Data:    list,
+	}
+
+	app.writeJson(w, http.StatusOK, payload)
+}
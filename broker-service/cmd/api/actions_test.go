@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testPayload 覆盖必填字段和各种 JSON 类型
+type testPayload struct {
+	Name    string   `json:"name" required:"true"`
+	Count   int      `json:"count,omitempty"`
+	Tags    []string `json:"tags" required:"true"`
+	Enabled *bool    `json:"enabled"`
+	Ignored string   `json:"-"`
+	hidden  string
+}
+
+func TestActionValidate(t *testing.T) {
+	errTooMany := errors.New("count must be at most 10")
+	h := newAction("test", func(p *testPayload) error {
+		if p.Count > 10 {
+			return errTooMany
+		}
+		return nil
+	}, nil)
+
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr string
+	}{
+		{"valid", `{"name":"a","tags":["x"]}`, ""},
+		{"missing payload", ``, "name is required"},
+		{"missing required string", `{"tags":["x"]}`, "name is required"},
+		{"empty required string", `{"name":"","tags":["x"]}`, "name is required"},
+		{"missing required slice", `{"name":"a"}`, "tags is required"},
+		{"custom validation", `{"name":"a","tags":["x"],"count":11}`, errTooMany.Error()},
+		{"malformed payload", `{"name":1}`, "invalid test payload"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := h.Decode(json.RawMessage(tt.raw))
+			if err == nil {
+				err = h.Validate(payload)
+			}
+
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestActionSchema(t *testing.T) {
+	h := newAction[testPayload]("test", nil, nil, requireRoles(roleAdmin))
+
+	want := []SchemaField{
+		{Name: "name", Type: "string", Required: true},
+		{Name: "count", Type: "number"},
+		{Name: "tags", Type: "array", Required: true},
+		{Name: "enabled", Type: "boolean"},
+	}
+	if got := h.Schema(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Schema = %+v, want %+v", got, want)
+	}
+	if p := h.Policy(); !p.Authenticated || !reflect.DeepEqual(p.Roles, []string{roleAdmin}) {
+		t.Errorf("Policy = %+v", p)
+	}
+}
+
+func TestActionRegistry(t *testing.T) {
+	r := NewActionRegistry()
+	r.Register(newAction[testPayload]("b", nil, nil))
+	r.Register(newAction[testPayload]("a", nil, nil))
+
+	var names []string
+	for _, h := range r.List() {
+		names = append(names, h.Name())
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("List = %v, want %v", names, want)
+	}
+	if _, ok := r.Lookup("missing"); ok {
+		t.Error("Lookup(missing) should fail")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a duplicate action should panic")
+		}
+	}()
+	r.Register(newAction[testPayload]("a", nil, nil))
+}
+
+func TestHandleSubmissionRejectsBadRequests(t *testing.T) {
+	app := &Config{}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantMsg    string
+	}{
+		{"missing action", `{"log":{}}`, http.StatusBadRequest, "action is required"},
+		{"unknown action", `{"action":"nope"}`, http.StatusBadRequest, errUnknownAction.Error()},
+		{"policy is checked before the payload", `{"action":"mail","mail":{"to":"a@example.com"}}`, http.StatusUnauthorized, ""},
+		{"required field on a public action", `{"action":"register","register":{"email":"a@example.com"}}`, http.StatusBadRequest, "password is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/handle", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			app.HandleSubmission(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var resp jsonResponse
+			_ = json.NewDecoder(w.Body).Decode(&resp)
+			if !resp.Error || !strings.Contains(resp.Message, tt.wantMsg) {
+				t.Errorf("response = %+v, want an error containing %q", resp, tt.wantMsg)
+			}
+		})
+	}
+}
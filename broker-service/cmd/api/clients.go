@@ -0,0 +1,239 @@
+package main
+
+import (
+	"broker/config"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/rpc"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+)
+
+/**
+该代码定义了 broker 访问下游服务时使用的长连接客户端。
+newHTTPClient 创建一个共享的 http.Client，复用底层的 TCP 连接，并设置了超时时间。
+RPCPool 是一个 net/rpc 客户端连接池，Call 方法从池中取出连接发起调用，调用结束后归还连接；
+如果连接已经断开，则丢弃该连接并透明地重新拨号。新连接会轮询配置中的各个 logger-service 实例。
+gRPC 连接使用 round_robin 负载均衡策略，在配置的所有实例之间分发请求。
+setupClients 在启动时创建所有客户端，closeClients 在退出时关闭它们。
+*/
+
+const (
+	rpcPoolSize     = 10               // RPC 连接池中最多保留的空闲连接数
+	httpTimeout     = 30 * time.Second // HTTP 请求的整体超时上限，单次调用的超时时间由配置控制
+	dialTimeout     = 5 * time.Second  // 建立 TCP 连接的超时时间
+	idleConnTimeout = 90 * time.Second // 空闲连接的存活时间
+)
+
+// 创建共享的 HTTP 客户端
+func newHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 20
+	transport.IdleConnTimeout = idleConnTimeout
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   httpTimeout,
+	}
+}
+
+// 读完并关闭响应体，使底层连接可以被复用
+func drainAndClose(body io.ReadCloser) {
+	_, _ = io.Copy(io.Discard, body)
+	_ = body.Close()
+}
+
+var errPoolClosed = errors.New("rpc pool is closed")
+
+// RPCPool 是一个并发安全的 net/rpc 客户端连接池
+type RPCPool struct {
+	dial    func() (*rpc.Client, error)
+	clients chan *rpc.Client
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewRPCPool 创建一个连接池，连接在第一次使用时才会建立，每次新建连接时调用 next 获取服务地址
+func NewRPCPool(next func() (string, error), size int) *RPCPool {
+	return &RPCPool{
+		dial: func() (*rpc.Client, error) {
+			addr, err := next()
+			if err != nil {
+				return nil, err
+			}
+
+			conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+			if err != nil {
+				return nil, err
+			}
+			return rpc.NewClient(conn), nil
+		},
+		clients: make(chan *rpc.Client, size),
+	}
+}
+
+// 从池中取出一个连接，池为空时新建一个
+func (p *RPCPool) get() (*rpc.Client, error) {
+	p.mu.RLock()
+	closed := p.closed
+	p.mu.RUnlock()
+	if closed {
+		return nil, errPoolClosed
+	}
+
+	select {
+	case c, ok := <-p.clients:
+		if !ok {
+			return nil, errPoolClosed
+		}
+		return c, nil
+	default:
+		return p.dial()
+	}
+}
+
+// 把连接归还到池中，池已满或已关闭时直接关闭连接
+func (p *RPCPool) put(c *rpc.Client) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		_ = c.Close()
+		return
+	}
+
+	select {
+	case p.clients <- c:
+	default:
+		_ = c.Close()
+	}
+}
+
+// Call 使用池中的连接发起一次 RPC 调用
+func (p *RPCPool) Call(ctx context.Context, serviceMethod string, args any, reply any) error {
+	// 池中的每个空闲连接最多尝试一次，再加上一次新建连接
+	for attempt := 0; attempt <= cap(p.clients); attempt++ {
+		c, err := p.get()
+		if err != nil {
+			return err
+		}
+
+		var call *rpc.Call
+		select {
+		case call = <-c.Go(serviceMethod, args, reply, make(chan *rpc.Call, 1)).Done:
+		case <-ctx.Done():
+			// 无法取消正在进行的调用，只能关闭这个连接
+			_ = c.Close()
+			return ctx.Err()
+		}
+
+		switch err := call.Error; {
+		case err == nil:
+			p.put(c)
+			return nil
+		case errors.Is(err, rpc.ErrShutdown):
+			// 连接在请求发出前就已断开，请求没有到达服务端，可以安全地换一个连接重试
+			_ = c.Close()
+			log.Println("rpc connection lost, reconnecting")
+			continue
+		default:
+			var serverErr rpc.ServerError
+			if errors.As(err, &serverErr) {
+				// 服务端返回的业务错误，连接依然可用
+				p.put(c)
+			} else {
+				_ = c.Close()
+			}
+			return err
+		}
+	}
+	return rpc.ErrShutdown
+}
+
+// Close 关闭连接池中的所有连接
+func (p *RPCPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	close(p.clients)
+
+	for c := range p.clients {
+		_ = c.Close()
+	}
+	return nil
+}
+
+// 在启动时创建所有下游服务的客户端
+func (app *Config) setupClients() error {
+	app.HTTPClient = newHTTPClient()
+	app.RPCPool = NewRPCPool(func() (string, error) {
+		return app.Services.Next(config.ServiceLoggerRPC)
+	}, rpcPoolSize)
+
+	// 把配置中的所有 gRPC 实例交给 gRPC 内置的 round_robin 负载均衡
+	var addrs []resolver.Address
+	for _, addr := range app.Services.Instances(config.ServiceLoggerGRPC) {
+		addrs = append(addrs, resolver.Address{Addr: addr})
+	}
+	r := manual.NewBuilderWithScheme("broker")
+	r.InitialState(resolver.State{Addresses: addrs})
+
+	// grpc.Dial 不会阻塞，连接断开后 gRPC 会自动重连
+	conn, err := grpc.Dial(
+		r.Scheme()+":///"+config.ServiceLoggerGRPC,
+		grpc.WithResolvers(r),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"round_robin":{}}]}`),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		return err
+	}
+	app.GRPCConn = conn
+
+	return nil
+}
+
+// 返回逻辑服务下一个实例上 path 对应的 URL
+func (app *Config) serviceURL(service, path string) (string, error) {
+	base, err := app.Services.Next(service)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(base, "/") + path, nil
+}
+
+// 在退出时关闭所有下游服务的客户端
+func (app *Config) closeClients() {
+	if app.RPCPool != nil {
+		_ = app.RPCPool.Close()
+	}
+	if app.GRPCConn != nil {
+		_ = app.GRPCConn.Close()
+	}
+	if app.HTTPClient != nil {
+		app.HTTPClient.CloseIdleConnections()
+	}
+	if app.Emitter != nil {
+		app.Emitter.Close()
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"broker/config"
+	"broker/resilience"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+/**
+该代码为每个下游服务维护一个熔断器、单次调用的超时时间和重试策略。
+call 方法在熔断器的保护下调用下游服务：每次调用都有独立的超时时间，幂等调用失败后按带抖动的指数退避重试。
+调用方取消请求（例如客户端断开连接）或者调用方自己的截止时间已到导致的错误不是下游服务的问题，不计入熔断器的失败次数，也不重试；
+只有单次调用的超时时间到期才计为失败。
+dependencyError 把调用错误映射为合适的 HTTP 状态码。
+DependencyHealth 处理 GET /health/dependencies 请求，返回每个下游服务熔断器的状态。
+*/
+
+// dependency 是调用一个下游服务时使用的策略
+type dependency struct {
+	breaker *resilience.Breaker
+	timeout time.Duration
+	retry   resilience.RetryPolicy
+}
+
+// 根据配置为每个下游服务创建熔断器
+func newDependencies(cfg *config.Config) map[string]*dependency {
+	deps := make(map[string]*dependency, len(cfg.Services))
+	for name, svc := range cfg.Services {
+		deps[name] = &dependency{
+			breaker: resilience.NewBreaker(name, resilience.BreakerSettings{
+				FailureThreshold: svc.Breaker.FailureThreshold,
+				OpenTimeout:      time.Duration(svc.Breaker.OpenTimeout),
+				HalfOpenMaxCalls: svc.Breaker.HalfOpenMaxCalls,
+			}),
+			timeout: time.Duration(svc.Timeout),
+			retry: resilience.RetryPolicy{
+				MaxAttempts: svc.Retry.MaxAttempts,
+				BaseDelay:   time.Duration(svc.Retry.BaseDelay),
+				MaxDelay:    time.Duration(svc.Retry.MaxDelay),
+			},
+		}
+	}
+	return deps
+}
+
+// 在熔断器的保护下调用下游服务，只有 idempotent 为 true 的调用才会重试
+func (app *Config) call(ctx context.Context, service string, idempotent bool, fn func(ctx context.Context) error) error {
+	dep, ok := app.Dependencies[service]
+	if !ok {
+		return fmt.Errorf("unknown dependency %q", service)
+	}
+
+	attempt := func(ctx context.Context) error {
+		callCtx := ctx
+		if dep.timeout > 0 {
+			var cancel context.CancelFunc
+			callCtx, cancel = context.WithTimeout(ctx, dep.timeout)
+			defer cancel()
+		}
+		return dep.breaker.Execute(func() error {
+			err := fn(callCtx)
+			if err != nil && ctx.Err() != nil {
+				// 调用方已经取消或超时，不计为下游服务的失败
+				return resilience.Permanent(err)
+			}
+			return err
+		})
+	}
+
+	if !idempotent {
+		return attempt(ctx)
+	}
+	return resilience.Retry(ctx, dep.retry, attempt)
+}
+
+// 把调用下游服务的错误写入响应，熔断和超时分别返回 503 和 504
+func (app *Config) dependencyError(w http.ResponseWriter, err error, status ...int) {
+	switch {
+	case errors.Is(err, resilience.ErrOpen):
+		app.errorJson(w, err, http.StatusServiceUnavailable)
+	case errors.Is(err, context.DeadlineExceeded):
+		app.errorJson(w, err, http.StatusGatewayTimeout)
+	default:
+		app.errorJson(w, err, status...)
+	}
+}
+
+// DependencyHealth 返回每个下游服务熔断器的状态
+func (app *Config) DependencyHealth(w http.ResponseWriter, r *http.Request) {
+	statuses := make([]resilience.BreakerStatus, 0, len(app.Dependencies))
+	healthy := true
+	for _, dep := range app.Dependencies {
+		status := dep.breaker.Status()
+		if status.State != resilience.StateClosed.String() {
+			healthy = false
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "all dependencies healthy",
+		Data:    statuses,
+	}
+	if !healthy {
+		payload.Message = "some dependencies are degraded"
+	}
+
+	app.writeJson(w, http.StatusOK, payload)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"broker/config"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCallCountsOnlyDownstreamFailures(t *testing.T) {
+	errDown := errors.New("connection refused")
+	waitDone := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	tests := []struct {
+		name           string
+		timeout        time.Duration // 单次调用的超时时间
+		callerTimeout  time.Duration // 调用方的截止时间，为 0 时没有截止时间
+		callerCanceled bool
+		fn             func(ctx context.Context) error
+		wantState      string
+	}{
+		{name: "downstream error", timeout: time.Second, fn: func(context.Context) error { return errDown }, wantState: "open"},
+		{name: "per-call timeout", timeout: 10 * time.Millisecond, fn: waitDone, wantState: "open"},
+		{name: "caller canceled", timeout: time.Second, callerCanceled: true, fn: func(ctx context.Context) error { return ctx.Err() }, wantState: "closed"},
+		{name: "caller deadline", timeout: time.Second, callerTimeout: 10 * time.Millisecond, fn: waitDone, wantState: "closed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Services: map[string]config.Service{
+				config.ServiceAuth: {
+					Timeout: config.Duration(tt.timeout),
+					Breaker: config.Breaker{FailureThreshold: 1, OpenTimeout: config.Duration(time.Minute)},
+					Retry:   config.Retry{MaxAttempts: 3},
+				},
+			}}
+			app := &Config{Dependencies: newDependencies(cfg)}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.callerTimeout > 0 {
+				ctx, cancel = context.WithTimeout(ctx, tt.callerTimeout)
+				defer cancel()
+			}
+			if tt.callerCanceled {
+				cancel()
+			}
+
+			if err := app.call(ctx, config.ServiceAuth, true, tt.fn); err == nil {
+				t.Fatal("call should fail")
+			}
+			if state := app.Dependencies[config.ServiceAuth].breaker.Status().State; state != tt.wantState {
+				t.Errorf("breaker state = %s, want %s", state, tt.wantState)
+			}
+		})
+	}
+}
@@ -1,41 +1,34 @@
 package main
 
 import (
-	"broker/event" // 导入自定义的 event 包
-	"broker/logs"
-	"bytes" // 导入 bytes 包用于操作字节
-	"context"
+	"broker/config"
 	"encoding/json" // 导入 json 包用于 JSON 编码和解码
 	"errors"        // 导入 errors 包用于错误处理
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
-	"net/http" // 导入 net/http 包用于处理 HTTP 请求和响应
-	"net/rpc"
-	"time"
+	"net/http"      // 导入 net/http 包用于处理 HTTP 请求和响应
 )
 
-type RequestPayload struct { // 定义 RequestPayload 结构体，用于请求的载荷
-	Action string      `json:"action"`         // 动作字段
-	Auth   AuthPayload `json:"auth,omitempty"` // 认证字段，如果为空则省略
-	Log    LogPayload  `json:"log,omitempty"`  // 日志字段，如果为空则省略
-	Mail   MailPayload `json:"mail,omitempty"` // 邮件字段，如果为空则省略
+// RequestPayload 是 /handle 接口的请求体，载荷位于与动作同名的字段中，例如 {"action":"auth","auth":{...}}
+type RequestPayload struct {
+	Action  string          // 动作名称
+	Payload json.RawMessage // 动作的载荷，由对应的 ActionHandler 解码
 }
 
-type MailPayload struct { // 定义 MailPayload 结构体，用于邮件的载荷
-	From    string `json:"from"`    // 发件人
-	To      string `json:"to"`      // 收件人
-	Subject string `json:"subject"` // 主题
-	Message string `json:"message"` // 内容
-}
-
-type AuthPayload struct { // 定义 AuthPayload 结构体，用于认证的载荷
-	Email    string `json:"email"`    // 邮箱
-	Password string `json:"password"` // 密码
-}
+// UnmarshalJSON 取出 action 字段，并把与动作同名的字段作为载荷
+func (p *RequestPayload) UnmarshalJSON(b []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
 
-type LogPayload struct { // 定义 LogPayload 结构体，用于日志的载荷
-	Name string `json:"name"` // 日志名称
-	Data string `json:"data"` // 日志数据
+	raw, ok := fields["action"]
+	if !ok {
+		return errors.New("action is required")
+	}
+	if err := json.Unmarshal(raw, &p.Action); err != nil {
+		return errors.New("action must be a string")
+	}
+	p.Payload = fields[p.Action]
+	return nil
 }
 
 func (app *Config) Broker(w http.ResponseWriter, r *http.Request) {
@@ -57,233 +50,59 @@ func (app *Config) HandleSubmission(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	switch requestPayload.Action {
-	case "auth":
-		app.authenticate(w, requestPayload.Auth) // 调用 authenticate 方法进行认证
-	case "log":
-		app.logItemViaRPC(w, requestPayload.Log) // 调用 logItemViaRPC 方法发送日志事件
-	case "mail":
-		app.sendMail(w, requestPayload.Mail) // 调用 sendMail 方法发送邮件
-	default:
-		app.errorJson(w, errors.New("unknown action")) // 如果动作不匹配，则返回未知动作的错误
-	}
-}
-
-func (app *Config) sendMail(w http.ResponseWriter, msg MailPayload) {
-	jsonData, _ := json.MarshalIndent(msg, "", "\t") // 将邮件载荷 msg 转换为 JSON 格式的字节数据
-
-	// 调用邮件服务
-	mailServiceUrl := "http://mailer-service/send"
-
-	// 发送 POST 请求到邮件服务
-	request, err := http.NewRequest("POST", mailServiceUrl, bytes.NewBuffer(jsonData))
-	if err != nil {
-		app.errorJson(w, err)
+	handler, ok := actions.Lookup(requestPayload.Action)
+	if !ok {
+		app.errorJson(w, errUnknownAction) // 如果动作未注册，则返回未知动作的错误
 		return
 	}
-	request.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	response, err := client.Do(request) // 发送 HTTP 请求
-	if err != nil {
-		app.errorJson(w, err)
-		return
-	}
-	defer response.Body.Close()
-
-	// 确保返回的状态码正确
-	if response.StatusCode != http.StatusAccepted {
-		app.errorJson(w, errors.New("error calling mail service")) // 如果状态码不是 202 Accepted，则返回调用邮件服务时的错误
-		return
-	}
-
-	// 发送 JSON 响应
-	var payload jsonResponse
-	payload.Error = false
-	payload.Message = "Message send to " + msg.To
-
-	app.writeJson(w, http.StatusAccepted, payload) // 调用 writeJson 方法将 payload 写入响应
-}
-
-func (app *Config) logItem(w http.ResponseWriter, entry LogPayload) {
-	jsonData, _ := json.MarshalIndent(entry, "", "\t") // 将日志载荷 entry 转换为 JSON 格式的字节数据
 
-	logServiceUrl := "http://logger-service/log"
-
-	request, err := http.NewRequest("POST", logServiceUrl, bytes.NewBuffer(jsonData)) // 创建 POST 请求
-	if err != nil {
-		app.errorJson(w, err)
+	if err = authorize(r.Context(), handler.Policy()); err != nil { // 检查调用方是否有权调用该动作
+		app.authorizationError(w, err)
 		return
 	}
 
-	request.Header.Set("Content-Type", "application/json")
-
-	client := http.Client{}
-
-	response, err := client.Do(request) // 发送 HTTP 请求
+	payload, err := handler.Decode(requestPayload.Payload) // 解码动作的载荷
 	if err != nil {
 		app.errorJson(w, err)
 		return
 	}
-	defer response.Body.Close()
 
-	if response.StatusCode != http.StatusAccepted {
+	if err = handler.Validate(payload); err != nil { // 校验动作的载荷
 		app.errorJson(w, err)
 		return
 	}
 
-	var payload jsonResponse
-	payload.Error = false
-	payload.Message = "logged"
-
-	app.writeJson(w, http.StatusAccepted, payload) // 调用 writeJson 方法将 payload 写入响应
+	handler.Dispatch(app, w, r, payload) // 分发到对应的下游服务
 }
 
-func (app *Config) authenticate(w http.ResponseWriter, a AuthPayload) {
-	jsonData, _ := json.MarshalIndent(a, "", "\t") // 将认证载荷 a 转换为 JSON 格式的字节数据
-
-	request, err := http.NewRequest("POST", "http://authentication-service/authenticate", bytes.NewBuffer(jsonData)) // 创建 POST 请求
-	if err != nil {
-		app.errorJson(w, err)
-		return
-	}
-
-	client := &http.Client{}
-	response, err := client.Do(request) // 发送 HTTP 请求
-	if err != nil {
-		app.errorJson(w, err)
-		return
-	}
-
-	defer response.Body.Close()
-	// 确保返回的状态码正确
-	if response.StatusCode == http.StatusUnauthorized {
-		app.errorJson(w, errors.New("invalid credentials")) // 如果状态码是 401 Unauthorized，则返回无效凭据的错误
-		return
-	} else if response.StatusCode != http.StatusAccepted {
-		app.errorJson(w, errors.New("error calling auth service")) // 如果状态码不是 202 Accepted，则返回调用认证服务时的错误
-		return
-	}
-
-	var jsonFromService jsonResponse
-
-	err = json.NewDecoder(response.Body).Decode(&jsonFromService) // 从响应中解码 JSON 数据到 jsonFromService
-	if err != nil {
-		app.errorJson(w, err)
-		return
-	}
-
-	if jsonFromService.Error {
-		app.errorJson(w, err, http.StatusUnauthorized)
-		return
-	}
-
-	var payload jsonResponse
-	payload.Error = false
-	payload.Message = "Authenticated!"
-	payload.Data = jsonFromService.Data
-
-	app.writeJson(w, http.StatusAccepted, payload) // 调用 writeJson 方法将 payload 写入响应
-}
-
-func (app *Config) logEventViaRabbit(w http.ResponseWriter, l LogPayload) {
-	err := app.pushToQueue(l.Name, l.Data) // 将日志事件推送到队列中
-	if err != nil {
-		app.errorJson(w, err)
-		return
-	}
-
-	var payload jsonResponse
-	payload.Error = false
-	payload.Message = "logged via RabbitMQ"
-
-	app.writeJson(w, http.StatusAccepted, payload) // 调用 writeJson 方法将 payload 写入响应
-}
-
-func (app *Config) pushToQueue(name, msg string) error {
-	emitter, err := event.NewEventEmitter(app.Rabbit) // 创建事件发射器
-	if err != nil {
-		return err
-	}
-
-	payload := LogPayload{
-		Name: name,
-		Data: msg,
-	}
-
-	j, _ := json.MarshalIndent(&payload, "", "\t") // 将载荷转换为 JSON 格式的字节数据
-	err = emitter.Push(string(j), "log.INFO")      // 将数据推送到队列中
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-type RPCPayload struct {
-	Name string
-	Data string
-}
-
-func (app *Config) logItemViaRPC(w http.ResponseWriter, l LogPayload) {
-	client, err := rpc.Dial("tcp", "logger-service:5001")
-	if err != nil {
-		app.errorJson(w, err)
-		return
-	}
-
-	rpcPayload := RPCPayload{
-		Name: l.Name,
-		Data: l.Data,
+// LogViaGRPC 通过 gRPC 写日志。请求体为 {"log":{...}}，或者批量模式 {"logs":[{...},...]}，批量模式通过 WriteLogs 流一次写入所有日志
+func (app *Config) LogViaGRPC(w http.ResponseWriter, r *http.Request) {
+	var requestPayload struct {
+		Log  LogPayload   `json:"log"`
+		Logs []LogPayload `json:"logs"`
 	}
 
-	var result string
-	err = client.Call("RPCServer.LogInfo", rpcPayload, &result)
+	err := app.readJson(w, r, &requestPayload)
 	if err != nil {
 		app.errorJson(w, err)
 		return
 	}
 
-	payload := jsonResponse{
-		Error:   false,
-		Message: result,
-	}
-
-	app.writeJson(w, http.StatusAccepted, payload)
-}
-
-func (app *Config) LogViaGRPC(w http.ResponseWriter, r *http.Request) {
-	var requestPayload RequestPayload
-
-	err := app.readJson(w, r, &requestPayload)
-	if err != nil {
-		app.errorJson(w, err)
+	if len(requestPayload.Logs) > 0 {
+		app.logBatchViaGRPC(w, r, requestPayload.Logs)
 		return
 	}
 
-	conn, err := grpc.Dial("logger-service:50001", grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
-	if err != nil {
-		app.errorJson(w, err)
+	if requestPayload.Log.Name == "" {
+		app.errorJson(w, errors.New("name is required"))
 		return
 	}
-	defer conn.Close()
-
-	c := logs.NewLogServiceClient(conn)
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
 
-	_, err = c.WriteLog(ctx, &logs.LogRequest{
-		LogEntry: &logs.Log{
-			Name: requestPayload.Log.Name,
-			Data: requestPayload.Log.Data,
-		}})
-	if err != nil {
+	// 该路由固定优先使用 gRPC，失败时仍会按配置回退到其他传输方式
+	requestPayload.Log.Transport = config.TransportGRPC
+	if err := validateLog(&requestPayload.Log); err != nil {
 		app.errorJson(w, err)
 		return
 	}
-
-	var payload jsonResponse
-	payload.Error = false
-	payload.Message = "logged"
-
-	app.writeJson(w, http.StatusAccepted, payload)
+	app.logItem(w, r, requestPayload.Log)
 }
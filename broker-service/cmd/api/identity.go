@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+/**
+该代码定义了 broker 的身份验证中间件和动作的访问策略。
+identify 中间件验证 Authorization: Bearer 请求头中由认证服务签发的访问令牌（签名、签发者、受众和有效期），
+用户在令牌签发之后吊销了会话（重置密码或被停用，见 revocations.go）时令牌同样无效。
+验证通过后把用户身份 Identity 放入请求的上下文，可以用 identityFrom 取出；没有令牌或令牌无效（例如已经过期）的请求都作为匿名请求继续处理，
+令牌无效的原因同样保存在上下文中，这样客户端即使带着过期的令牌也可以调用 refresh、register 等不需要登录的动作。
+每个动作通过 Policy 声明是否需要登录以及允许的角色，HandleSubmission 在分发之前调用 authorize 检查：
+未登录时返回 401（令牌无效时在错误信息和 WWW-Authenticate 中说明原因），角色不符时返回 403。不经过 /handle 的路由使用 requirePolicy 中间件声明策略。
+*/
+
+const roleAdmin = "admin" // 管理员角色，与认证服务一致
+
+var (
+	errUnauthenticated = errors.New("authentication required")
+	errForbidden       = errors.New("permission denied")
+	errInvalidToken    = errors.New("invalid access token")
+)
+
+// Identity 是访问令牌中的用户身份
+type Identity struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+}
+
+// 访问令牌中的声明，与认证服务签发的一致
+type tokenClaims struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+type identityKey struct{}
+
+type tokenErrorKey struct{}
+
+// 取出请求上下文中的用户身份，匿名请求返回 false
+func identityFrom(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok
+}
+
+// 取出请求中无法验证的访问令牌的错误，没有令牌或令牌有效时返回 nil
+func tokenErrorFrom(ctx context.Context) error {
+	err, _ := ctx.Value(tokenErrorKey{}).(error)
+	return err
+}
+
+// Policy 描述调用一个动作需要的身份
+type Policy struct {
+	Authenticated bool     `json:"authenticated"`   // 是否需要登录
+	Roles         []string `json:"roles,omitempty"` // 允许的角色，为空时允许任意角色
+}
+
+// ActionOption 修改动作的访问策略
+type ActionOption func(*Policy)
+
+// requireAuth 表示动作需要登录
+func requireAuth() ActionOption {
+	return func(p *Policy) {
+		p.Authenticated = true
+	}
+}
+
+// requireRoles 表示动作只允许这些角色的用户调用
+func requireRoles(roles ...string) ActionOption {
+	return func(p *Policy) {
+		p.Authenticated = true
+		p.Roles = append(p.Roles, roles...)
+	}
+}
+
+// 检查请求的身份是否满足策略
+func authorize(ctx context.Context, p Policy) error {
+	if !p.Authenticated {
+		return nil
+	}
+
+	id, ok := identityFrom(ctx)
+	if !ok {
+		if err := tokenErrorFrom(ctx); err != nil {
+			return err
+		}
+		return errUnauthenticated
+	}
+	if len(p.Roles) == 0 {
+		return nil
+	}
+	for _, role := range p.Roles {
+		if id.Role == role {
+			return nil
+		}
+	}
+	return errForbidden
+}
+
+// 返回授权失败的响应
+func (app *Config) authorizationError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errForbidden) {
+		app.errorJson(w, err, http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, errInvalidToken) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="broker", error="invalid_token"`)
+	} else {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="broker"`)
+	}
+	app.errorJson(w, err, http.StatusUnauthorized)
+}
+
+// 验证请求中的访问令牌，并把用户身份放入上下文；令牌无效时把原因放入上下文，由 authorize 决定是否拒绝
+func (app *Config) identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scheme, token, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			err := fmt.Errorf("%w: invalid authorization header", errInvalidToken)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenErrorKey{}, err)))
+			return
+		}
+
+		id, err := app.verifyToken(r.Context(), token)
+		if err != nil {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenErrorKey{}, err)))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, id)))
+	})
+}
+
+// 返回检查访问策略的中间件，用于不经过 /handle 的路由
+func (app *Config) requirePolicy(opts ...ActionOption) func(http.Handler) http.Handler {
+	var p Policy
+	for _, opt := range opts {
+		opt(&p)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := authorize(r.Context(), p); err != nil {
+				app.authorizationError(w, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// 验证访问令牌，返回其中的用户身份
+func (app *Config) verifyToken(ctx context.Context, tokenString string) (*Identity, error) {
+	var claims tokenClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, algorithm, err := app.JWKS.Lookup(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if algorithm != "" && token.Method.Alg() != algorithm {
+			return nil, fmt.Errorf("unexpected signing algorithm %q", token.Method.Alg())
+		}
+		return key, nil
+	},
+		jwt.WithValidMethods([]string{"EdDSA", "RS256"}),
+		jwt.WithIssuer(app.Auth.Issuer),
+		jwt.WithAudience(app.Auth.Audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidToken, err)
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid subject %q", errInvalidToken, claims.Subject)
+	}
+	if app.Revoked != nil {
+		var issuedAt time.Time
+		if claims.IssuedAt != nil {
+			issuedAt = claims.IssuedAt.Time
+		}
+		if app.Revoked.Revoked(userID, issuedAt) {
+			return nil, fmt.Errorf("%w: session has been revoked", errInvalidToken)
+		}
+	}
+	return &Identity{UserID: userID, Email: claims.Email, Role: claims.Role}, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuthorize(t *testing.T) {
+	user := &Identity{UserID: 1, Email: "user@example.com", Role: "user"}
+	admin := &Identity{UserID: 2, Email: "admin@example.com", Role: roleAdmin}
+	tokenErr := errors.Join(errInvalidToken, errors.New("token is expired"))
+
+	tests := []struct {
+		name     string
+		identity *Identity
+		tokenErr error
+		policy   []ActionOption
+		want     error
+	}{
+		{"public action, anonymous", nil, nil, nil, nil},
+		{"public action, invalid token", nil, tokenErr, nil, nil},
+		{"authenticated action, anonymous", nil, nil, []ActionOption{requireAuth()}, errUnauthenticated},
+		{"authenticated action, invalid token", nil, tokenErr, []ActionOption{requireAuth()}, errInvalidToken},
+		{"authenticated action, user", user, nil, []ActionOption{requireAuth()}, nil},
+		{"admin action, user", user, nil, []ActionOption{requireRoles(roleAdmin)}, errForbidden},
+		{"admin action, admin", admin, nil, []ActionOption{requireRoles(roleAdmin)}, nil},
+		{"admin action, anonymous", nil, nil, []ActionOption{requireRoles(roleAdmin)}, errUnauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.identity != nil {
+				ctx = context.WithValue(ctx, identityKey{}, tt.identity)
+			}
+			if tt.tokenErr != nil {
+				ctx = context.WithValue(ctx, tokenErrorKey{}, tt.tokenErr)
+			}
+			var p Policy
+			for _, opt := range tt.policy {
+				opt(&p)
+			}
+
+			err := authorize(ctx, p)
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("authorize = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdentifyInvalidToken(t *testing.T) {
+	app := &Config{}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		protected     bool
+		wantStatus    int
+		wantChallenge string
+	}{
+		{"public route without a token", "", false, http.StatusOK, ""},
+		{"public route with a malformed token", "Bearer not-a-jwt", false, http.StatusOK, ""},
+		{"public route with a bad header", "Basic abc", false, http.StatusOK, ""},
+		{"protected route without a token", "", true, http.StatusUnauthorized, `Bearer realm="broker"`},
+		{"protected route with a malformed token", "Bearer not-a-jwt", true, http.StatusUnauthorized, `error="invalid_token"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handler http.Handler = ok
+			if tt.protected {
+				handler = app.requirePolicy(requireAuth())(handler)
+			}
+			handler = app.identify(handler)
+
+			r := httptest.NewRequest("POST", "/", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if challenge := w.Header().Get("WWW-Authenticate"); !strings.Contains(challenge, tt.wantChallenge) {
+				t.Errorf("WWW-Authenticate = %q, want it to contain %q", challenge, tt.wantChallenge)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"broker/config"
+	"broker/resilience"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/**
+该代码定义了认证服务公钥的缓存 JWKSCache，用于在 broker 中验证访问令牌，而不需要为每个请求调用认证服务。
+公钥从认证服务的 JWKS 接口获取（经过 authentication 服务的熔断器，失败时重试），在 ttl 内直接使用缓存。
+缓存过期后继续使用已经缓存的公钥，同时在后台重新获取；遇到缓存中没有的 kid 时（认证服务刚轮换了密钥）等待重新获取的结果。
+获取在锁之外进行，同一时间最多只有一次获取，并发的请求共享它的结果；无论成功与否，距离上次尝试 jwksMinRefresh 之内都不会再次获取，
+避免认证服务不可用或伪造的 kid 导致大量请求。
+*/
+
+const jwksMinRefresh = 10 * time.Second // 两次获取公钥的最短间隔
+
+// JWKSCache 缓存认证服务发布的公钥
+type JWKSCache struct {
+	app  *Config
+	path string
+	ttl  time.Duration
+
+	mu          sync.Mutex
+	keys        map[string]jwksKey
+	fetchedAt   time.Time     // 最近一次获取成功的时间
+	attemptedAt time.Time     // 最近一次开始获取的时间，无论成功与否
+	inflight    chan struct{} // 进行中的获取，完成时关闭；没有进行中的获取时为 nil
+}
+
+// 一个公钥及其算法
+type jwksKey struct {
+	algorithm string
+	key       crypto.PublicKey
+}
+
+// NewJWKSCache 创建一个从认证服务的 path 获取公钥的缓存
+func NewJWKSCache(app *Config, cfg config.Auth) *JWKSCache {
+	return &JWKSCache{
+		app:  app,
+		path: cfg.JWKSPath,
+		ttl:  time.Duration(cfg.JWKSCacheTTL),
+	}
+}
+
+// Lookup 返回 kid 对应的公钥和算法
+func (c *JWKSCache) Lookup(ctx context.Context, kid string) (crypto.PublicKey, string, error) {
+	c.mu.Lock()
+	key, ok := c.keys[kid]
+	canRefresh := c.inflight != nil || time.Since(c.attemptedAt) > jwksMinRefresh
+	if ok {
+		// 缓存过期时在后台重新获取，当前请求继续使用缓存的公钥
+		if canRefresh && time.Since(c.fetchedAt) > c.ttl {
+			c.refreshLocked()
+		}
+		c.mu.Unlock()
+		return key.key, key.algorithm, nil
+	}
+	if !canRefresh {
+		c.mu.Unlock()
+		return nil, "", fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	// 可能是新轮换的密钥，等待重新获取的结果
+	done := c.refreshLocked()
+	c.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return nil, "", ctx.Err()
+	}
+
+	c.mu.Lock()
+	key, ok = c.keys[kid]
+	c.mu.Unlock()
+	if !ok {
+		return nil, "", fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key.key, key.algorithm, nil
+}
+
+// 在后台开始获取公钥并返回获取完成时关闭的通道，已经有进行中的获取时返回它的通道；调用方需要持有 c.mu
+func (c *JWKSCache) refreshLocked() <-chan struct{} {
+	if c.inflight != nil {
+		return c.inflight
+	}
+
+	done := make(chan struct{})
+	c.inflight = done
+	c.attemptedAt = time.Now()
+
+	go func() {
+		// 获取的结果由所有等待的请求共享，不使用某一个请求的 ctx
+		keys, err := c.fetch(context.Background())
+
+		c.mu.Lock()
+		if err != nil {
+			log.Println("Error fetching signing keys from auth service:", err)
+		} else {
+			c.keys = keys
+			c.fetchedAt = time.Now()
+		}
+		c.inflight = nil
+		c.mu.Unlock()
+		close(done)
+	}()
+	return done
+}
+
+// 从认证服务获取公钥
+func (c *JWKSCache) fetch(ctx context.Context) (map[string]jwksKey, error) {
+	var jwks struct {
+		Keys []struct {
+			KeyType   string `json:"kty"`
+			KeyID     string `json:"kid"`
+			Use       string `json:"use"`
+			Algorithm string `json:"alg"`
+			Curve     string `json:"crv"`
+			X         string `json:"x"`
+			N         string `json:"n"`
+			E         string `json:"e"`
+		} `json:"keys"`
+	}
+
+	// 获取公钥是幂等的，失败时可以重试
+	err := c.app.call(ctx, config.ServiceAuth, true, func(ctx context.Context) error {
+		url, err := c.app.serviceURL(config.ServiceAuth, c.path)
+		if err != nil {
+			return resilience.Permanent(err)
+		}
+
+		request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return resilience.Permanent(err)
+		}
+
+		response, err := c.app.HTTPClient.Do(request)
+		if err != nil {
+			return err
+		}
+		defer drainAndClose(response.Body)
+
+		switch {
+		case response.StatusCode >= http.StatusInternalServerError:
+			return fmt.Errorf("auth service returned status %d", response.StatusCode)
+		case response.StatusCode != http.StatusOK:
+			return resilience.Permanent(fmt.Errorf("auth service returned status %d", response.StatusCode))
+		}
+		return json.NewDecoder(response.Body).Decode(&jwks)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]jwksKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var (
+			pub crypto.PublicKey
+			err error
+		)
+		switch k.KeyType {
+		case "OKP":
+			pub, err = ed25519Key(k.Curve, k.X)
+		case "RSA":
+			pub, err = rsaKey(k.N, k.E)
+		default:
+			err = fmt.Errorf("unsupported key type %q", k.KeyType)
+		}
+		if err != nil {
+			log.Printf("Ignoring signing key %s: %v", k.KeyID, err)
+			continue
+		}
+		keys[k.KeyID] = jwksKey{algorithm: k.Algorithm, key: pub}
+	}
+
+	return keys, nil
+}
+
+// 解析 OKP 格式的 Ed25519 公钥
+func ed25519Key(curve, x string) (crypto.PublicKey, error) {
+	if curve != "Ed25519" {
+		return nil, fmt.Errorf("unsupported curve %q", curve)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid Ed25519 public key size")
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// 解析 RSA 公钥
+func rsaKey(n, e string) (crypto.PublicKey, error) {
+	nb, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, err
+	}
+	eb, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, err
+	}
+
+	exponent := new(big.Int).SetBytes(eb)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid RSA exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(nb), E: int(exponent.Int64())}, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"broker/config"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeJWKS 是发布一个 Ed25519 公钥的认证服务
+type fakeJWKS struct {
+	kid      string
+	pub      ed25519.PublicKey
+	requests atomic.Int32
+	down     atomic.Bool
+	delay    time.Duration
+}
+
+func (f *fakeJWKS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.requests.Add(1)
+	time.Sleep(f.delay)
+	if f.down.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"kid": f.kid,
+			"use": "sig",
+			"alg": "EdDSA",
+			"x":   base64.RawURLEncoding.EncodeToString(f.pub),
+		}},
+	})
+}
+
+func newTestJWKSCache(t *testing.T, ttl time.Duration) (*JWKSCache, *fakeJWKS) {
+	t.Helper()
+
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := &fakeJWKS{kid: "key-1", pub: pub}
+	srv := httptest.NewServer(auth)
+	t.Cleanup(srv.Close)
+
+	cfg := &config.Config{Services: map[string]config.Service{
+		config.ServiceAuth: {
+			Instances: []string{srv.URL},
+			Breaker:   config.Breaker{FailureThreshold: 100},
+			Retry:     config.Retry{MaxAttempts: 1},
+		},
+	}}
+	app := &Config{
+		Services:     config.NewResolver(cfg),
+		HTTPClient:   srv.Client(),
+		Dependencies: newDependencies(cfg),
+	}
+	cache := NewJWKSCache(app, config.Auth{JWKSPath: "/.well-known/jwks.json", JWKSCacheTTL: config.Duration(ttl)})
+	return cache, auth
+}
+
+func TestJWKSCacheSharesConcurrentFetches(t *testing.T) {
+	cache, auth := newTestJWKSCache(t, time.Minute)
+	auth.delay = 50 * time.Millisecond
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key, alg, err := cache.Lookup(context.Background(), "key-1")
+			if err != nil || alg != "EdDSA" || !auth.pub.Equal(key) {
+				t.Errorf("Lookup = %v, %q, %v", key, alg, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := auth.requests.Load(); n != 1 {
+		t.Errorf("auth service was called %d times, want 1", n)
+	}
+}
+
+func TestJWKSCacheThrottlesUnknownKeys(t *testing.T) {
+	cache, auth := newTestJWKSCache(t, time.Minute)
+
+	for i := 0; i < 5; i++ {
+		if _, _, err := cache.Lookup(context.Background(), "forged"); err == nil {
+			t.Fatal("expected an error for an unknown kid")
+		}
+	}
+	if n := auth.requests.Load(); n != 1 {
+		t.Errorf("auth service was called %d times, want 1", n)
+	}
+
+	// 已经缓存的公钥不受影响
+	if _, _, err := cache.Lookup(context.Background(), "key-1"); err != nil {
+		t.Errorf("Lookup(key-1): %v", err)
+	}
+}
+
+func TestJWKSCacheServesStaleKeysWhileAuthIsDown(t *testing.T) {
+	cache, auth := newTestJWKSCache(t, time.Millisecond)
+	if _, _, err := cache.Lookup(context.Background(), "key-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 缓存过期并且认证服务不可用：继续使用缓存的公钥，失败的获取同样受到限流
+	auth.down.Store(true)
+	auth.delay = 100 * time.Millisecond
+	cache.mu.Lock()
+	cache.attemptedAt = time.Time{}
+	cache.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		start := time.Now()
+		if _, _, err := cache.Lookup(context.Background(), "key-1"); err != nil {
+			t.Fatalf("Lookup: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+			t.Fatalf("Lookup blocked for %s on the background refresh", elapsed)
+		}
+	}
+
+	// 等待后台获取失败
+	cache.mu.Lock()
+	done := cache.inflight
+	cache.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+	if _, _, err := cache.Lookup(context.Background(), "key-1"); err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if n := auth.requests.Load(); n != 2 {
+		t.Errorf("auth service was called %d times, want 2", n)
+	}
+}
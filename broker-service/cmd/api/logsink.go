@@ -0,0 +1,465 @@
+package main
+
+import (
+	"broker/config"
+	"broker/logs"
+	"broker/resilience"
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5/middleware"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"io"
+	"log"
+	"net/http"
+	"net/rpc"
+	"strings"
+)
+
+/**
+该代码定义了 LogSink 接口以及它的四种实现，分别通过 HTTP、RabbitMQ、net/rpc 和 gRPC 把日志写入日志服务。
+LogSinks 按配置保存所有传输方式：默认使用 config.Logging.Transport，失败后按 config.Logging.Fallback 的顺序依次尝试。
+请求中可以通过 "transport" 字段指定本次优先使用的传输方式。
+除 name 和 data 外，日志还可以带有 service、host、trace_id 和任意的 attributes，未指定 trace_id 时使用 broker 的请求 ID。
+"severity" 字段指定日志级别，通过 RabbitMQ 写日志时使用 log.<级别> 作为路由键，listener-service 按路由键对不同级别做不同处理。
+每种传输方式都在对应下游服务的熔断器保护下调用，熔断器打开时会立即回退到下一种传输方式。
+日志服务拒绝的日志（HTTP 4xx、gRPC InvalidArgument 或 net/rpc 的 invalid argument 错误，例如 data 太大或名称不允许）是调用方的错误：
+不计入熔断器的失败，不重试，也不回退到其他传输方式，而是把日志服务的状态码和错误信息原样返回给调用方。
+logItem 是 log 动作和 /log-grpc 路由共用的处理函数。
+logBatchViaGRPC 是 /log-grpc 路由的批量模式：通过 WriteLogs 客户端流一次发送所有日志，返回写入成功和失败的条数。批量模式只使用 gRPC，不会回退到其他传输方式。
+至少写入一条日志时返回 202（error 为 false，被拒绝的条数和原因在 data 中）；所有日志都被拒绝时返回 422。
+*/
+
+// LogSink 是一种把日志写入日志服务的传输方式
+type LogSink interface {
+	Name() string
+	Log(ctx context.Context, entry LogPayload) (string, error)
+}
+
+// LogSinks 按优先级保存所有日志传输方式
+type LogSinks struct {
+	sinks map[string]LogSink
+	order []string // 默认传输方式在前，其余为备用传输方式
+}
+
+// 根据配置创建所有日志传输方式
+func newLogSinks(app *Config, cfg config.Logging) *LogSinks {
+	sinks := []LogSink{
+		&httpLogSink{app: app},
+		&rabbitLogSink{app: app},
+		&rpcLogSink{app: app},
+		&grpcLogSink{app: app},
+	}
+
+	ls := &LogSinks{sinks: make(map[string]LogSink)}
+	for _, s := range sinks {
+		ls.sinks[s.Name()] = s
+	}
+	ls.order = dedupe(append([]string{cfg.Transport}, cfg.Fallback...))
+	return ls
+}
+
+// Log 依次尝试 preferred 和配置中的传输方式，返回成功的传输方式名称和结果
+func (ls *LogSinks) Log(ctx context.Context, entry LogPayload, preferred string) (string, string, error) {
+	order := ls.order
+	if preferred != "" {
+		order = dedupe(append([]string{preferred}, ls.order...))
+	}
+
+	var errs []error
+	for _, name := range order {
+		sink, ok := ls.sinks[name]
+		if !ok {
+			continue
+		}
+
+		result, err := sink.Log(ctx, entry)
+		if err == nil {
+			return name, result, nil
+		}
+
+		// 日志本身有问题，换一种传输方式也会被拒绝
+		var rejected *logRejectedError
+		if errors.As(err, &rejected) {
+			return "", "", err
+		}
+
+		log.Printf("log via %s failed: %v", name, err)
+		errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return "", "", errors.Join(errs...)
+}
+
+// logRejectedError 表示日志服务拒绝了这条日志
+type logRejectedError struct {
+	status  int    // 返回给调用方的状态码
+	message string // 日志服务返回的错误信息
+}
+
+func (e *logRejectedError) Error() string {
+	return "logger service rejected the log: " + e.message
+}
+
+// 日志服务拒绝的日志不计入熔断器的失败，也不会重试
+func logRejected(status int, message string) error {
+	return resilience.Permanent(&logRejectedError{status: status, message: message})
+}
+
+// 把写日志的错误写入响应：日志被拒绝时返回日志服务的状态码，其他错误按下游服务的错误处理
+func (app *Config) logError(w http.ResponseWriter, err error) {
+	var rejected *logRejectedError
+	if errors.As(err, &rejected) {
+		app.errorJson(w, errors.New(rejected.message), rejected.status)
+		return
+	}
+	app.dependencyError(w, err, http.StatusBadGateway)
+}
+
+// 去掉重复项，保留第一次出现的顺序
+func dedupe(list []string) []string {
+	seen := make(map[string]bool, len(list))
+	out := make([]string, 0, len(list))
+	for _, s := range list {
+		if s == "" || seen[s] {
+			continue
+		}
+		seen[s] = true
+		out = append(out, s)
+	}
+	return out
+}
+
+// 日志级别
+const (
+	SeverityInfo    = "INFO"
+	SeverityWarning = "WARNING"
+	SeverityError   = "ERROR"
+)
+
+// 校验请求中指定的传输方式和日志级别，并把日志级别统一为大写
+func validateLog(p *LogPayload) error {
+	if p.Transport != "" && !config.IsLogTransport(p.Transport) {
+		return fmt.Errorf("unknown transport %q", p.Transport)
+	}
+
+	p.Severity = strings.ToUpper(strings.TrimSpace(p.Severity))
+	switch p.Severity {
+	case "":
+		p.Severity = SeverityInfo
+	case SeverityInfo, SeverityWarning, SeverityError:
+	default:
+		return fmt.Errorf("unknown severity %q", p.Severity)
+	}
+	return nil
+}
+
+// 写入一条日志，并把结果写入响应
+func (app *Config) logItem(w http.ResponseWriter, r *http.Request, entry LogPayload) {
+	if entry.TraceID == "" {
+		entry.TraceID = middleware.GetReqID(r.Context()) // 用 broker 的请求 ID 关联同一个请求的日志
+	}
+
+	transport, result, err := app.LogSinks.Log(r.Context(), entry, entry.Transport)
+	if err != nil {
+		app.logError(w, err)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: result,
+		Data:    map[string]string{"transport": transport},
+	}
+
+	app.writeJson(w, http.StatusAccepted, payload)
+}
+
+// httpLogSink 通过 HTTP 写日志
+type httpLogSink struct {
+	app *Config
+}
+
+func (s *httpLogSink) Name() string { return config.TransportHTTP }
+
+func (s *httpLogSink) Log(ctx context.Context, entry LogPayload) (string, error) {
+	jsonData, _ := json.MarshalIndent(entry, "", "\t") // 将日志载荷 entry 转换为 JSON 格式的字节数据
+
+	err := s.app.call(ctx, config.ServiceLogger, false, func(ctx context.Context) error {
+		logServiceUrl, err := s.app.serviceURL(config.ServiceLogger, "/log")
+		if err != nil {
+			return err
+		}
+
+		request, err := http.NewRequestWithContext(ctx, "POST", logServiceUrl, bytes.NewReader(jsonData)) // 创建 POST 请求
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Content-Type", "application/json")
+
+		response, err := s.app.HTTPClient.Do(request) // 使用共享的客户端发送 HTTP 请求
+		if err != nil {
+			return err
+		}
+		defer drainAndClose(response.Body)
+
+		switch {
+		case response.StatusCode == http.StatusAccepted:
+			return nil
+		case response.StatusCode >= http.StatusBadRequest && response.StatusCode < http.StatusInternalServerError:
+			// 4xx 是调用方的错误，不计入熔断器的失败，原样返回
+			var jsonFromService jsonResponse
+			if err := json.NewDecoder(response.Body).Decode(&jsonFromService); err != nil || jsonFromService.Message == "" {
+				jsonFromService.Message = fmt.Sprintf("logger service returned status %d", response.StatusCode)
+			}
+			return logRejected(response.StatusCode, jsonFromService.Message)
+		default:
+			return fmt.Errorf("logger service returned status %d", response.StatusCode)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	return "logged", nil
+}
+
+// rabbitLogSink 通过 RabbitMQ 写日志，由 listener-service 转发给日志服务
+type rabbitLogSink struct {
+	app *Config
+}
+
+func (s *rabbitLogSink) Name() string { return config.TransportRabbit }
+
+func (s *rabbitLogSink) Log(ctx context.Context, entry LogPayload) (string, error) {
+	err := s.app.call(ctx, config.ServiceRabbit, false, func(ctx context.Context) error {
+		return s.app.pushToQueue(ctx, entry)
+	})
+	if err != nil {
+		return "", err
+	}
+	return "logged via RabbitMQ", nil
+}
+
+// 把日志事件推送到 RabbitMQ，路由键为 log.<级别>
+func (app *Config) pushToQueue(ctx context.Context, entry LogPayload) error {
+	severity := entry.Severity
+	if severity == "" {
+		severity = SeverityInfo
+	}
+
+	// 传输方式只对 broker 有意义，不发送给 listener
+	payload := entry
+	payload.Severity = severity
+	payload.Transport = ""
+
+	j, _ := json.MarshalIndent(&payload, "", "\t")           // 将载荷转换为 JSON 格式的字节数据
+	err := app.Emitter.Push(ctx, string(j), "log."+severity) // 将数据推送到队列中，等待 RabbitMQ 确认
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// RPCPayload 与 logger-service 中的定义一致，旧版本的 logger-service 会忽略它不认识的字段
+type RPCPayload struct {
+	Name       string
+	Data       string
+	Severity   string
+	Service    string
+	Host       string
+	TraceID    string
+	Attributes map[string]any
+}
+
+func init() {
+	// Attributes 中嵌套的对象和数组以接口类型传输，需要向 gob 注册
+	gob.Register(map[string]any{})
+	gob.Register([]any{})
+}
+
+// rpcLogSink 通过 net/rpc 写日志
+type rpcLogSink struct {
+	app *Config
+}
+
+func (s *rpcLogSink) Name() string { return config.TransportRPC }
+
+func (s *rpcLogSink) Log(ctx context.Context, entry LogPayload) (string, error) {
+	rpcPayload := RPCPayload{
+		Name:       entry.Name,
+		Data:       entry.Data,
+		Severity:   entry.Severity,
+		Service:    entry.Service,
+		Host:       entry.Host,
+		TraceID:    entry.TraceID,
+		Attributes: entry.Attributes,
+	}
+
+	var result string
+	err := s.app.call(ctx, config.ServiceLoggerRPC, false, func(ctx context.Context) error {
+		err := s.app.RPCPool.Call(ctx, "RPCServer.LogInfo", rpcPayload, &result) // 复用连接池中的连接
+
+		// 日志服务在校验错误的信息前加上 "invalid argument: "
+		var serverErr rpc.ServerError
+		if errors.As(err, &serverErr) {
+			if message, ok := strings.CutPrefix(string(serverErr), "invalid argument: "); ok {
+				return logRejected(http.StatusBadRequest, message)
+			}
+		}
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// grpcLogSink 通过 gRPC 写日志
+type grpcLogSink struct {
+	app *Config
+}
+
+func (s *grpcLogSink) Name() string { return config.TransportGRPC }
+
+func (s *grpcLogSink) Log(ctx context.Context, entry LogPayload) (string, error) {
+	c := logs.NewLogServiceClient(s.app.GRPCConn) // 复用共享的 gRPC 连接
+
+	logEntry, err := toLog(entry)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.app.call(ctx, config.ServiceLoggerGRPC, false, func(ctx context.Context) error {
+		_, err := c.WriteLog(ctx, &logs.LogRequest{LogEntry: logEntry})
+		return grpcLogError(err)
+	})
+	if err != nil {
+		return "", err
+	}
+	return "logged via gRPC", nil
+}
+
+// 批量模式最多一次写入的日志条数
+const maxLogBatch = 1000
+
+// 通过 gRPC 客户端流批量写入日志，并把写入成功和失败的条数写入响应
+func (app *Config) logBatchViaGRPC(w http.ResponseWriter, r *http.Request, entries []LogPayload) {
+	if len(entries) > maxLogBatch {
+		app.errorJson(w, fmt.Errorf("too many logs in one batch: %d, max %d", len(entries), maxLogBatch))
+		return
+	}
+
+	for i := range entries {
+		if entries[i].Name == "" {
+			app.errorJson(w, fmt.Errorf("logs[%d]: name is required", i))
+			return
+		}
+		if err := validateLog(&entries[i]); err != nil {
+			app.errorJson(w, fmt.Errorf("logs[%d]: %w", i, err))
+			return
+		}
+		if entries[i].TraceID == "" {
+			entries[i].TraceID = middleware.GetReqID(r.Context())
+		}
+	}
+
+	sink := &grpcLogSink{app: app}
+	res, err := sink.LogMany(r.Context(), entries)
+	if err != nil {
+		app.logError(w, err)
+		return
+	}
+
+	status := http.StatusAccepted
+	if res.GetAccepted() == 0 && res.GetRejected() > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+
+	payload := jsonResponse{
+		Error:   status != http.StatusAccepted,
+		Message: fmt.Sprintf("logged %d of %d via gRPC stream, %d rejected", res.GetAccepted(), len(entries), res.GetRejected()),
+		Data: map[string]any{
+			"accepted": res.GetAccepted(),
+			"rejected": res.GetRejected(),
+			"errors":   res.GetErrors(),
+		},
+	}
+
+	app.writeJson(w, status, payload)
+}
+
+// LogMany 通过 WriteLogs 客户端流批量写日志
+func (s *grpcLogSink) LogMany(ctx context.Context, entries []LogPayload) (*logs.WriteLogsResponse, error) {
+	c := logs.NewLogServiceClient(s.app.GRPCConn) // 复用共享的 gRPC 连接
+
+	batch := make([]*logs.Log, 0, len(entries))
+	for _, entry := range entries {
+		logEntry, err := toLog(entry)
+		if err != nil {
+			return nil, err
+		}
+		batch = append(batch, logEntry)
+	}
+
+	var res *logs.WriteLogsResponse
+	err := s.app.call(ctx, config.ServiceLoggerGRPC, false, func(ctx context.Context) error {
+		stream, err := c.WriteLogs(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, logEntry := range batch {
+			err := stream.Send(logEntry)
+			if errors.Is(err, io.EOF) {
+				// 服务端提前结束了流，真正的错误由 CloseAndRecv 返回
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		res, err = stream.CloseAndRecv()
+		return grpcLogError(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// 日志服务返回 InvalidArgument 时表示日志被拒绝
+func grpcLogError(err error) error {
+	if st, ok := status.FromError(err); ok && st.Code() == codes.InvalidArgument {
+		return logRejected(http.StatusBadRequest, st.Message())
+	}
+	return err
+}
+
+// 把 LogPayload 转换为 protobuf 的 Log
+func toLog(entry LogPayload) (*logs.Log, error) {
+	logEntry := &logs.Log{
+		Name:     entry.Name,
+		Data:     entry.Data,
+		Severity: entry.Severity,
+		Service:  entry.Service,
+		Host:     entry.Host,
+		TraceId:  entry.TraceID,
+	}
+
+	if len(entry.Attributes) > 0 {
+		attributes, err := structpb.NewStruct(entry.Attributes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid attributes: %w", err)
+		}
+		logEntry.Attributes = attributes
+	}
+	return logEntry, nil
+}
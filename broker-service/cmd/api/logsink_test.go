@@ -0,0 +1,88 @@
+package main
+
+import (
+	"broker/config"
+	"broker/resilience"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeLogSink 记录被调用的次数，总是成功
+type fakeLogSink struct {
+	calls int
+}
+
+func (s *fakeLogSink) Name() string { return "fake" }
+
+func (s *fakeLogSink) Log(ctx context.Context, entry LogPayload) (string, error) {
+	s.calls++
+	return "logged via fake", nil
+}
+
+func TestLogSinksHTTPStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		body         string
+		wantRejected bool
+		wantFallback bool
+		wantBreaker  string
+	}{
+		{"accepted", http.StatusAccepted, `{"error":false,"message":"logged"}`, false, false, "closed"},
+		{"bad request is returned to the caller", http.StatusBadRequest, `{"error":true,"message":"invalid data: too large"}`, true, false, "closed"},
+		{"4xx without a json body", http.StatusRequestEntityTooLarge, ``, true, false, "closed"},
+		{"server error falls back", http.StatusInternalServerError, ``, false, true, "open"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer logger.Close()
+
+			cfg := &config.Config{Services: map[string]config.Service{
+				config.ServiceLogger: {
+					Instances: []string{logger.URL},
+					Breaker:   config.Breaker{FailureThreshold: 1, OpenTimeout: config.Duration(time.Minute)},
+				},
+			}}
+			app := &Config{
+				Services:     config.NewResolver(cfg),
+				HTTPClient:   logger.Client(),
+				Dependencies: newDependencies(cfg),
+			}
+			fallback := &fakeLogSink{}
+			sinks := &LogSinks{
+				sinks: map[string]LogSink{config.TransportHTTP: &httpLogSink{app: app}, "fake": fallback},
+				order: []string{config.TransportHTTP, "fake"},
+			}
+
+			transport, _, err := sinks.Log(context.Background(), LogPayload{Name: "test"}, "")
+
+			var rejected *logRejectedError
+			if got := errors.As(err, &rejected); got != tt.wantRejected {
+				t.Fatalf("rejected = %v, want %v (err %v)", got, tt.wantRejected, err)
+			}
+			if tt.wantRejected {
+				if rejected.status != tt.status {
+					t.Errorf("status = %d, want %d", rejected.status, tt.status)
+				}
+				if !resilience.IsPermanent(err) {
+					t.Error("a rejected log should be a permanent error")
+				}
+			}
+			if got := fallback.calls > 0; got != tt.wantFallback {
+				t.Errorf("fallback used = %v, want %v (transport %q)", got, tt.wantFallback, transport)
+			}
+			if state := app.Dependencies[config.ServiceLogger].breaker.Status().State; state != tt.wantBreaker {
+				t.Errorf("breaker state = %s, want %s", state, tt.wantBreaker)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"broker/config"
+	"broker/resilience"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/**
+该代码定义了吊销了会话的用户列表 RevocationList，用于拒绝用户重置密码或被停用之前签发的访问令牌。
+访问令牌在 broker 本地通过 JWKS 验证，在过期之前本身一直有效；认证服务在吊销会话时记录吊销的时间，
+并通过 RevocationsPath 返回最近 ACCESS_TOKEN_TTL 内吊销过会话的用户（更早签发的访问令牌已经过期）。
+Run 每隔 RevocationsRefresh 获取一次完整的列表并替换缓存，签发时间不晚于吊销时间所在的秒的访问令牌视为失效（iat 只精确到秒）。
+获取失败时继续使用上一次的列表，因此吊销最多在一个 RevocationsRefresh 之后（认证服务不可用时更久）在 broker 生效。
+*/
+
+// RevocationList 缓存吊销了会话的用户和吊销的时间
+type RevocationList struct {
+	app      *Config
+	path     string
+	interval time.Duration
+
+	mu      sync.RWMutex
+	revoked map[int]time.Time
+}
+
+// NewRevocationList 创建一个从认证服务的 path 获取吊销了会话的用户的列表
+func NewRevocationList(app *Config, cfg config.Auth) *RevocationList {
+	return &RevocationList{
+		app:      app,
+		path:     cfg.RevocationsPath,
+		interval: time.Duration(cfg.RevocationsRefresh),
+	}
+}
+
+// Run 立即获取一次列表，然后定期获取，直到 ctx 被取消
+func (l *RevocationList) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := l.refresh(ctx); err != nil && ctx.Err() == nil {
+			log.Println("Error fetching revoked sessions from auth service:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Revoked 返回用户在 issuedAt 签发的访问令牌是否已经因为吊销会话而失效
+func (l *RevocationList) Revoked(userID int, issuedAt time.Time) bool {
+	l.mu.RLock()
+	revokedAt, ok := l.revoked[userID]
+	l.mu.RUnlock()
+
+	return ok && !issuedAt.After(revokedAt.Truncate(time.Second))
+}
+
+// 从认证服务获取列表并替换缓存
+func (l *RevocationList) refresh(ctx context.Context) error {
+	revoked, err := l.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.revoked = revoked
+	l.mu.Unlock()
+	return nil
+}
+
+// 从认证服务获取吊销了会话的用户
+func (l *RevocationList) fetch(ctx context.Context) (map[int]time.Time, error) {
+	var body struct {
+		Revocations []struct {
+			UserID    int       `json:"user_id"`
+			RevokedAt time.Time `json:"revoked_at"`
+		} `json:"revocations"`
+	}
+
+	// 获取列表是幂等的，失败时可以重试
+	err := l.app.call(ctx, config.ServiceAuth, true, func(ctx context.Context) error {
+		url, err := l.app.serviceURL(config.ServiceAuth, l.path)
+		if err != nil {
+			return resilience.Permanent(err)
+		}
+
+		request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return resilience.Permanent(err)
+		}
+
+		response, err := l.app.HTTPClient.Do(request)
+		if err != nil {
+			return err
+		}
+		defer drainAndClose(response.Body)
+
+		switch {
+		case response.StatusCode >= http.StatusInternalServerError:
+			return fmt.Errorf("auth service returned status %d", response.StatusCode)
+		case response.StatusCode != http.StatusOK:
+			return resilience.Permanent(fmt.Errorf("auth service returned status %d", response.StatusCode))
+		}
+		return json.NewDecoder(response.Body).Decode(&body)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	revoked := make(map[int]time.Time, len(body.Revocations))
+	for _, r := range body.Revocations {
+		revoked[r.UserID] = r.RevokedAt
+	}
+	return revoked, nil
+}
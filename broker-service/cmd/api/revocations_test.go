@@ -0,0 +1,79 @@
+package main
+
+import (
+	"broker/config"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRevocationList(t *testing.T) {
+	revokedAt := time.Date(2024, 5, 1, 10, 0, 0, 500_000_000, time.UTC)
+
+	var down atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"revocations": []map[string]any{{"user_id": 1, "revoked_at": revokedAt}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := &config.Config{Services: map[string]config.Service{
+		config.ServiceAuth: {
+			Instances: []string{srv.URL},
+			Breaker:   config.Breaker{FailureThreshold: 100},
+			Retry:     config.Retry{MaxAttempts: 1},
+		},
+	}}
+	app := &Config{
+		Services:     config.NewResolver(cfg),
+		HTTPClient:   srv.Client(),
+		Dependencies: newDependencies(cfg),
+	}
+	list := NewRevocationList(app, config.Auth{RevocationsPath: "/sessions/revoked", RevocationsRefresh: config.Duration(time.Minute)})
+
+	// 获取之前没有吊销任何会话
+	if list.Revoked(1, revokedAt.Add(-time.Hour)) {
+		t.Error("Revoked before the first fetch")
+	}
+	if err := list.refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		userID   int
+		issuedAt time.Time
+		want     bool
+	}{
+		{"issued before the revocation", 1, revokedAt.Add(-time.Minute), true},
+		{"issued in the same second", 1, revokedAt.Truncate(time.Second), true},
+		{"issued after the revocation", 1, revokedAt.Truncate(time.Second).Add(time.Second), false},
+		{"missing iat", 1, time.Time{}, true},
+		{"another user", 2, revokedAt.Add(-time.Minute), false},
+	}
+
+	check := func(t *testing.T) {
+		for _, tt := range tests {
+			if got := list.Revoked(tt.userID, tt.issuedAt); got != tt.want {
+				t.Errorf("%s: Revoked = %v, want %v", tt.name, got, tt.want)
+			}
+		}
+	}
+	check(t)
+
+	// 认证服务不可用时继续使用上一次的列表
+	down.Store(true)
+	if err := list.refresh(context.Background()); err == nil {
+		t.Error("refresh should fail while the auth service is down")
+	}
+	check(t)
+}
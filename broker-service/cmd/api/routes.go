@@ -20,10 +20,17 @@ func (app *Config) routes() http.Handler {
 	}))
 
 	mux.Use(middleware.Heartbeat("/ping"))
+	mux.Use(middleware.RequestID) // 为每个请求分配请求 ID，作为日志的默认 trace_id
+	mux.Use(app.identify)         // 验证访问令牌，动作的访问策略在 HandleSubmission 中检查
+
+	mux.Get("/health/dependencies", app.DependencyHealth)
 
 	mux.Post("/", app.Broker)
-	mux.Post("/log-grpc", app.LogViaGRPC)
+	mux.With(app.requirePolicy(requireAuth())).Post("/log-grpc", app.LogViaGRPC)
+
+	mux.Get("/verify", app.VerifyEmail) // 验证邮件中的链接
 
 	mux.Post("/handle", app.HandleSubmission)
+	mux.Get("/actions", app.ListActions)
 	return mux
 }
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 把配置文件写到临时目录并返回它的路径
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	yamlFile := `
+services:
+  logger:
+    instances: [http://logger-1, http://logger-2]
+    timeout: 2s
+    breaker:
+      failure_threshold: 10
+  search:
+    instances: [http://search]
+logging:
+  transport: grpc
+  fallback: [http]
+`
+	jsonFile := `{"services":{"mailer":{"retry":{"max_attempts":1}}},"auth":{"audience":"from-file"}}`
+
+	tests := []struct {
+		name    string
+		file    string // 文件名和内容用 "|" 分隔
+		env     map[string]string
+		check   func(t *testing.T, cfg *Config)
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, cfg *Config) {
+				if got := cfg.Services[ServiceLogger].Instances; !reflect.DeepEqual(got, []string{"http://logger-service"}) {
+					t.Errorf("logger instances = %v", got)
+				}
+				if cfg.Logging.Transport != TransportRPC {
+					t.Errorf("transport = %q, want %q", cfg.Logging.Transport, TransportRPC)
+				}
+			},
+		},
+		{
+			name: "yaml file overrides only the fields it sets",
+			file: "broker.yaml|" + yamlFile,
+			check: func(t *testing.T, cfg *Config) {
+				logger := cfg.Services[ServiceLogger]
+				if !reflect.DeepEqual(logger.Instances, []string{"http://logger-1", "http://logger-2"}) {
+					t.Errorf("logger instances = %v", logger.Instances)
+				}
+				if logger.Timeout != Duration(2*time.Second) || logger.Breaker.FailureThreshold != 10 {
+					t.Errorf("logger timeout %s, failure threshold %d", time.Duration(logger.Timeout), logger.Breaker.FailureThreshold)
+				}
+				if logger.Retry != defaultService.Retry || logger.Breaker.OpenTimeout != defaultService.Breaker.OpenTimeout {
+					t.Errorf("unset fields should keep their defaults: %+v", logger)
+				}
+				if search := cfg.Services["search"]; search.Timeout != defaultService.Timeout {
+					t.Errorf("new service should use the default policy: %+v", search)
+				}
+				if cfg.Logging.Transport != TransportGRPC || !reflect.DeepEqual(cfg.Logging.Fallback, []string{TransportHTTP}) {
+					t.Errorf("logging = %+v", cfg.Logging)
+				}
+			},
+		},
+		{
+			name: "json file",
+			file: "broker.json|" + jsonFile,
+			check: func(t *testing.T, cfg *Config) {
+				if got := cfg.Services[ServiceMailer].Retry.MaxAttempts; got != 1 {
+					t.Errorf("mailer max attempts = %d, want 1", got)
+				}
+				if cfg.Auth.Audience != "from-file" || cfg.Auth.Issuer != "authentication-service" {
+					t.Errorf("auth = %+v", cfg.Auth)
+				}
+			},
+		},
+		{
+			name: "environment overrides the file",
+			file: "broker.yaml|" + yamlFile,
+			env: map[string]string{
+				"LOGGER_ADDRS":       " http://a, ,http://b ",
+				"LOGGER_RPC_TIMEOUT": "750ms",
+				"LOG_TRANSPORT":      "http",
+				"LOG_FALLBACK":       "",
+				"JWKS_CACHE_TTL":     "1m",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				if got := cfg.Services[ServiceLogger].Instances; !reflect.DeepEqual(got, []string{"http://a", "http://b"}) {
+					t.Errorf("logger instances = %v", got)
+				}
+				if got := cfg.Services[ServiceLoggerRPC].Timeout; got != Duration(750*time.Millisecond) {
+					t.Errorf("logger-rpc timeout = %s", time.Duration(got))
+				}
+				if cfg.Logging.Transport != TransportHTTP || len(cfg.Logging.Fallback) != 0 {
+					t.Errorf("logging = %+v, want http without fallback", cfg.Logging)
+				}
+				if cfg.Auth.JWKSCacheTTL != Duration(time.Minute) {
+					t.Errorf("jwks cache ttl = %s", time.Duration(cfg.Auth.JWKSCacheTTL))
+				}
+			},
+		},
+		{name: "invalid timeout", env: map[string]string{"MAILER_TIMEOUT": "soon"}, wantErr: "MAILER_TIMEOUT"},
+		{name: "unknown transport", env: map[string]string{"LOG_FALLBACK": "http,carrier-pigeon"}, wantErr: `unknown log transport "carrier-pigeon"`},
+		{name: "service without instances", file: "broker.yaml|services: {search: {timeout: 1s}}", wantErr: `service "search" has no instances`},
+		{name: "unsupported file format", file: "broker.toml|", wantErr: "unsupported config file format"},
+		{name: "malformed file", file: "broker.json|{", wantErr: "parse config file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BROKER_CONFIG", "")
+			if tt.file != "" {
+				name, content, _ := strings.Cut(tt.file, "|")
+				t.Setenv("BROKER_CONFIG", writeConfigFile(t, name, content))
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			cfg, err := Load()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		service string
+		want    string
+	}{
+		{ServiceMailer, "MAILER_ADDRS"},
+		{ServiceLoggerRPC, "LOGGER_RPC_ADDRS"},
+		{ServiceLoggerGRPC, "LOGGER_GRPC_ADDRS"},
+	}
+
+	for _, tt := range tests {
+		if got := EnvName(tt.service); got != tt.want {
+			t.Errorf("EnvName(%q) = %q, want %q", tt.service, got, tt.want)
+		}
+	}
+}
+
+func TestResolverRoundRobin(t *testing.T) {
+	r := NewResolver(&Config{Services: map[string]Service{
+		"logger": {Instances: []string{"a", "b", "c"}},
+		"empty":  {},
+	}})
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		addr, err := r.Next("logger")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, addr)
+	}
+	if want := []string{"a", "b", "c", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Next = %v, want %v", got, want)
+	}
+
+	for _, name := range []string{"empty", "unknown"} {
+		if _, err := r.Next(name); err == nil {
+			t.Errorf("Next(%q) should fail", name)
+		}
+	}
+}
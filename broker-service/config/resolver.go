@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+/**
+Resolver 按逻辑服务名返回服务实例的地址。
+同一个服务配置了多个实例时，Next 在这些实例之间轮询，实现客户端负载均衡。
+*/
+
+// Resolver 是并发安全的服务地址解析器
+type Resolver struct {
+	services map[string]*roundRobin
+}
+
+type roundRobin struct {
+	instances []string
+	next      uint64
+}
+
+// NewResolver 根据配置创建一个解析器
+func NewResolver(cfg *Config) *Resolver {
+	r := &Resolver{services: make(map[string]*roundRobin)}
+	for name, svc := range cfg.Services {
+		instances := make([]string, len(svc.Instances))
+		copy(instances, svc.Instances)
+		r.services[name] = &roundRobin{instances: instances}
+	}
+	return r
+}
+
+// Next 轮询返回服务的下一个实例地址
+func (r *Resolver) Next(service string) (string, error) {
+	rr, ok := r.services[service]
+	if !ok || len(rr.instances) == 0 {
+		return "", fmt.Errorf("no instances for service %q", service)
+	}
+
+	n := atomic.AddUint64(&rr.next, 1) - 1
+	return rr.instances[n%uint64(len(rr.instances))], nil
+}
+
+// Instances 返回服务的所有实例地址
+func (r *Resolver) Instances(service string) []string {
+	rr, ok := r.services[service]
+	if !ok {
+		return nil
+	}
+
+	out := make([]string, len(rr.instances))
+	copy(out, rr.instances)
+	return out
+}
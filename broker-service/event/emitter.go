@@ -1,25 +1,81 @@
 package event
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"log"
+	"rabbitmq"
+	"time"
 )
 
 /**
 该代码定义了一个名为 Emitter 的结构体，表示事件的发布者。
-setup 方法用于设置 Emitter，其中会创建一个通道，并调用 declareExchange 方法来声明一个交换机。
-Push 方法用于将事件推送到消息队列。它创建一个通道并使用 channel.Publish 方法发布消息到交换机。
-NewEventEmitter 函数用于创建一个新的 Emitter 实例，并调用 setup 方法进行设置。
+Emitter 是长期存在的，整个 broker 共享一个实例。它维护一个处于 confirm 模式的通道池，通道在第一次使用时创建，
+RabbitMQ 重连后旧通道会被丢弃并在新连接上重新创建。
+Push 方法用于将一个事件推送到消息队列，PushMany 方法用于在同一个通道上批量推送事件。两者都等到 RabbitMQ 确认（ack）所有消息后才返回，
+消息被拒绝（nack）时返回 ErrNacked。
+每条消息都带有随机的 MessageId 和发布时间 Timestamp，消息被重新投递时两者不变，消费者可以据此识别重复投递的消息。
+开启 Mandatory 后消息以 mandatory 方式发布，没有任何队列绑定对应路由键时 RabbitMQ 会退回消息，此时返回 ErrUnroutable。
+DeclareExchange 用于注册到 ConnectionManager.OnConnect，保证每次连接（包括重连）成功后交换机都已经声明。
 该代码与消息队列相关，使用了 RabbitMQ 的 amqp091-go 包来实现与 RabbitMQ 的交互。
 */
 
+const (
+	defaultPoolSize = 4   // 默认的通道池大小
+	maxBatch        = 256 // PushMany 每批在一个通道上发布的最大消息数
+)
+
+var (
+	// ErrNacked 表示 RabbitMQ 拒绝了消息
+	ErrNacked = errors.New("message was nacked by rabbitmq")
+	// ErrUnroutable 表示 mandatory 消息没有可以投递的队列，被 RabbitMQ 退回
+	ErrUnroutable = errors.New("message was returned by rabbitmq as unroutable")
+)
+
+// EmitterConfig 是 Emitter 的配置
+type EmitterConfig struct {
+	PoolSize  int  // 通道池中最多保留的空闲通道数
+	Mandatory bool // 是否以 mandatory 方式发布消息
+}
+
+// Message 是一条待推送的事件
+type Message struct {
+	Body       string
+	RoutingKey string // 例如 log.INFO
+}
+
 type Emitter struct {
-	connection *amqp.Connection
+	manager *rabbitmq.ConnectionManager
+	config  EmitterConfig
+	pool    chan *confirmChannel
+}
+
+// confirmChannel 是一个处于 confirm 模式的通道，同一时间只被一个调用方使用
+type confirmChannel struct {
+	ch      *amqp.Channel
+	returns chan amqp.Return // 缓冲区能容纳一批消息的全部退回，避免阻塞 amqp 的读协程
+}
+
+// 创建一个新的 Event Emitter 实例
+func NewEventEmitter(manager *rabbitmq.ConnectionManager, config EmitterConfig) *Emitter {
+	if config.PoolSize <= 0 {
+		config.PoolSize = defaultPoolSize
+	}
+
+	return &Emitter{
+		manager: manager,
+		config:  config,
+		pool:    make(chan *confirmChannel, config.PoolSize),
+	}
 }
 
-// 设置 Emitter
-func (e *Emitter) setup() error {
-	channel, err := e.connection.Channel()
+// DeclareExchange 在连接上声明一个交换机
+func DeclareExchange(conn *amqp.Connection) error {
+	channel, err := conn.Channel()
 	if err != nil {
 		return err
 	}
@@ -28,43 +84,170 @@ func (e *Emitter) setup() error {
 	return declareExchange(channel) // 声明一个交换机
 }
 
-// 推送事件到消息队列
-func (e *Emitter) Push(event string, severity string) error {
-	channel, err := e.connection.Channel()
+// 推送事件到消息队列，并等待 RabbitMQ 确认
+func (e *Emitter) Push(ctx context.Context, event string, severity string) error {
+	return e.PushMany(ctx, []Message{{Body: event, RoutingKey: severity}})
+}
+
+// PushMany 批量推送事件到消息队列，并等待 RabbitMQ 确认所有消息
+func (e *Emitter) PushMany(ctx context.Context, messages []Message) error {
+	for len(messages) > 0 {
+		n := len(messages)
+		if n > maxBatch {
+			n = maxBatch
+		}
+
+		if err := e.publishBatch(ctx, messages[:n]); err != nil {
+			return err
+		}
+		messages = messages[n:]
+	}
+	return nil
+}
+
+// 在一个通道上发布一批消息，并等待所有消息被确认
+func (e *Emitter) publishBatch(ctx context.Context, messages []Message) error {
+	c, err := e.acquire(ctx)
 	if err != nil {
 		return err
 	}
-	defer channel.Close()
 
-	log.Println("Pushing to channel") // 打印推送消息的提示信息
-
-	err = channel.Publish(
-		"logs_topic",
-		severity,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "text/plain",
-			Body:        []byte(event), // 设置消息的内容
-		},
-	)
-	if err != nil {
+	log.Printf("Pushing %d message(s) to channel", len(messages)) // 打印推送消息的提示信息
+
+	err = c.publish(ctx, messages, e.config.Mandatory)
+	if err != nil && !errors.Is(err, ErrNacked) && !errors.Is(err, ErrUnroutable) {
+		// 通道上可能还有未确认的消息，不再复用
+		_ = c.ch.Close()
 		return err
 	}
 
+	e.release(c)
+	return err
+}
+
+// 发布消息并等待确认，返回被拒绝或被退回的消息
+func (c *confirmChannel) publish(ctx context.Context, messages []Message, mandatory bool) error {
+	confirms := make([]*amqp.DeferredConfirmation, 0, len(messages))
+	for _, m := range messages {
+		dc, err := c.ch.PublishWithDeferredConfirmWithContext(
+			ctx,
+			"logs_topic",
+			m.RoutingKey,
+			mandatory,
+			false,
+			amqp.Publishing{
+				ContentType: "text/plain",
+				MessageId:   newMessageID(),
+				Timestamp:   time.Now(),
+				Body:        []byte(m.Body), // 设置消息的内容
+			},
+		)
+		if err != nil {
+			return err
+		}
+		confirms = append(confirms, dc)
+	}
+
+	nacked := 0
+	for _, dc := range confirms {
+		ack, err := dc.WaitContext(ctx)
+		if err != nil {
+			return err
+		}
+		if !ack {
+			if c.ch.IsClosed() {
+				return amqp.ErrClosed
+			}
+			nacked++
+		}
+	}
+
+	// RabbitMQ 在确认之前发送退回，此时所有退回都已经在缓冲区中
+	returned := 0
+	for drained := false; !drained; {
+		select {
+		case <-c.returns:
+			returned++
+		default:
+			drained = true
+		}
+	}
+
+	switch {
+	case nacked > 0:
+		return fmt.Errorf("%w: %d of %d messages", ErrNacked, nacked, len(messages))
+	case returned > 0:
+		return fmt.Errorf("%w: %d of %d messages", ErrUnroutable, returned, len(messages))
+	}
 	return nil
 }
 
-// 创建一个新的 Event Emitter 实例
-func NewEventEmitter(conn *amqp.Connection) (Emitter, error) {
-	emitter := Emitter{
-		connection: conn,
+// 从通道池中取出一个可用的通道，没有空闲通道时在当前连接上创建一个
+func (e *Emitter) acquire(ctx context.Context) (*confirmChannel, error) {
+	for {
+		select {
+		case c := <-e.pool:
+			if !c.ch.IsClosed() {
+				return c, nil
+			}
+			// 连接断开后旧通道已经关闭，丢弃
+		default:
+			return e.open(ctx)
+		}
+	}
+}
+
+// 在当前连接上创建一个 confirm 模式的通道
+func (e *Emitter) open(ctx context.Context) (*confirmChannel, error) {
+	conn, err := e.manager.Connection(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	err := emitter.setup() // 调用 setup 方法设置 Emitter
+	ch, err := conn.Channel()
 	if err != nil {
-		return Emitter{}, err
+		return nil, err
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		_ = ch.Close()
+		return nil, err
+	}
+
+	return &confirmChannel{
+		ch:      ch,
+		returns: ch.NotifyReturn(make(chan amqp.Return, maxBatch)),
+	}, nil
+}
+
+// 把通道放回通道池，通道池已满时关闭通道
+func (e *Emitter) release(c *confirmChannel) {
+	if c.ch.IsClosed() {
+		return
 	}
 
-	return emitter, nil
+	select {
+	case e.pool <- c:
+	default:
+		_ = c.ch.Close()
+	}
+}
+
+// Close 关闭通道池中的所有通道
+func (e *Emitter) Close() {
+	for {
+		select {
+		case c := <-e.pool:
+			_ = c.ch.Close()
+		default:
+			return
+		}
+	}
+}
+
+// 生成消息 ID：16 个随机字节的十六进制表示
+func newMessageID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
 }
@@ -0,0 +1,198 @@
+package resilience
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+/**
+该代码实现了一个熔断器 Breaker，用于保护对下游服务的调用。
+熔断器有三种状态：
+closed：正常放行请求，连续失败次数达到 FailureThreshold 后进入 open；
+open：直接拒绝请求并返回 ErrOpen，经过 OpenTimeout 后进入 half-open；
+half-open：最多放行 HalfOpenMaxCalls 个试探请求，全部成功则回到 closed，任意一个失败则重新进入 open。
+被 Permanent 包装的错误表示下游服务正常响应了一个业务错误，不计为失败。
+每次状态变化时 generation 加一，allow 返回放行时的 generation，record 忽略其他 generation 中放行的调用的结果：
+例如在 closed 时放行、在熔断器打开并进入 half-open 之后才完成的调用，不能计为试探请求，也不能关闭熔断器。
+*/
+
+// ErrOpen 表示熔断器处于打开状态，请求被直接拒绝
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State 是熔断器的状态
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerSettings 是熔断器的阈值配置
+type BreakerSettings struct {
+	FailureThreshold int           // 连续失败多少次后打开熔断器
+	OpenTimeout      time.Duration // 打开后经过多久进入半开状态
+	HalfOpenMaxCalls int           // 半开状态下放行的试探请求数
+}
+
+// Breaker 是一个并发安全的熔断器
+type Breaker struct {
+	name     string
+	settings BreakerSettings
+
+	mu         sync.Mutex
+	state      State
+	generation uint64    // 每次状态变化时加一
+	failures   int       // 连续失败次数
+	inFlight   int       // 半开状态下正在进行的试探请求数
+	successes  int       // 半开状态下成功的试探请求数
+	openedAt   time.Time // 最近一次打开的时间
+	lastError  string    // 最近一次失败的错误信息
+}
+
+// NewBreaker 创建一个处于关闭状态的熔断器
+func NewBreaker(name string, settings BreakerSettings) *Breaker {
+	if settings.FailureThreshold <= 0 {
+		settings.FailureThreshold = 1
+	}
+	if settings.HalfOpenMaxCalls <= 0 {
+		settings.HalfOpenMaxCalls = 1
+	}
+	return &Breaker{name: name, settings: settings}
+}
+
+// Name 返回熔断器保护的服务名
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// Execute 在熔断器的保护下执行 fn
+func (b *Breaker) Execute(fn func() error) error {
+	generation, err := b.allow()
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	b.record(generation, err)
+	return err
+}
+
+// 判断当前是否放行请求，放行时返回当前的 generation
+func (b *Breaker) allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen {
+		if time.Since(b.openedAt) < b.settings.OpenTimeout {
+			return 0, ErrOpen
+		}
+		b.setState(StateHalfOpen)
+	}
+
+	if b.state == StateHalfOpen {
+		if b.inFlight >= b.settings.HalfOpenMaxCalls {
+			return 0, ErrOpen
+		}
+		b.inFlight++
+	}
+	return b.generation, nil
+}
+
+// 记录在 generation 中放行的一次调用的结果，熔断器的状态已经变化时忽略
+func (b *Breaker) record(generation uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+	failed := err != nil && !IsPermanent(err)
+
+	switch b.state {
+	case StateClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		b.lastError = err.Error()
+		if b.failures >= b.settings.FailureThreshold {
+			b.open()
+		}
+	case StateHalfOpen:
+		b.inFlight--
+		if failed {
+			b.lastError = err.Error()
+			b.open()
+			return
+		}
+		b.successes++
+		if b.successes >= b.settings.HalfOpenMaxCalls {
+			b.setState(StateClosed)
+		}
+	}
+}
+
+// 打开熔断器，调用方需持有锁
+func (b *Breaker) open() {
+	b.setState(StateOpen)
+	b.openedAt = time.Now()
+}
+
+// 切换到 state 并开始新的 generation，清空试探请求的计数，回到 closed 时同时清空失败次数，调用方需持有锁
+func (b *Breaker) setState(state State) {
+	b.state = state
+	b.generation++
+	b.inFlight = 0
+	b.successes = 0
+	if state == StateClosed {
+		b.failures = 0
+	}
+}
+
+// BreakerStatus 是熔断器当前状态的快照
+type BreakerStatus struct {
+	Name      string     `json:"name"`
+	State     string     `json:"state"`
+	Failures  int        `json:"failures"`
+	OpenedAt  *time.Time `json:"opened_at,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// Status 返回熔断器当前状态的快照
+func (b *Breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := b.state
+	if state == StateOpen && time.Since(b.openedAt) >= b.settings.OpenTimeout {
+		state = StateHalfOpen // 下一次请求将作为试探请求放行
+	}
+
+	status := BreakerStatus{
+		Name:      b.name,
+		State:     state.String(),
+		Failures:  b.failures,
+		LastError: b.lastError,
+	}
+	if !b.openedAt.IsZero() {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
@@ -0,0 +1,172 @@
+package resilience
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var (
+	errDown     = errors.New("service unavailable")
+	errRejected = errors.New("bad request")
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	const openTimeout = 20 * time.Millisecond
+	settings := func(threshold int) BreakerSettings {
+		return BreakerSettings{FailureThreshold: threshold, OpenTimeout: openTimeout}
+	}
+
+	// ok、fail 和 rejected 调用一次 Execute，wait 等待熔断器进入半开状态
+	tests := []struct {
+		name      string
+		settings  BreakerSettings
+		calls     []string
+		wantState string
+		wantErr   error // 最后一次调用返回的错误
+	}{
+		{"closed while calls succeed", settings(2), []string{"ok", "ok", "ok"}, "closed", nil},
+		{"stays closed below the threshold", settings(3), []string{"fail", "fail"}, "closed", errDown},
+		{"a success resets the failure count", settings(2), []string{"fail", "ok", "fail"}, "closed", errDown},
+		{"opens at the threshold", settings(2), []string{"fail", "fail"}, "open", errDown},
+		{"rejects calls while open", settings(1), []string{"fail", "ok"}, "open", ErrOpen},
+		{"permanent errors do not count", settings(1), []string{"rejected", "rejected"}, "closed", errRejected},
+		{"half-open after the timeout", settings(1), []string{"fail", "wait"}, "half-open", errDown},
+		{"closes after a successful probe", settings(1), []string{"fail", "wait", "ok"}, "closed", nil},
+		{"reopens after a failed probe", settings(1), []string{"fail", "wait", "fail"}, "open", errDown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBreaker("test", tt.settings)
+
+			var err error
+			for _, call := range tt.calls {
+				switch call {
+				case "ok":
+					err = b.Execute(func() error { return nil })
+				case "fail":
+					err = b.Execute(func() error { return errDown })
+				case "rejected":
+					err = b.Execute(func() error { return Permanent(errRejected) })
+				case "wait":
+					time.Sleep(openTimeout)
+				}
+			}
+
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("last call = %v, want %v", err, tt.wantErr)
+			}
+			if state := b.Status().State; state != tt.wantState {
+				t.Errorf("state = %s, want %s", state, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestBreakerHalfOpenLimitsProbes(t *testing.T) {
+	b := NewBreaker("test", BreakerSettings{FailureThreshold: 1, HalfOpenMaxCalls: 2})
+	_ = b.Execute(func() error { return errDown })
+
+	// 两个试探请求还没有完成时，第三个请求被拒绝
+	release := make(chan struct{})
+	done := make(chan error, 2)
+	started := make(chan struct{}, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			done <- b.Execute(func() error {
+				started <- struct{}{}
+				<-release
+				return nil
+			})
+		}()
+	}
+	<-started
+	<-started
+
+	if err := b.Execute(func() error { return nil }); !errors.Is(err, ErrOpen) {
+		t.Errorf("third probe = %v, want %v", err, ErrOpen)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Errorf("probe = %v", err)
+		}
+	}
+	if state := b.Status().State; state != "closed" {
+		t.Errorf("state = %s, want closed", state)
+	}
+}
+
+func TestBreakerIgnoresResultsFromEarlierStates(t *testing.T) {
+	// 直接调用 allow 和 record 模拟交错完成的调用，OpenTimeout 为 0，打开后的下一次 allow 进入半开状态
+	tests := []struct {
+		name      string
+		maxCalls  int                    // HalfOpenMaxCalls
+		run       func(b *Breaker) error // 返回最后一次 allow 的错误
+		wantErr   error
+		wantState string
+	}{
+		{
+			name:     "a call admitted while closed cannot close a half-open breaker",
+			maxCalls: 1,
+			run: func(b *Breaker) error {
+				slow, _ := b.allow()
+				fail, _ := b.allow()
+				b.record(fail, errDown)
+				probe, err := b.allow()
+				b.record(slow, nil)
+				if state := b.Status().State; state != "half-open" {
+					t.Errorf("after the stale success state = %s, want half-open", state)
+				}
+				b.record(probe, nil)
+				return err
+			},
+			wantState: "closed",
+		},
+		{
+			name:     "a stale result does not free a probe slot",
+			maxCalls: 1,
+			run: func(b *Breaker) error {
+				slow, _ := b.allow()
+				fail, _ := b.allow()
+				b.record(fail, errDown)
+				_, _ = b.allow() // 唯一的试探请求，还没有完成
+				b.record(slow, errDown)
+				_, err := b.allow()
+				return err
+			},
+			wantErr:   ErrOpen,
+			wantState: "half-open",
+		},
+		{
+			name:     "a probe from an earlier half-open round does not count",
+			maxCalls: 2,
+			run: func(b *Breaker) error {
+				first, _ := b.allow()
+				b.record(first, errDown)
+				old, _ := b.allow()       // 第一轮的试探请求
+				failed, _ := b.allow()    // 第一轮的另一个试探请求
+				b.record(failed, errDown) // 重新打开
+				next, err := b.allow()    // 第二轮的试探请求
+				b.record(old, nil)
+				b.record(next, nil)
+				return err
+			},
+			wantState: "half-open",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBreaker("test", BreakerSettings{FailureThreshold: 1, HalfOpenMaxCalls: tt.maxCalls})
+			if err := tt.run(b); tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("last allow = %v, want %v", err, tt.wantErr)
+			}
+			if state := b.Status().State; state != tt.wantState {
+				t.Errorf("state = %s, want %s", state, tt.wantState)
+			}
+		})
+	}
+}
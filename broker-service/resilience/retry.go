@@ -0,0 +1,83 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+/**
+该代码实现了带抖动的指数退避重试。
+Retry 最多执行 MaxAttempts 次 fn，每次失败后等待一个在 [0, min(MaxDelay, BaseDelay*2^n)] 之间随机的时间再重试。
+被 Permanent 包装的错误以及 ErrOpen 不会重试，ctx 被取消时立即返回。
+只应对幂等的调用使用 Retry。
+*/
+
+// RetryPolicy 是重试策略
+type RetryPolicy struct {
+	MaxAttempts int           // 最多执行次数，包括第一次
+	BaseDelay   time.Duration // 第一次重试前的最大等待时间
+	MaxDelay    time.Duration // 单次等待时间的上限
+}
+
+// permanentError 表示不应重试、也不计为熔断失败的错误
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent 包装一个不应重试的错误，例如下游服务返回的 4xx 响应
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent 判断错误是否被 Permanent 包装过
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// Retry 按照 policy 重试 fn
+func Retry(ctx context.Context, policy RetryPolicy, fn func(ctx context.Context) error) error {
+	attempts := policy.MaxAttempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	var err error
+	for n := 0; n < attempts; n++ {
+		if n > 0 {
+			timer := time.NewTimer(backoff(policy, n))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+		}
+
+		err = fn(ctx)
+		if err == nil || IsPermanent(err) || errors.Is(err, ErrOpen) || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// 计算第 n 次重试前的等待时间（full jitter）
+func backoff(policy RetryPolicy, n int) time.Duration {
+	d := policy.BaseDelay << (n - 1)
+	if d <= 0 || (policy.MaxDelay > 0 && d > policy.MaxDelay) {
+		d = policy.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
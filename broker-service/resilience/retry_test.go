@@ -0,0 +1,87 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+
+	tests := []struct {
+		name      string
+		policy    RetryPolicy
+		results   []error // 每次调用返回的错误，用完后返回 nil
+		wantCalls int
+		wantErr   error
+	}{
+		{"succeeds first time", policy, nil, 1, nil},
+		{"retries until success", policy, []error{errDown, errDown}, 3, nil},
+		{"gives up after max attempts", policy, []error{errDown, errDown, errDown, errDown}, 3, errDown},
+		{"does not retry permanent errors", policy, []error{Permanent(errRejected)}, 1, errRejected},
+		{"does not retry an open breaker", policy, []error{ErrOpen}, 1, ErrOpen},
+		{"zero attempts runs once", RetryPolicy{}, []error{errDown}, 1, errDown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := Retry(context.Background(), tt.policy, func(ctx context.Context) error {
+				calls++
+				if calls <= len(tt.results) {
+					return tt.results[calls-1]
+				}
+				return nil
+			})
+
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Retry = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryStopsWhenContextIsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}
+
+	calls := 0
+	err := Retry(ctx, policy, func(ctx context.Context) error {
+		calls++
+		cancel()
+		return errDown
+	})
+
+	if !errors.Is(err, errDown) || calls != 1 {
+		t.Errorf("Retry = %v after %d calls, want %v after 1", err, calls, errDown)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		n      int
+		max    time.Duration
+	}{
+		{"first retry", RetryPolicy{BaseDelay: 10 * time.Millisecond}, 1, 10 * time.Millisecond},
+		{"doubles each retry", RetryPolicy{BaseDelay: 10 * time.Millisecond}, 3, 40 * time.Millisecond},
+		{"capped by max delay", RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 15 * time.Millisecond}, 3, 15 * time.Millisecond},
+		{"no delay configured", RetryPolicy{}, 2, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if d := backoff(tt.policy, tt.n); d < 0 || d > tt.max {
+					t.Fatalf("backoff = %s, want between 0 and %s", d, tt.max)
+				}
+			}
+		})
+	}
+}
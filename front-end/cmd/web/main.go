@@ -1,24 +1,74 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves the pages until SIGTERM / SIGINT or a server error, and returns the error that stopped it
+func run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		render(w, "test.page.gohtml")
 	})
+	// 重置密码邮件中的链接，token 作为查询参数
+	mux.HandleFunc("/reset-password", func(w http.ResponseWriter, r *http.Request) {
+		// 页面从 CDN 加载样式，不在 Referer 中把令牌发给第三方
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		render(w, "reset-password.page.gohtml")
+	})
 
 	fmt.Println("Starting front end service on port 8081")
-	err := http.ListenAndServe(":8081", nil)
-	if err != nil {
-		log.Panic(err)
+	srv := &http.Server{
+		Addr:    ":8081",
+		Handler: mux,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-serverErr:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Println("Error shutting down web server:", err)
+	}
+	return err
+}
+
+// shutdownTimeout returns how long to wait for in-flight requests on shutdown, configurable via SHUTDOWN_TIMEOUT
+func shutdownTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil && d > 0 {
+		return d
 	}
+	return 20 * time.Second
 }
 
 //go:embed templates
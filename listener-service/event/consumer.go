@@ -2,33 +2,72 @@ package event
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	amqp "github.com/rabbitmq/amqp091-go"
+	"log"
 	"net/http"
+	"os"
+	"rabbitmq"
+	"strings"
+	"sync"
+	"time"
 )
 
 /**
 该代码定义了一个 Consumer 结构体和一些与消费消息相关的函数。
-NewConsumer 函数用于创建一个新的 Consumer 实例，它接收一个 amqp.Connection 参数，并返回一个 Consumer 实例和一个错误。
-setup 函数用于设置 Consumer，它创建一个 AMQP 通道并调用 declareExchange 函数声明交换机。
-Payload 结构体定义了消息的载荷，具有 Name 和 Data 字段。
-Listen 函数用于监听消息队列中的消息，它创建一个随机队列，并将队列与指定的主题绑定。然后，它通过通道消费消息，并将每个消息的载荷传递给 handlePayload 函数进行处理。
-handlePayload 函数根据消息的名称进行处理。如果名称为 "log" 或 "event"，则调用 logEvent 函数记录事件。否则，不做任何操作。
-logEvent 函数将事件记录到远程日志服务。它将载荷转换为 JSON 格式，并使用 HTTP POST 请求将日志发送到日志服务的 URL。如果请求成功并返回状态码为 202（Accepted），则表示记录成功。否则，返回错误。
+NewConsumer 函数用于创建一个新的 Consumer 实例，它接收一个 ConnectionManager 参数和消费者配置，并返回一个 Consumer 实例和一个错误。
+setup 函数在 ConnectionManager 上注册回调，每次连接（包括重连）成功后都会声明交换机、死信交换机和死信队列。
+Payload 结构体定义了消息的载荷，具有 Name 和 Data 字段，以及可选的 Severity、Service、Host、TraceID 和 Attributes 字段，原样转发给日志服务。
+ID 由 deliveryID 根据消息的 MessageId 和发布时间生成，同一条消息每次投递得到的 ID 相同；日志服务忽略 ID 已经存在的日志，
+因此消息在 store 成功、后续处理器（例如 notify）失败后被重新投递时，不会重复写入日志。
+Listen 函数用于监听消息队列中的消息。同一个消费者组的所有副本共享一个以组名命名的持久化队列，并通过 prefetch（QoS）分摊负载。
+每条消息在 logEvent 成功后才确认（ack）；临时性失败时稍等片刻后 nack 并重新入队；无法解析或被日志服务拒绝的消息直接进入死信队列。
+重新投递超过 MaxRedeliveries 次的消息也会由 RabbitMQ 转入死信队列。
+RabbitMQ 连接或通道断开时，Listen 等待 ConnectionManager 重连成功后重新声明队列和绑定并继续消费，未确认的消息会由 RabbitMQ 重新投递。
+ctx 被取消时，Listen 取消消费者，处理完已经投递到本地的消息并等待所有 handlePayload 返回后才退出。
+handlePayload 函数根据消息的路由键（主题）找到配置的处理器并依次执行（见 handlers.go），没有配置的主题只记录事件；名称为 "auth" 的消息不做任何操作。
+logEvent 函数将事件记录到远程日志服务，可以把事件标记为需要关注。它将载荷转换为 JSON 格式，并使用 HTTP POST 请求将日志发送到日志服务的 URL。如果请求成功并返回状态码为 202（Accepted），则表示记录成功。否则，返回错误。
 该代码使用了 RabbitMQ 的 amqp091-go 包和标准库中的 JSON 和 HTTP 包来实现与 RabbitMQ 和远程日志服务的交互。
 */
 
+const (
+	requeueDelay = time.Second // 临时性失败后重新入队前的等待时间，避免消息在失败时被反复快速投递
+	resumeDelay  = time.Second // 消费中断后重新开始消费前的等待时间
+)
+
+// ConsumerConfig 是消费者的配置
+type ConsumerConfig struct {
+	Group           string // 消费者组，同一组的副本共享一个队列
+	Prefetch        int    // 每个消费者最多同时处理的未确认消息数
+	MaxRedeliveries int    // 最多重新投递次数，超过后进入死信队列
+
+	Topics    map[string][]string // 订阅的主题及每个主题的处理器
+	AlertFrom string              // 告警邮件的发件人
+	AlertTo   string              // 告警邮件的收件人
+}
+
 // Consumer 结构体用于消费消息
 type Consumer struct {
-	conn      *amqp.Connection
-	queueName string
+	manager     *rabbitmq.ConnectionManager
+	config      ConsumerConfig
+	queueName   string
+	consumerTag string
 }
 
 // NewConsumer 函数创建一个新的 Consumer 实例
-func NewConsumer(conn *amqp.Connection) (Consumer, error) {
+func NewConsumer(manager *rabbitmq.ConnectionManager, config ConsumerConfig) (Consumer, error) {
+	hostname, _ := os.Hostname()
 	consumer := Consumer{
-		conn: conn,
+		manager:     manager,
+		config:      config,
+		queueName:   config.Group,
+		consumerTag: fmt.Sprintf("listener-%s-%d", hostname, os.Getpid()),
 	}
 
 	err := consumer.setup()
@@ -39,40 +78,86 @@ func NewConsumer(conn *amqp.Connection) (Consumer, error) {
 	return consumer, nil
 }
 
-// setup 函数用于设置 Consumer
+// setup 函数用于设置 Consumer，每次连接成功后都重新声明交换机和死信队列
 func (consumer *Consumer) setup() error {
-	channel, err := consumer.conn.Channel()
-	if err != nil {
-		return err
-	}
+	return consumer.manager.OnConnect(func(conn *amqp.Connection) error {
+		channel, err := conn.Channel()
+		if err != nil {
+			return err
+		}
+		defer channel.Close()
+
+		if err = declareExchange(channel); err != nil {
+			return err
+		}
 
-	return declareExchange(channel)
+		return declareDeadLetterQueue(channel, consumer.queueName)
+	})
 }
 
 // Payload 结构体定义消息的载荷
 type Payload struct {
-	Name string `json:"name"`
-	Data string `json:"data"`
+	ID         string         `json:"id,omitempty"` // 日志 ID，由 deliveryID 生成，不从消息内容中读取
+	Name       string         `json:"name"`
+	Data       string         `json:"data"`
+	Severity   string         `json:"severity,omitempty"`
+	Service    string         `json:"service,omitempty"`
+	Host       string         `json:"host,omitempty"`
+	TraceID    string         `json:"trace_id,omitempty"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// Listen 函数用于监听配置中所有主题的消息，连接断开后自动恢复消费，直到 ctx 被取消
+func (consumer *Consumer) Listen(ctx context.Context) error {
+	topics := TopicNames(consumer.config.Topics)
+
+	for {
+		conn, err := consumer.manager.Connection(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		err = consumer.consume(ctx, conn, topics)
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.Println("Consumer interrupted, resuming:", err)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(resumeDelay):
+		}
+	}
 }
 
-// Listen 函数用于监听消息队列中的消息
-func (consumer *Consumer) Listen(topics []string) error {
-	ch, err := consumer.conn.Channel()
+// consume 在一个通道上消费消息，直到通道关闭或 ctx 被取消
+func (consumer *Consumer) consume(ctx context.Context, conn *amqp.Connection, topics []string) error {
+	ch, err := conn.Channel()
 	if err != nil {
 		return err
 	}
 	defer ch.Close()
 
-	q, err := declareRandomQueue(ch)
+	// 限制未确认的消息数，使多个副本之间均匀分摊负载
+	err = ch.Qos(consumer.config.Prefetch, 0, false)
+	if err != nil {
+		return err
+	}
+
+	q, err := declareQueue(ch, consumer.queueName, consumer.config.MaxRedeliveries)
 	if err != nil {
 		return err
 	}
 
 	for _, s := range topics {
-		ch.QueueBind(
+		err = ch.QueueBind(
 			q.Name,
 			s,
-			"logs_topic",
+			logsExchange,
 			false,
 			nil,
 		)
@@ -81,48 +166,139 @@ func (consumer *Consumer) Listen(topics []string) error {
 		}
 	}
 
-	messages, err := ch.Consume(q.Name, "", true, false, false, false, nil)
+	// 关闭自动确认，消息处理成功后才确认
+	messages, err := ch.Consume(q.Name, consumer.consumerTag, false, false, false, false, nil)
 	if err != nil {
 		return err
 	}
 
-	forever := make(chan bool)
+	// ctx 被取消时停止接收新消息，RabbitMQ 随后会关闭 messages 通道
+	stopped := make(chan struct{})
+	defer close(stopped)
 	go func() {
-		for d := range messages {
-			var payload Payload
-			_ = json.Unmarshal(d.Body, &payload)
-
-			go handlePayload(payload)
+		select {
+		case <-ctx.Done():
+			_ = ch.Cancel(consumer.consumerTag, false)
+		case <-stopped:
 		}
 	}()
 
-	fmt.Printf("Waiting for message [Exchange,Queue] [logs_topic,%s]\n", q.Name)
-	<-forever
+	fmt.Printf("Waiting for message [Exchange,Queue] [%s,%s]\n", logsExchange, q.Name)
 
-	return nil
+	var wg sync.WaitGroup
+	for d := range messages {
+		wg.Add(1)
+		go func(d amqp.Delivery) {
+			defer wg.Done()
+			consumer.handleDelivery(d)
+		}(d)
+	}
+
+	// 等待所有已经收到的消息处理完成
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	return errors.New("message channel closed")
 }
 
-// handlePayload 函数处理消息的载荷
-func handlePayload(payload Payload) {
-	switch payload.Name {
-	case "log", "event":
-		// log whatever we get
-		err := logEvent(payload)
-		if err != nil {
-			fmt.Println(err)
-		}
-	case "auth":
+// handleDelivery 处理一条消息，并根据处理结果确认或拒绝消息
+func (consumer *Consumer) handleDelivery(d amqp.Delivery) {
+	var payload Payload
+	err := json.Unmarshal(d.Body, &payload)
+	if err != nil {
+		err = permanent(fmt.Errorf("malformed payload: %w", err))
+	} else {
+		payload.ID = deliveryID(d)
+		err = consumer.handlePayload(d.RoutingKey, payload)
+	}
+
+	switch {
+	case err == nil:
+		_ = d.Ack(false)
+	case isPermanent(err):
+		// 无法处理的消息，直接进入死信队列
+		log.Printf("dead-lettering message %s: %v", d.RoutingKey, err)
+		_ = d.Nack(false, false)
 	default:
-		err := logEvent(payload)
-		if err != nil {
-			fmt.Println(err)
+		// 临时性失败，稍后重新入队
+		log.Printf("requeueing message %s: %v", d.RoutingKey, err)
+		time.Sleep(requeueDelay)
+		_ = d.Nack(false, true)
+	}
+}
+
+// deliveryID 根据消息的 MessageId 生成日志 ID（MongoDB ObjectID 的十六进制表示），重新投递的消息得到相同的 ID。
+// 前 4 个字节是消息的发布时间（秒），与 ObjectID 的格式一致，其余 8 个字节取自 MessageId 的 SHA-256；
+// 旧版本的 broker 不设置 MessageId，此时返回空字符串，由日志服务生成 ID
+func deliveryID(d amqp.Delivery) string {
+	if d.MessageId == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(d.MessageId))
+	var id [12]byte
+	if d.Timestamp.IsZero() {
+		copy(id[:], sum[:12])
+	} else {
+		binary.BigEndian.PutUint32(id[:4], uint32(d.Timestamp.Unix()))
+		copy(id[4:], sum[:8])
+	}
+	return hex.EncodeToString(id[:])
+}
+
+// handlePayload 函数按主题处理消息的载荷
+func (consumer *Consumer) handlePayload(topic string, payload Payload) error {
+	if payload.Name == "auth" {
+		return nil
+	}
+
+	// 旧版本的 broker 不发送日志级别，从路由键中取出
+	if payload.Severity == "" {
+		payload.Severity = strings.TrimPrefix(topic, "log.")
+	}
+
+	names, ok := consumer.config.Topics[topic]
+	if !ok {
+		// log whatever we get
+		return logEvent(payload, false)
+	}
+
+	for _, name := range names {
+		if err := handlers[name](consumer, payload); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
 		}
 	}
+	return nil
 }
 
-// logEvent 函数记录事件
-func logEvent(entry Payload) error {
-	jsonData, _ := json.MarshalIndent(entry, "", "\t")
+// permanentError 表示重试也无法成功的错误
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+func isPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// 发送日志请求使用的共享 HTTP 客户端
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// logEvent 函数记录事件，flagged 为 true 时把事件标记为需要关注
+func logEvent(entry Payload, flagged bool) error {
+	jsonData, _ := json.MarshalIndent(struct {
+		Payload
+		Flagged bool `json:"flagged,omitempty"`
+	}{entry, flagged}, "", "\t")
 
 	logServiceUrl := "http://logger-service/log"
 
@@ -133,17 +309,19 @@ func logEvent(entry Payload) error {
 
 	request.Header.Set("Content-Type", "application/json")
 
-	client := http.Client{}
-
 	response, err := client.Do(request)
 	if err != nil {
 		return err
 	}
 	defer response.Body.Close()
 
-	if response.StatusCode != http.StatusAccepted {
-		return err
+	switch {
+	case response.StatusCode == http.StatusAccepted:
+		return nil
+	case response.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("logger service returned status %d", response.StatusCode)
+	default:
+		// 日志服务拒绝了这条日志，重试也不会成功
+		return permanent(fmt.Errorf("logger service rejected entry with status %d", response.StatusCode))
 	}
-
-	return nil
 }
@@ -2,9 +2,14 @@ package event
 
 import amqp "github.com/rabbitmq/amqp091-go"
 
+const (
+	logsExchange       = "logs_topic" // 日志事件交换机
+	deadLetterExchange = "logs_dlx"   // 死信交换机
+)
+
 func declareExchange(ch *amqp.Channel) error {
 	return ch.ExchangeDeclare(
-		"logs_topic", // name
+		logsExchange, // name
 		"topic",      //type
 		true,         //durable?
 		false,        // auto-delted?
@@ -14,13 +19,50 @@ func declareExchange(ch *amqp.Channel) error {
 	)
 }
 
-func declareRandomQueue(ch *amqp.Channel) (amqp.Queue, error) {
+// declareQueue declares a durable quorum queue shared by every replica of a consumer group.
+// Messages that are rejected, or redelivered more than maxRedeliveries times, go to the dead-letter exchange.
+func declareQueue(ch *amqp.Channel, name string, maxRedeliveries int) (amqp.Queue, error) {
 	return ch.QueueDeclare(
-		"",    // name
-		false, //durable?
+		name,  // name
+		true,  //durable?
 		false, //delete when unused?
-		true,  //exclusive?
+		false, //exclusive?
 		false, // no-wait?
-		nil,   //arguments?
+		amqp.Table{
+			"x-queue-type":              "quorum",
+			"x-delivery-limit":          maxRedeliveries,
+			"x-dead-letter-exchange":    deadLetterExchange,
+			"x-dead-letter-routing-key": name,
+		},
 	)
 }
+
+// declareDeadLetterQueue declares the dead-letter exchange and the <name>.dead queue that keeps poison messages for inspection
+func declareDeadLetterQueue(ch *amqp.Channel, name string) error {
+	err := ch.ExchangeDeclare(
+		deadLetterExchange, // name
+		"direct",           //type
+		true,               //durable?
+		false,              // auto-delted?
+		false,              // internal?
+		false,              //no-wait?
+		nil,                //arguments?
+	)
+	if err != nil {
+		return err
+	}
+
+	dead, err := ch.QueueDeclare(
+		name+".dead", // name
+		true,         //durable?
+		false,        //delete when unused?
+		false,        //exclusive?
+		false,        // no-wait?
+		nil,          //arguments?
+	)
+	if err != nil {
+		return err
+	}
+
+	return ch.QueueBind(dead.Name, name, deadLetterExchange, false, nil)
+}
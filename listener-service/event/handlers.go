@@ -0,0 +1,152 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+/**
+该代码定义了按路由键（主题）处理日志事件的处理器。
+每个主题对应一个或多个按名称注册的处理器，按顺序执行，任意一个失败时整条消息按失败处理：
+store 把日志写入日志服务；flag 把日志写入日志服务并标记为需要关注；notify 通过 mail-service 发送告警邮件。
+默认配置下 log.INFO 只写入日志，log.WARNING 写入并标记，log.ERROR 写入并发送告警邮件。
+ParseTopics 解析形如 "log.INFO=store;log.WARNING=flag;log.ERROR=store,notify" 的配置，用于通过环境变量覆盖默认配置。
+消息可能被重新投递，因此处理器需要能够容忍重复执行：store 和 flag 使用由消息生成的固定 ID 写入日志（见 deliveryID），重复写入会被日志服务忽略。
+*/
+
+// Handler 处理一条日志事件
+type Handler func(consumer *Consumer, payload Payload) error
+
+// 所有可用的处理器
+var handlers = map[string]Handler{
+	"store":  storeLog,
+	"flag":   flagLog,
+	"notify": notifyMail,
+}
+
+// DefaultTopics 返回默认的主题与处理器映射
+func DefaultTopics() map[string][]string {
+	return map[string][]string{
+		"log.INFO":    {"store"},
+		"log.WARNING": {"flag"},
+		"log.ERROR":   {"store", "notify"},
+	}
+}
+
+// ParseTopics 解析主题与处理器映射，例如 "log.INFO=store;log.ERROR=store,notify"
+func ParseTopics(s string) (map[string][]string, error) {
+	topics := make(map[string][]string)
+	for _, item := range strings.Split(s, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		topic, names, ok := strings.Cut(item, "=")
+		topic = strings.TrimSpace(topic)
+		if !ok || topic == "" {
+			return nil, fmt.Errorf("invalid topic mapping %q", item)
+		}
+
+		for _, name := range strings.Split(names, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if _, ok := handlers[name]; !ok {
+				return nil, fmt.Errorf("unknown handler %q for topic %s", name, topic)
+			}
+			topics[topic] = append(topics[topic], name)
+		}
+		if len(topics[topic]) == 0 {
+			return nil, fmt.Errorf("no handlers for topic %s", topic)
+		}
+	}
+
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("no topics configured")
+	}
+	return topics, nil
+}
+
+// TopicNames 返回映射中按名称排序的所有主题
+func TopicNames(topics map[string][]string) []string {
+	names := make([]string, 0, len(topics))
+	for topic := range topics {
+		names = append(names, topic)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 写入日志
+func storeLog(_ *Consumer, payload Payload) error {
+	return logEvent(payload, false)
+}
+
+// 写入日志并标记为需要关注
+func flagLog(_ *Consumer, payload Payload) error {
+	return logEvent(payload, true)
+}
+
+// 通过 mail-service 发送告警邮件
+func notifyMail(consumer *Consumer, payload Payload) error {
+	msg := struct {
+		From    string `json:"from"`
+		To      string `json:"to"`
+		Subject string `json:"subject"`
+		Message string `json:"message"`
+	}{
+		From:    consumer.config.AlertFrom,
+		To:      consumer.config.AlertTo,
+		Subject: fmt.Sprintf("[%s] %s", payload.Severity, payload.Name),
+		Message: alertMessage(payload),
+	}
+
+	jsonData, _ := json.Marshal(msg)
+
+	mailServiceURL := "http://mailer-service/send"
+
+	request, err := http.NewRequest("POST", mailServiceURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusAccepted:
+		return nil
+	case response.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("mail service returned status %d", response.StatusCode)
+	default:
+		// 邮件服务拒绝了这封邮件，重试也不会成功
+		return permanent(fmt.Errorf("mail service rejected alert with status %d", response.StatusCode))
+	}
+}
+
+// 告警邮件的正文，包含日志的来源和链路 ID
+func alertMessage(payload Payload) string {
+	var b strings.Builder
+	b.WriteString(payload.Data)
+	for _, field := range []struct{ name, value string }{
+		{"service", payload.Service},
+		{"host", payload.Host},
+		{"trace id", payload.TraceID},
+	} {
+		if field.value != "" {
+			fmt.Fprintf(&b, "\n%s: %s", field.name, field.value)
+		}
+	}
+	return b.String()
+}
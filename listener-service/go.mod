@@ -2,4 +2,8 @@ module listener
 
 go 1.20
 
-require github.com/rabbitmq/amqp091-go v1.8.1 // indirect
+require github.com/rabbitmq/amqp091-go v1.8.1
+
+require rabbitmq v0.0.0
+
+replace rabbitmq => ../rabbitmq
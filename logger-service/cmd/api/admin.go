@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log-service/data"
+	"net/http"
+	"strings"
+)
+
+/**
+该代码定义了归档任务的管理接口。
+ListArchiveRuns 处理 GET /admin/archive/runs 请求，返回最近的归档记录以及当前的归档配置。
+TriggerArchive 处理 POST /admin/archive/runs 请求，在后台启动一次归档并返回 202 和本次归档的记录，结果通过 GET /admin/archive/runs 查看；
+归档不使用请求的 context，调用方断开连接不会中断归档；已经有归档任务在运行时返回 409。
+没有配置 ARCHIVE_AFTER 时归档被禁用，两个接口都返回 503。
+管理接口需要 Authorization: Bearer <ADMIN_TOKEN> 请求头（见 requireAdminToken），没有配置 ADMIN_TOKEN 时管理接口被禁用，返回 503。
+*/
+
+var (
+	errArchiveDisabled = errors.New("archival is disabled, set ARCHIVE_AFTER to enable it")
+	errAdminDisabled   = errors.New("the admin API is disabled, set ADMIN_TOKEN to enable it")
+	errAdminToken      = errors.New("a valid admin token is required")
+)
+
+// requireAdminToken 只允许携带 ADMIN_TOKEN 的请求访问管理接口
+func (app *Config) requireAdminToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.AdminToken == "" {
+			app.errorJson(w, errAdminDisabled, http.StatusServiceUnavailable)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(app.AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="logger-admin"`)
+			app.errorJson(w, errAdminToken, http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ListArchiveRuns 返回最近的归档记录
+func (app *Config) ListArchiveRuns(w http.ResponseWriter, r *http.Request) {
+	if app.Archiver == nil {
+		app.errorJson(w, errArchiveDisabled, http.StatusServiceUnavailable)
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("archiving logs older than %s every %s to %s", app.Archiver.After, app.Archiver.Interval, app.Archiver.Dir),
+		Data:    app.Archiver.Runs(),
+	}
+
+	app.writeJson(w, http.StatusOK, resp)
+}
+
+// TriggerArchive 在后台启动一次归档
+func (app *Config) TriggerArchive(w http.ResponseWriter, r *http.Request) {
+	if app.Archiver == nil {
+		app.errorJson(w, errArchiveDisabled, http.StatusServiceUnavailable)
+		return
+	}
+
+	run, err := app.Archiver.Trigger("manual")
+	if errors.Is(err, data.ErrArchiveRunning) {
+		app.errorJson(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		app.errorJson(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("started archival run %d", run.ID),
+		Data:    run,
+	}
+
+	app.writeJson(w, http.StatusAccepted, resp)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"log-service/data"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAdminRoutesRequireToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		adminToken    string
+		authorization string
+		wantStatus    int
+	}{
+		{"admin API disabled", "", "Bearer secret", http.StatusServiceUnavailable},
+		{"missing token", "secret", "", http.StatusUnauthorized},
+		{"wrong scheme", "secret", "Basic secret", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer guess", http.StatusUnauthorized},
+		{"valid token", "secret", "Bearer secret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &Config{
+				Archiver:   data.NewArchiver(data.NewMemoryStore(), t.TempDir(), time.Hour, time.Hour),
+				AdminToken: tt.adminToken,
+			}
+
+			r := httptest.NewRequest("GET", "/admin/archive/runs", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			app.routes().ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestTriggerArchiveOutlivesRequest(t *testing.T) {
+	archiver := data.NewArchiver(data.NewMemoryStore(), t.TempDir(), time.Hour, time.Hour)
+	app := &Config{Archiver: archiver, AdminToken: "secret"}
+
+	// 请求的 context 在处理器返回之前已经取消
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest("POST", "/admin/archive/runs", nil).WithContext(ctx)
+	r.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	app.routes().ServeHTTP(w, r)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+
+	archiver.Wait()
+	runs := archiver.Runs()
+	if len(runs) != 1 || runs[0].Error != "" {
+		t.Fatalf("runs = %+v, want one successful run", runs)
+	}
+}
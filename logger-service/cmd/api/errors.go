@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log-service/data"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+/**
+该代码定义了 LogService 返回的错误在三种传输方式中的表示，使同一个错误在 HTTP、net/rpc 和 gRPC 中含义一致。
+classify 先把错误归为一类，再由 httpStatus、grpcError 和 rpcError 分别转换为 HTTP 状态码、gRPC 状态码和带类别前缀的 RPC 错误：
+校验失败、无效的 ID 或游标对应 400 和 InvalidArgument；日志不存在对应 404 和 NotFound；
+写入队列已满对应 503 和 ResourceExhausted；Writer 已关闭对应 503 和 Unavailable；
+调用方取消或超时对应 504 和 Canceled 或 DeadlineExceeded；其他错误对应 500 和 Internal。
+*/
+
+type errorKind int
+
+const (
+	kindInternal errorKind = iota
+	kindInvalid
+	kindNotFound
+	kindExhausted
+	kindUnavailable
+	kindTimeout
+)
+
+// 把 LogService 返回的错误归类
+func classify(err error) errorKind {
+	switch {
+	case errors.Is(err, data.ErrInvalidLog), errors.Is(err, data.ErrInvalidID), errors.Is(err, data.ErrInvalidCursor):
+		return kindInvalid
+	case errors.Is(err, data.ErrNotFound):
+		return kindNotFound
+	case errors.Is(err, data.ErrQueueFull):
+		return kindExhausted
+	case errors.Is(err, data.ErrWriterClosed):
+		return kindUnavailable
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return kindTimeout
+	default:
+		return kindInternal
+	}
+}
+
+// 错误对应的 HTTP 状态码
+func httpStatus(err error) int {
+	switch classify(err) {
+	case kindInvalid:
+		return http.StatusBadRequest
+	case kindNotFound:
+		return http.StatusNotFound
+	case kindExhausted, kindUnavailable:
+		return http.StatusServiceUnavailable
+	case kindTimeout:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// 把错误转换为对应的 gRPC 状态
+func grpcError(err error) error {
+	switch classify(err) {
+	case kindInvalid:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case kindNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case kindExhausted:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case kindUnavailable:
+		return status.Error(codes.Unavailable, err.Error())
+	case kindTimeout:
+		return status.FromContextError(err).Err()
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// net/rpc 只能传递错误信息，在信息前加上错误类别，方便调用方区分
+func rpcError(err error) error {
+	prefix := map[errorKind]string{
+		kindInvalid:     "invalid argument",
+		kindNotFound:    "not found",
+		kindExhausted:   "resource exhausted",
+		kindUnavailable: "unavailable",
+		kindTimeout:     "deadline exceeded",
+		kindInternal:    "internal",
+	}[classify(err)]
+	return fmt.Errorf("%s: %w", prefix, err)
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log-service/data"
+	"log-service/logs"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protodelim"
+)
+
+/**
+该代码定义了日志的导出接口。
+ExportLogs 处理 GET /logs/export 请求，按与 GET /logs 相同的查询参数过滤日志，以流的方式逐条写入响应，不会把结果全部加载到内存中：
+format 是导出格式：ndjson（默认，每行一条 JSON）、csv（第一行是列名，attributes 以 JSON 字符串保存）
+或 protodelim（长度前缀的 protobuf Log 消息，可以用 protodelim.UnmarshalFrom 逐条读取，再通过 gRPC 的 WriteLogs 重新导入；Log 不包含 ID 和时间）；
+gzip=true 时导出 gzip 压缩的文件；limit 是最多导出的条数，不指定时导出所有匹配的日志；sort=asc 时按创建时间升序导出。
+响应头在写入第一条日志时才发送，因此开始导出之前的错误仍然以 JSON 错误响应返回；导出过程中发生错误时中断连接，客户端会收到不完整的响应。
+*/
+
+const exportFlushEvery = 1000 // 每导出多少条日志把缓冲区写入连接一次
+
+// 一种导出格式
+type exportFormat struct {
+	contentType string
+	extension   string
+	newEncoder  func(w io.Writer) exportEncoder
+}
+
+var exportFormats = map[string]exportFormat{
+	"ndjson":     {"application/x-ndjson", "ndjson", newNDJSONEncoder},
+	"csv":        {"text/csv; charset=utf-8", "csv", newCSVEncoder},
+	"protodelim": {"application/x-protobuf", "pb", newProtoEncoder},
+}
+
+// exportEncoder 把日志逐条编码为导出格式
+type exportEncoder interface {
+	Encode(entry *data.LogEntry) error
+	Flush() error
+}
+
+// 达到 limit 时停止导出
+var errExportLimit = errors.New("export limit reached")
+
+// ExportLogs 方法按查询参数导出日志
+func (app *Config) ExportLogs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter, err := filterFromQuery(q)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+	limit := filter.Limit
+	filter.Limit = 0
+
+	name := q.Get("format")
+	if name == "" {
+		name = "ndjson"
+	}
+	format, ok := exportFormats[name]
+	if !ok {
+		app.errorJson(w, fmt.Errorf("invalid format %q, expected ndjson, csv or protodelim", name))
+		return
+	}
+
+	compress := false
+	if v := q.Get("gzip"); v != "" {
+		if compress, err = strconv.ParseBool(v); err != nil {
+			app.errorJson(w, fmt.Errorf("invalid gzip %q", v))
+			return
+		}
+	}
+
+	out := &exportWriter{w: w, format: format, compress: compress}
+	var n int
+	err = app.Service.Export(r.Context(), filter, func(entry *data.LogEntry) error {
+		if limit > 0 && n >= limit {
+			return errExportLimit
+		}
+		if err := out.encode(entry); err != nil {
+			return err
+		}
+		n++
+		if n%exportFlushEvery == 0 {
+			return out.flush()
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errExportLimit) {
+		if !out.started {
+			app.errorJson(w, err, httpStatus(err))
+			return
+		}
+		// 响应已经开始，只能中断连接
+		log.Printf("Error exporting logs after %d entries: %v", n, err)
+		panic(http.ErrAbortHandler)
+	}
+
+	if err := out.close(); err != nil {
+		log.Printf("Error finishing log export after %d entries: %v", n, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// exportWriter 在写入第一条日志时发送响应头，并按需压缩
+type exportWriter struct {
+	w        http.ResponseWriter
+	format   exportFormat
+	compress bool
+
+	started bool
+	buf     *bufio.Writer
+	zw      *gzip.Writer
+	enc     exportEncoder
+}
+
+func (e *exportWriter) start() {
+	e.started = true
+
+	filename := fmt.Sprintf("logs-%s.%s", time.Now().UTC().Format("20060102T150405Z"), e.format.extension)
+	if e.compress {
+		filename += ".gz"
+		e.w.Header().Set("Content-Type", "application/gzip")
+	} else {
+		e.w.Header().Set("Content-Type", e.format.contentType)
+	}
+	e.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	e.w.WriteHeader(http.StatusOK)
+
+	e.buf = bufio.NewWriterSize(e.w, 32<<10)
+	var dst io.Writer = e.buf
+	if e.compress {
+		e.zw = gzip.NewWriter(e.buf)
+		dst = e.zw
+	}
+	e.enc = e.format.newEncoder(dst)
+}
+
+func (e *exportWriter) encode(entry *data.LogEntry) error {
+	if !e.started {
+		e.start()
+	}
+	return e.enc.Encode(entry)
+}
+
+// 把已经编码的日志写入连接
+func (e *exportWriter) flush() error {
+	if err := e.enc.Flush(); err != nil {
+		return err
+	}
+	if e.zw != nil {
+		if err := e.zw.Flush(); err != nil {
+			return err
+		}
+	}
+	if err := e.buf.Flush(); err != nil {
+		return err
+	}
+	if f, ok := e.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// 写入剩余的数据，没有匹配的日志时也返回一个空文件（csv 只有列名）
+func (e *exportWriter) close() error {
+	if !e.started {
+		e.start()
+	}
+	if err := e.enc.Flush(); err != nil {
+		return err
+	}
+	if e.zw != nil {
+		if err := e.zw.Close(); err != nil {
+			return err
+		}
+	}
+	return e.buf.Flush()
+}
+
+// NDJSON：每行一条 JSON，与 GET /logs 返回的日志格式相同
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func newNDJSONEncoder(w io.Writer) exportEncoder {
+	return &ndjsonEncoder{enc: json.NewEncoder(w)}
+}
+
+func (e *ndjsonEncoder) Encode(entry *data.LogEntry) error {
+	return e.enc.Encode(entry)
+}
+
+func (e *ndjsonEncoder) Flush() error {
+	return nil
+}
+
+// CSV 的列
+var csvHeader = []string{"id", "created_at", "name", "severity", "service", "host", "trace_id", "flagged", "data", "attributes"}
+
+type csvEncoder struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func newCSVEncoder(w io.Writer) exportEncoder {
+	return &csvEncoder{w: csv.NewWriter(w)}
+}
+
+func (e *csvEncoder) writeHeader() error {
+	if e.headerWritten {
+		return nil
+	}
+	e.headerWritten = true
+	return e.w.Write(csvHeader)
+}
+
+func (e *csvEncoder) Encode(entry *data.LogEntry) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+
+	attributes := ""
+	if len(entry.Attributes) > 0 {
+		raw, err := json.Marshal(plainMap(entry.Attributes))
+		if err != nil {
+			return err
+		}
+		attributes = string(raw)
+	}
+
+	return e.w.Write([]string{
+		entry.ID,
+		entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+		entry.Name,
+		entry.Severity,
+		entry.Service,
+		entry.Host,
+		entry.TraceID,
+		strconv.FormatBool(entry.Flagged),
+		entry.Data,
+		attributes,
+	})
+}
+
+func (e *csvEncoder) Flush() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// 长度前缀的 protobuf Log 消息，与写入日志时使用的消息相同
+type protoEncoder struct {
+	w io.Writer
+}
+
+func newProtoEncoder(w io.Writer) exportEncoder {
+	return &protoEncoder{w: w}
+}
+
+func (e *protoEncoder) Encode(entry *data.LogEntry) error {
+	record := toRecord(entry)
+	_, err := protodelim.MarshalTo(e.w, &logs.Log{
+		Name:       record.Name,
+		Data:       record.Data,
+		Severity:   record.Severity,
+		Service:    record.Service,
+		Host:       record.Host,
+		TraceId:    record.TraceId,
+		Attributes: record.Attributes,
+	})
+	return err
+}
+
+func (e *protoEncoder) Flush() error {
+	return nil
+}
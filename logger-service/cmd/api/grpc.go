@@ -2,32 +2,43 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"io"
 	"log"
 	"log-service/data"
 	"log-service/logs"
 	"net"
+	"time"
 )
 
+const tailBuffer = 256 // 每个 TailLogs 订阅者的缓冲区大小，客户端跟不上时多余的日志会被丢弃
+
+const maxReportedErrors = 100 // WriteLogs 响应中最多列出的拒绝原因，其余的只计入 rejected
+
 type LogServer struct {
 	logs.UnimplementedLogServiceServer
-	Models data.Models
+	Models  data.Models
+	Service *data.LogService
 }
 
 func (l *LogServer) WriteLog(ctx context.Context, req *logs.LogRequest) (*logs.LogResponse, error) {
 	input := req.GetLogEntry()
-
-	// write a log
-	logEntry := data.LogEntry{
-		Name: input.Name,
-		Data: input.Data,
+	if input == nil {
+		return &logs.LogResponse{Result: "failed"}, status.Error(codes.InvalidArgument, "log_entry is required")
 	}
 
-	err := l.Models.LogEntry.Insert(logEntry)
+	// write a log
+	err := l.Service.Write(ctx, fromLog(input))
 	if err != nil {
 		res := &logs.LogResponse{Result: "failed"}
-		return res, err
+		return res, grpcError(err)
 	}
 
 	// return response
@@ -35,19 +46,279 @@ func (l *LogServer) WriteLog(ctx context.Context, req *logs.LogRequest) (*logs.L
 	return res, nil
 }
 
-func (app *Config) gRPCListen() {
+// WriteLogs 接收客户端流中的所有日志并放入写入队列，返回接受和拒绝的条数
+// errors 最多列出前 maxReportedErrors 条拒绝原因，超过时最后追加一条说明没有列出的条数，避免响应随流的长度无限增长
+func (l *LogServer) WriteLogs(stream logs.LogService_WriteLogsServer) error {
+	res := &logs.WriteLogsResponse{}
+	for {
+		input, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			if omitted := res.Rejected - maxReportedErrors; omitted > 0 {
+				res.Errors = append(res.Errors, fmt.Sprintf("%d more rejected entries not listed", omitted))
+			}
+			return stream.SendAndClose(res)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = l.Service.Write(stream.Context(), fromLog(input))
+		if err != nil {
+			res.Rejected++
+			if res.Rejected <= maxReportedErrors {
+				res.Errors = append(res.Errors, fmt.Sprintf("entry %d: %v", res.Accepted+res.Rejected, err))
+			}
+			continue
+		}
+		res.Accepted++
+	}
+}
+
+// TailLogs 把之后写入的、匹配条件的日志实时推送给客户端，直到客户端取消或服务关闭
+func (l *LogServer) TailLogs(req *logs.TailLogsRequest, stream logs.LogService_TailLogsServer) error {
+	sub := l.Models.LogEntry.Subscribe(data.Filter{
+		Name:     req.GetName(),
+		Severity: req.GetSeverity(),
+		Service:  req.GetService(),
+		TraceID:  req.GetTraceId(),
+		Query:    req.GetQuery(),
+	}, tailBuffer)
+	defer l.Models.LogEntry.Unsubscribe(sub)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case entry, ok := <-sub.C:
+			if !ok {
+				return status.Error(codes.Unavailable, "log service is shutting down")
+			}
+			if err := stream.Send(toRecord(entry)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ListLogs 按条件分页查询日志
+func (l *LogServer) ListLogs(ctx context.Context, req *logs.ListLogsRequest) (*logs.ListLogsResponse, error) {
+	filter := data.Filter{
+		Name:      req.GetName(),
+		Severity:  req.GetSeverity(),
+		Service:   req.GetService(),
+		TraceID:   req.GetTraceId(),
+		Query:     req.GetQuery(),
+		Cursor:    req.GetCursor(),
+		Limit:     int(req.GetLimit()),
+		Ascending: req.GetAscending(),
+	}
+	if req.From != nil {
+		filter.From = req.GetFrom().AsTime()
+	}
+	if req.To != nil {
+		filter.To = req.GetTo().AsTime()
+	}
+
+	page, err := l.Service.Find(ctx, filter)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	res := &logs.ListLogsResponse{NextCursor: page.NextCursor}
+	for _, entry := range page.Logs {
+		res.Logs = append(res.Logs, toRecord(entry))
+	}
+	return res, nil
+}
+
+// GetLog 按 ID 查询一条日志
+func (l *LogServer) GetLog(ctx context.Context, req *logs.GetLogRequest) (*logs.LogRecord, error) {
+	entry, err := l.Service.Get(ctx, req.GetId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return toRecord(entry), nil
+}
+
+// AggregateLogs 按条件分组统计日志条数
+func (l *LogServer) AggregateLogs(ctx context.Context, req *logs.AggregateLogsRequest) (*logs.AggregateLogsResponse, error) {
+	aggregation := data.Aggregation{
+		Filter: data.Filter{
+			Name:     req.GetName(),
+			Severity: req.GetSeverity(),
+			Service:  req.GetService(),
+		},
+		GroupBy:  req.GetGroupBy(),
+		Interval: req.GetInterval(),
+		Top:      int(req.GetTop()),
+	}
+	if req.From != nil {
+		aggregation.Filter.From = req.GetFrom().AsTime()
+	}
+	if req.To != nil {
+		aggregation.Filter.To = req.GetTo().AsTime()
+	}
+
+	buckets, err := l.Service.Aggregate(ctx, aggregation)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	res := &logs.AggregateLogsResponse{}
+	for _, b := range buckets {
+		bucket := &logs.LogBucket{Group: b.Group, Count: b.Count}
+		if b.Time != nil {
+			bucket.Time = timestamppb.New(*b.Time)
+		}
+		res.Buckets = append(res.Buckets, bucket)
+	}
+	return res, nil
+}
+
+// GetAuthStats 返回登录的成功率
+func (l *LogServer) GetAuthStats(ctx context.Context, req *logs.AuthStatsRequest) (*logs.AuthStatsResponse, error) {
+	var from, to time.Time
+	if req.From != nil {
+		from = req.GetFrom().AsTime()
+	}
+	if req.To != nil {
+		to = req.GetTo().AsTime()
+	}
+
+	stats, err := l.Service.AuthStats(ctx, from, to, req.GetInterval())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	res := &logs.AuthStatsResponse{
+		Success:     stats.Success,
+		Failure:     stats.Failure,
+		SuccessRate: stats.SuccessRate,
+	}
+	for _, b := range stats.Buckets {
+		res.Buckets = append(res.Buckets, &logs.AuthStatsBucket{
+			Time:        timestamppb.New(b.Time),
+			Success:     b.Success,
+			Failure:     b.Failure,
+			SuccessRate: b.SuccessRate,
+		})
+	}
+	return res, nil
+}
+
+// 把 protobuf 的 Log 转换为 data.LogEntry
+func fromLog(input *logs.Log) data.LogEntry {
+	entry := data.LogEntry{
+		Name:     input.GetName(),
+		Data:     input.GetData(),
+		Severity: input.GetSeverity(),
+		Service:  input.GetService(),
+		Host:     input.GetHost(),
+		TraceID:  input.GetTraceId(),
+	}
+	if input.Attributes != nil {
+		entry.Attributes = input.GetAttributes().AsMap()
+	}
+	return entry
+}
+
+func toRecord(entry *data.LogEntry) *logs.LogRecord {
+	record := &logs.LogRecord{
+		Id:        entry.ID,
+		Name:      entry.Name,
+		Data:      entry.Data,
+		Severity:  entry.Severity,
+		Flagged:   entry.Flagged,
+		Service:   entry.Service,
+		Host:      entry.Host,
+		TraceId:   entry.TraceID,
+		CreatedAt: timestamppb.New(entry.CreatedAt),
+		UpdatedAt: timestamppb.New(entry.UpdatedAt),
+	}
+
+	if len(entry.Attributes) > 0 {
+		attributes, err := structpb.NewStruct(plainMap(entry.Attributes))
+		if err != nil {
+			log.Printf("log %s: cannot convert attributes: %v", entry.ID, err)
+		} else {
+			record.Attributes = attributes
+		}
+	}
+	return record
+}
+
+// 把从 MongoDB 读出的属性转换为 structpb 支持的普通 Go 类型
+func plainMap(m map[string]any) map[string]any {
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = plainValue(v)
+	}
+	return out
+}
+
+func plainValue(v any) any {
+	switch v := v.(type) {
+	case primitive.M:
+		return plainMap(v)
+	case primitive.D:
+		return plainMap(v.Map())
+	case map[string]any:
+		return plainMap(v)
+	case primitive.A:
+		return plainValue([]any(v))
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = plainValue(item)
+		}
+		return out
+	case primitive.DateTime:
+		return v.Time().UTC().Format(time.RFC3339Nano)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case primitive.ObjectID:
+		return v.Hex()
+	case primitive.Decimal128:
+		return v.String()
+	default:
+		return v
+	}
+}
+
+// gRPCListen 在后台启动 gRPC 服务器，返回的服务器用于优雅关闭，服务器出错时把错误发送到 serverErr
+func (app *Config) gRPCListen(serverErr chan<- error) (*grpc.Server, error) {
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", gRpcPort))
 	if err != nil {
-		log.Fatalf("Failed to listen for gRPC : %v", err)
+		return nil, fmt.Errorf("failed to listen for gRPC: %w", err)
 	}
 
 	s := grpc.NewServer()
 
-	logs.RegisterLogServiceServer(s, &LogServer{Models: app.Models})
+	logs.RegisterLogServiceServer(s, &LogServer{Models: app.Models, Service: app.Service})
 
 	log.Printf("gRPC Server started on port %s", gRpcPort)
 
-	if err := s.Serve(lis); err != nil {
-		log.Fatalf("Failed to listen for gRPC: %v", err)
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			serverErr <- fmt.Errorf("gRPC server: %w", err)
+		}
+	}()
+
+	return s, nil
+}
+
+// gracefulStopGRPC 等待进行中的 gRPC 调用完成，超过 ctx 的期限后强制关闭
+func gracefulStopGRPC(ctx context.Context, s *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Println("gRPC graceful stop timed out, forcing stop")
+		s.Stop()
 	}
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log-service/data"
+	"log-service/logs"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+// 依次返回 entries 的 WriteLogs 客户端流
+type fakeWriteLogsStream struct {
+	grpc.ServerStream
+	entries []*logs.Log
+	res     *logs.WriteLogsResponse
+}
+
+func (s *fakeWriteLogsStream) Context() context.Context { return context.Background() }
+
+func (s *fakeWriteLogsStream) Recv() (*logs.Log, error) {
+	if len(s.entries) == 0 {
+		return nil, io.EOF
+	}
+	entry := s.entries[0]
+	s.entries = s.entries[1:]
+	return entry, nil
+}
+
+func (s *fakeWriteLogsStream) SendAndClose(res *logs.WriteLogsResponse) error {
+	s.res = res
+	return nil
+}
+
+func TestWriteLogsCapsReportedErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		invalid    int
+		wantErrors int
+		wantLast   string
+	}{
+		{"a few rejected entries", 3, 3, "entry 3: invalid name: name is required"},
+		{"exactly the limit", maxReportedErrors, maxReportedErrors, fmt.Sprintf("entry %d: invalid name: name is required", maxReportedErrors)},
+		{"over the limit", maxReportedErrors + 50, maxReportedErrors + 1, "50 more rejected entries not listed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 没有名称的日志在校验时被拒绝，不会进入写入队列
+			stream := &fakeWriteLogsStream{}
+			for i := 0; i < tt.invalid; i++ {
+				stream.entries = append(stream.entries, &logs.Log{Data: "missing name"})
+			}
+			server := &LogServer{Service: data.NewLogService(data.Models{}, data.ValidationRules{})}
+
+			if err := server.WriteLogs(stream); err != nil {
+				t.Fatal(err)
+			}
+			if got := stream.res.GetRejected(); got != int64(tt.invalid) {
+				t.Errorf("rejected = %d, want %d", got, tt.invalid)
+			}
+			errs := stream.res.GetErrors()
+			if len(errs) != tt.wantErrors {
+				t.Fatalf("len(errors) = %d, want %d", len(errs), tt.wantErrors)
+			}
+			if last := errs[len(errs)-1]; last != tt.wantLast {
+				t.Errorf("last error = %q, want %q", last, tt.wantLast)
+			}
+		})
+	}
+}
@@ -1,42 +1,69 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"github.com/go-chi/chi/v5"
 	"log-service/data"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 )
 
 /**
 该代码定义了一个 JSONPayload 结构体，用于表示 JSON 载荷的结构。
 WriteLog 方法是处理写入日志请求的函数。
-该函数首先将请求中的 JSON 数据解析为 JSONPayload 变量。
-然后，它创建一个 data.LogEntry 对象，将解析后的 JSON 数据赋值给 Name 和 Data 字段。
-接下来，它通过调用 app.Models.LogEntry.Insert 方法将日志条目插入数据库中。
-如果插入过程中发生错误，它会调用 app.errorJson 方法返回错误的 JSON 响应。
+该函数首先将请求中的 JSON 数据解析为 JSONPayload 变量，解析失败时返回 400。
+然后，它创建一个 data.LogEntry 对象，将解析后的 JSON 数据赋值给对应字段；除 name 和 data 之外的字段都是可选的，兼容旧客户端；
+客户端可以指定日志 ID，重复发送同一个 ID 的日志只保存一次，例如 listener-service 重新处理同一条消息时。
+接下来，它通过调用 app.Service.Write 方法校验日志条目并放入批量写入队列，由 Writer 批量插入数据库中。
+如果校验失败或写入队列不可用，它会调用 app.errorJson 方法返回 httpStatus 对应状态码的 JSON 错误响应。
 最后，它创建一个 jsonResponse 对象作为成功的响应，并调用 app.writeJson 方法将响应写回客户端，状态码为 202（Accepted）。
+Ready 方法检查日志存储（例如 MongoDB）是否可用，用于就绪探针。
+ListLogs 和 GetLog 方法用于读取日志：ListLogs 按名称、时间范围和关键字过滤并使用游标分页，GetLog 按 ID 查询一条日志；ExportLogs（见 export.go）按相同的过滤条件以流的方式导出日志。
 这段代码主要用于处理写入日志的请求，它使用了自定义的 data 包来处理数据的插入，并依赖于外部的 http 包来处理 HTTP 请求和响应。
 */
 
 // JSONPayload 结构体定义了 JSON 的载荷结构
 type JSONPayload struct {
+	ID   string `json:"id,omitempty"` // 可选的日志 ID（ObjectID 的十六进制表示），ID 已经存在的日志会被忽略，用于重试时去重
 	Name string `json:"name"`
 	Data string `json:"data"`
+
+	Severity   string         `json:"severity,omitempty"`   // 日志级别
+	Flagged    bool           `json:"flagged,omitempty"`    // 是否标记为需要关注
+	Service    string         `json:"service,omitempty"`    // 产生日志的服务
+	Host       string         `json:"host,omitempty"`       // 产生日志的主机
+	TraceID    string         `json:"trace_id,omitempty"`   // 请求或链路 ID
+	Attributes map[string]any `json:"attributes,omitempty"` // 任意的结构化字段
 }
 
 // WriteLog 方法处理写入日志的请求
 func (app *Config) WriteLog(w http.ResponseWriter, r *http.Request) {
 	// 将 JSON 解析为 JSONPayload 变量
 	var requestPayload JSONPayload
-	_ = app.readJson(w, r, &requestPayload)
+	if err := app.readJson(w, r, &requestPayload); err != nil {
+		app.errorJson(w, err, http.StatusBadRequest)
+		return
+	}
 
 	// 插入数据
 	event := data.LogEntry{
-		Name: requestPayload.Name,
-		Data: requestPayload.Data,
+		ID:         requestPayload.ID,
+		Name:       requestPayload.Name,
+		Data:       requestPayload.Data,
+		Severity:   requestPayload.Severity,
+		Flagged:    requestPayload.Flagged,
+		Service:    requestPayload.Service,
+		Host:       requestPayload.Host,
+		TraceID:    requestPayload.TraceID,
+		Attributes: requestPayload.Attributes,
 	}
 
-	err := app.Models.LogEntry.Insert(event)
+	err := app.Service.Write(r.Context(), event)
 	if err != nil {
-		app.errorJson(w, err)
+		app.errorJson(w, err, httpStatus(err))
 		return
 	}
 
@@ -47,3 +74,107 @@ func (app *Config) WriteLog(w http.ResponseWriter, r *http.Request) {
 
 	app.writeJson(w, http.StatusAccepted, resp)
 }
+
+// ListLogs 方法按查询参数分页查询日志：name、severity、service、trace_id、from、to（RFC3339）、q、cursor、limit 和 sort（asc 或 desc）
+func (app *Config) ListLogs(w http.ResponseWriter, r *http.Request) {
+	filter, err := filterFromQuery(r.URL.Query())
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	page, err := app.Service.Find(r.Context(), filter)
+	if err != nil {
+		app.errorJson(w, err, httpStatus(err))
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("%d logs", len(page.Logs)),
+		Data:    page,
+	}
+
+	app.writeJson(w, http.StatusOK, resp)
+}
+
+// GetLog 方法按 ID 查询一条日志
+func (app *Config) GetLog(w http.ResponseWriter, r *http.Request) {
+	entry, err := app.Service.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJson(w, err, httpStatus(err))
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: "found",
+		Data:    entry,
+	}
+
+	app.writeJson(w, http.StatusOK, resp)
+}
+
+// 把查询参数转换为查询条件
+func filterFromQuery(q url.Values) (data.Filter, error) {
+	filter := data.Filter{
+		Name:     q.Get("name"),
+		Severity: q.Get("severity"),
+		Service:  q.Get("service"),
+		TraceID:  q.Get("trace_id"),
+		Query:    q.Get("q"),
+		Cursor:   q.Get("cursor"),
+	}
+
+	var err error
+	if v := q.Get("from"); v != "" {
+		if filter.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if filter.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+
+	if v := q.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 0 {
+			return filter, fmt.Errorf("invalid limit %q", v)
+		}
+	}
+
+	switch q.Get("sort") {
+	case "", "desc":
+	case "asc":
+		filter.Ascending = true
+	default:
+		return filter, fmt.Errorf("invalid sort %q, expected asc or desc", q.Get("sort"))
+	}
+
+	return filter, nil
+}
+
+// WriterStats 方法返回批量写入的统计信息
+func (app *Config) WriterStats(w http.ResponseWriter, r *http.Request) {
+	resp := jsonResponse{
+		Error:   false,
+		Message: "log writer stats",
+		Data:    app.Models.Writer.Stats(),
+	}
+
+	app.writeJson(w, http.StatusOK, resp)
+}
+
+// Ready 方法在日志存储可用时返回 200，否则返回 503，用于就绪探针
+func (app *Config) Ready(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	if err := app.Models.Store.Ping(ctx); err != nil {
+		app.errorJson(w, fmt.Errorf("log store is not ready: %w", err), http.StatusServiceUnavailable)
+		return
+	}
+
+	app.writeJson(w, http.StatusOK, jsonResponse{Error: false, Message: "ready"})
+}
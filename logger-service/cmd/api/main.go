@@ -2,76 +2,135 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"log-service/data"
-	"net"
 	"net/http"
 	"net/rpc"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
-
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 /**
 该代码定义了一个 Config 结构体，用于存储应用程序的配置信息和数据模型。
-全局变量 client 用于保存 MongoDB 的客户端连接。
 main 函数是程序的入口函数。
-在 main 函数中，首先连接到 MongoDB 数据库。
-然后创建一个上下文以用于断开连接，并在函数结束时断开数据库连接。
-创建 Config 对象，并将 MongoDB 客户端传递给 data.New 方法来创建数据模型。
+在 main 函数中，首先通过 openStore 打开 LOG_STORE 指定的日志存储：mongo（默认）连接到 MongoDB，file 把日志保存在 LOG_STORE_DIR 目录的段文件中，memory 把日志保存在内存中。
+在函数结束时关闭日志存储（MongoDB 存储会断开数据库连接）。
+创建 Config 对象，并将日志存储传递给 data.New 方法来创建数据模型。
 启动 Web 服务器，监听指定的端口，并使用 app.routes() 方法作为处理程序。
-如果启动服务器时发生错误，则打印错误信息。
-connectToMongo 函数用于连接到 MongoDB 数据库。
-在该函数中，创建连接选项，并设置认证信息。
-然后使用连接选项连接到数据库。
-如果连接过程中发生错误，则打印错误信息并返回错误。
-如果连接成功，则打印连接成功的消息，并返回 MongoDB 客户端连接对象。
-在程序中，使用 MongoDB 客户端连接进行数据库操作和数据访问。
+启动时的错误以及 HTTP、gRPC 服务器的错误由 run 返回，服务器出错时同样先优雅关闭再退出。
+HTTP、net/rpc 和 gRPC 都通过 data.LogService 写入和查询日志，LOG_MAX_DATA_SIZE 和 LOG_ALLOWED_NAMES 配置校验规则。
+所有传输方式写入的日志都经过 data.Writer 批量写入，可以通过 WRITE_BATCH_SIZE、WRITE_FLUSH_INTERVAL 和 WRITE_QUEUE_SIZE 调整，关闭时写入队列中剩余的日志。
+LOG_RETENTION 配置日志的保留策略，设置 ARCHIVE_AFTER 后在后台定期把旧日志归档到 ARCHIVE_DIR，ADMIN_TOKEN 是归档管理接口的访问令牌（见 admin.go）。
+收到 SIGTERM 或 SIGINT 信号后依次优雅关闭 HTTP、gRPC 和 RPC 服务器，等待进行中的日志写入完成（最长 SHUTDOWN_TIMEOUT），最后关闭日志存储。
+MongoDB 的连接配置从环境变量读取，见 mongo.go；GET /ready 在日志存储可用时返回 200，否则返回 503。
 */
 
 const (
 	webPort  = "80"
 	rpcPort  = "5001"
-	mongoURL = "mongodb://mongo:27017"
 	gRpcPort = "50001"
 )
 
-var client *mongo.Client
-
 type Config struct {
-	Models data.Models
+	Models   data.Models
+	Service  *data.LogService // 所有传输方式共用的日志服务
+	Archiver *data.Archiver   // 为 nil 时归档被禁用
+
+	AdminToken string // 管理接口的访问令牌，为空时管理接口被禁用
 }
 
 func main() {
-	// connect to mongo
-	mongoClient, err := connectToMongo()
-	if err != nil {
-		log.Panic(err)
+	if err := run(); err != nil {
+		log.Fatal(err)
 	}
-	client = mongoClient
+}
 
-	// create a context in order to disconnect
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
+// run 启动日志服务，收到 SIGTERM 或 SIGINT 信号或者 HTTP、gRPC 服务器出错时优雅关闭，返回导致退出的错误
+func run() error {
+	// handle shutdown signals from the start, including while connecting to the store
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// close connection
+	// open the configured log store
+	store, err := openStore(ctx)
+	if err != nil {
+		return err
+	}
+
+	// close the store once every server has stopped
 	defer func() {
-		if err = client.Disconnect(ctx); err != nil {
-			panic(err)
+		if err := store.Close(); err != nil {
+			log.Println("Error closing log store:", err)
 		}
 	}()
 
 	app := Config{
-		Models: data.New(client),
+		Models:     data.New(store),
+		AdminToken: os.Getenv("ADMIN_TOKEN"),
 	}
 
+	// batch inserts from every transport into InsertMany calls
+	app.Models.Writer = data.NewWriter(store, data.WriterConfig{
+		BatchSize:     envInt("WRITE_BATCH_SIZE", 0),
+		FlushInterval: envDuration("WRITE_FLUSH_INTERVAL", 0),
+		QueueSize:     envInt("WRITE_QUEUE_SIZE", 0),
+	})
+
+	// validate every log the same way regardless of transport
+	app.Service = data.NewLogService(app.Models, data.ValidationRules{
+		MaxDataSize:  envInt("LOG_MAX_DATA_SIZE", 0),
+		AllowedNames: envList("LOG_ALLOWED_NAMES"),
+	})
+
+	// retention rules, e.g. LOG_RETENTION="default=30d;severity:ERROR=90d;name:auth=7d"
+	if v := os.Getenv("LOG_RETENTION"); v != "" {
+		retention, err := data.ParseRetention(v)
+		if err != nil {
+			return err
+		}
+		data.SetRetention(retention)
+	}
+
+	// archive logs older than ARCHIVE_AFTER to ARCHIVE_DIR every ARCHIVE_INTERVAL
+	if v := os.Getenv("ARCHIVE_AFTER"); v != "" {
+		after, err := data.ParseDays(v)
+		if err != nil {
+			return fmt.Errorf("ARCHIVE_AFTER: %w", err)
+		}
+		app.Archiver = data.NewArchiver(store, envString("ARCHIVE_DIR", "/archive"), after, envDuration("ARCHIVE_INTERVAL", 24*time.Hour))
+	}
+
+	// index the fields used to filter logs
+	indexCtx, cancelIndex := context.WithTimeout(ctx, 30*time.Second)
+	if err := app.Models.LogEntry.CreateIndexes(indexCtx); err != nil {
+		log.Println("Error creating log indexes:", err)
+	}
+	cancelIndex()
+
+	// servers report fatal errors here instead of exiting, so shutdown still runs
+	serverErr := make(chan error, 2)
+
 	// register the rpc server
-	err = rpc.Register(new(RPCServer))
-	go app.rpcListen()
+	rpcServer := &RPCServer{Service: app.Service}
+	err = rpc.Register(rpcServer)
+	if err != nil {
+		return err
+	}
+	rpcListener, err := app.rpcListen(rpcServer)
+	if err != nil {
+		return err
+	}
 
-	go app.gRPCListen()
+	grpcServer, err := app.gRPCListen(serverErr)
+	if err != nil {
+		return err
+	}
 
 	// start web server
 	fmt.Println("Starting service on port", webPort)
@@ -80,47 +139,113 @@ func main() {
 		Handler: app.routes(),
 	}
 
-	err = srv.ListenAndServe()
-	if err != nil {
-		fmt.Println(err)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- fmt.Errorf("web server: %w", err)
+		}
+	}()
+
+	if app.Archiver != nil {
+		app.Archiver.Start(ctx)
+	}
+
+	// wait for a shutdown signal or a server error
+	select {
+	case <-ctx.Done():
+	case err = <-serverErr:
+		// cancel ctx so background work such as scheduled archival stops too
+		stop()
 	}
+
+	log.Println("Shutting down logger service")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+	defer cancel()
+
+	// stop accepting new work on every transport and wait for in-flight writes
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Println("Error shutting down web server:", err)
+	}
+	// end TailLogs streams so the graceful stop does not wait for them
+	app.Models.LogEntry.CloseSubscriptions()
+	gracefulStopGRPC(shutdownCtx, grpcServer)
+	rpcListener.Shutdown(shutdownCtx)
+
+	// every transport has stopped; write whatever is still queued
+	if err := app.Models.Writer.Close(shutdownCtx); err != nil {
+		log.Println("Error flushing queued logs:", err)
+	}
+
+	// a scheduled archival run is cancelled with ctx; wait for it to clean up before disconnecting
+	if app.Archiver != nil {
+		app.Archiver.Wait()
+	}
+	return err
 }
 
-func (app *Config) rpcListen() error {
-	fmt.Println("Starting rpc server on port", rpcPort)
-	listen, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%s", rpcPort))
-	if err != nil {
-		return err
+// envString 返回环境变量的值，未设置时返回 def
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
 	}
-	defer listen.Close()
+	return def
+}
 
-	for {
-		rpcConn, err := listen.Accept()
-		if err != nil {
-			return err
+// envList 返回逗号分隔的环境变量中的所有非空项
+func envList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
-
-		go rpc.ServeConn(rpcConn)
 	}
+	return items
 }
 
-// connectToMongo 方法用于连接到 MongoDB 数据库
-func connectToMongo() (*mongo.Client, error) {
-	// 创建连接选项
-	clientOptions := options.Client().ApplyURI(mongoURL)
-	clientOptions.SetAuth(options.Credential{
-		Username: "admin",
-		Password: "password",
-	})
+// envInt 返回环境变量表示的整数，未设置或无效时返回 def
+func envInt(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
 
-	// 连接到数据库
-	c, err := mongo.Connect(context.TODO(), clientOptions)
-	if err != nil {
-		log.Println("Error connecting:", err)
-		return nil, err
+// envDuration 返回环境变量表示的时间间隔（支持 "7d" 这样以天为单位的格式），未设置或无效时返回 def
+func envDuration(key string, def time.Duration) time.Duration {
+	if d, err := data.ParseDays(os.Getenv(key)); err == nil && d > 0 {
+		return d
 	}
+	return def
+}
 
-	log.Println("Connected to mongo!")
+// shutdownTimeout 返回优雅关闭时等待进行中请求完成的最长时间，可通过 SHUTDOWN_TIMEOUT 环境变量配置
+func shutdownTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return 20 * time.Second
+}
 
-	return c, nil
+// openStore 按 LOG_STORE 环境变量打开日志存储：mongo（默认）、file（保存在 LOG_STORE_DIR 目录中）或 memory
+func openStore(ctx context.Context) (data.LogStore, error) {
+	switch kind := envString("LOG_STORE", "mongo"); kind {
+	case "mongo":
+		cfg, err := mongoConfigFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		mongoClient, err := connectToMongo(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return data.NewMongoStore(mongoClient, cfg.Database, cfg.Collection), nil
+	case "file":
+		dir := envString("LOG_STORE_DIR", "/data/logs")
+		log.Println("Storing logs in", dir)
+		return data.NewFileStore(dir)
+	case "memory":
+		log.Println("Storing logs in memory, they are lost on restart")
+		return data.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown LOG_STORE %q, expected mongo, file or memory", kind)
+	}
 }
@@ -20,8 +20,21 @@ func (app *Config) routes() http.Handler {
 	}))
 
 	mux.Use(middleware.Heartbeat("/ping"))
+	mux.Get("/ready", app.Ready)
 
 	mux.Post("/log", app.WriteLog)
+	mux.Get("/logs", app.ListLogs)
+	mux.Get("/logs/export", app.ExportLogs)
+	mux.Get("/logs/{id}", app.GetLog)
+	mux.Get("/stats", app.AggregateLogs)
+	mux.Get("/stats/auth", app.AuthStats)
+	mux.Get("/metrics/writer", app.WriterStats)
+
+	mux.Route("/admin", func(mux chi.Router) {
+		mux.Use(app.requireAdminToken)
+		mux.Get("/archive/runs", app.ListArchiveRuns)
+		mux.Post("/archive/runs", app.TriggerArchive)
+	})
 
 	return mux
 }
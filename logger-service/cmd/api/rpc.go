@@ -2,48 +2,168 @@ package main
 
 import (
 	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
 	"log"
 	"log-service/data"
+	"net"
+	"net/rpc"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 /**
 该代码定义了一个 RPCServer 结构体，表示 RPC 服务器。
-该结构体没有任何字段，仅用于组织和管理相关方法。
+该结构体记录正在处理的调用数，并持有所有传输方式共用的 LogService。
 该代码还定义了一个 RPCPayload 结构体，表示 RPC 传输的有效载荷。
 LogInfo 是 RPCServer 结构体的方法，用于处理日志信息。
 该方法接收一个 RPCPayload 对象作为输入参数和一个指向字符串指针的响应参数。
-在该方法中，首先获取名为 "logs" 的数据库中的 "logs" 集合。
-然后，将传入的日志有效载荷插入到集合中作为一条新的日志记录。
-如果在插入过程中发生错误，则打印错误信息并返回错误。
+在该方法中，通过 LogService 校验传入的日志有效载荷并放入写入队列，由 Writer 批量插入到集合中。
+如果校验或写入失败，则打印错误信息并返回带有错误类别前缀（例如 "invalid argument: "）的错误。
 最后，设置响应字符串，表示成功处理了 RPC 请求，然后返回 nil 表示没有发生错误。
+rpcListener 负责接受 RPC 连接并跟踪所有活动连接，Shutdown 时先关闭监听器，等待进行中的调用完成后再关闭连接。
 */
 
 type RPCServer struct {
+	inFlight int64            // 正在处理的调用数
+	Service  *data.LogService // 校验并写入日志
 }
 
+const rpcWriteTimeout = 10 * time.Second // 写入队列已满时 LogInfo 最多等待的时间
+
+// RPCPayload 中除 Name 和 Data 之外的字段都是可选的，gob 会忽略旧客户端没有发送的字段
 type RPCPayload struct {
-	Name string
-	Data string
+	Name       string
+	Data       string
+	Severity   string
+	Service    string
+	Host       string
+	TraceID    string
+	Attributes map[string]any
+}
+
+func init() {
+	// Attributes 中嵌套的对象和数组以接口类型传输，需要向 gob 注册
+	gob.Register(map[string]any{})
+	gob.Register([]any{})
 }
 
 // LogInfo 是 RPCServer 结构体的方法，用于处理日志信息
 func (r *RPCServer) LogInfo(payload RPCPayload, resp *string) error {
-	// 获取名为 "logs" 的数据库中的 "logs" 集合
-	collection := client.Database("logs").Collection("logs")
-
-	// 向集合中插入一条日志记录
-	_, err := collection.InsertOne(context.TODO(), data.LogEntry{
-		Name:      payload.Name,
-		Data:      payload.Data,
-		CreatedAt: time.Now(),
+	atomic.AddInt64(&r.inFlight, 1)
+	defer atomic.AddInt64(&r.inFlight, -1)
+
+	// 与 HTTP 和 gRPC 一样通过 LogService 校验并写入
+	ctx, cancel := context.WithTimeout(context.Background(), rpcWriteTimeout)
+	defer cancel()
+	err := r.Service.Write(ctx, data.LogEntry{
+		Name:       payload.Name,
+		Data:       payload.Data,
+		Severity:   payload.Severity,
+		Service:    payload.Service,
+		Host:       payload.Host,
+		TraceID:    payload.TraceID,
+		Attributes: payload.Attributes,
 	})
 	if err != nil {
-		log.Println("Error writing to mongo:", err)
-		return err
+		log.Println("Error queueing log:", err)
+		return rpcError(err)
 	}
 
 	// 设置响应字符串，表示成功处理了 RPC 请求
 	*resp = "Processed payload via RPC:" + payload.Name
 	return nil
 }
+
+// rpcListener 接受 RPC 连接并跟踪所有活动连接
+type rpcListener struct {
+	listener net.Listener
+	server   *RPCServer
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup // 正在服务的连接
+}
+
+// rpcListen 在后台接受 RPC 连接
+func (app *Config) rpcListen(server *RPCServer) (*rpcListener, error) {
+	fmt.Println("Starting rpc server on port", rpcPort)
+	listen, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%s", rpcPort))
+	if err != nil {
+		return nil, err
+	}
+
+	l := &rpcListener{
+		listener: listen,
+		server:   server,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	go l.serve()
+
+	return l, nil
+}
+
+// 接受连接，直到监听器被关闭
+func (l *rpcListener) serve() {
+	for {
+		rpcConn, err := l.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Println("Error accepting rpc connection:", err)
+			}
+			return
+		}
+
+		l.mu.Lock()
+		l.conns[rpcConn] = struct{}{}
+		l.wg.Add(1)
+		l.mu.Unlock()
+
+		go func() {
+			defer l.wg.Done()
+			rpc.ServeConn(rpcConn)
+
+			l.mu.Lock()
+			delete(l.conns, rpcConn)
+			l.mu.Unlock()
+		}()
+	}
+}
+
+// Shutdown 停止接受新连接，等待进行中的调用完成后关闭所有连接
+func (l *rpcListener) Shutdown(ctx context.Context) {
+	_ = l.listener.Close()
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+waitCalls:
+	for atomic.LoadInt64(&l.server.inFlight) > 0 {
+		select {
+		case <-ctx.Done():
+			log.Println("rpc shutdown timed out with calls in flight")
+			break waitCalls
+		case <-ticker.C:
+		}
+	}
+
+	// 客户端的长连接不会主动断开，这里统一关闭；ServeConn 会等待已读取的调用返回后才退出
+	l.mu.Lock()
+	for c := range l.conns {
+		_ = c.Close()
+	}
+	l.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log-service/data"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+该代码定义了日志统计的 HTTP 接口，用于仪表盘。
+AggregateLogs 处理 GET /stats 请求：group_by 是逗号分隔的分组字段（name、severity、service、host 或 attributes.<key>），
+interval 是时间桶（minute、hour 或 day），top 只返回条数最多的若干组，其余查询参数（name、severity、service、trace_id、q、from、to）与 GET /logs 相同。
+例如 GET /stats?group_by=name&interval=hour 统计每小时每种日志的条数，GET /stats?group_by=service&top=5 找出日志最多的五个服务。
+AuthStats 处理 GET /stats/auth 请求，返回 [from, to) 时间范围内的登录成功率，指定 interval 时同时返回每个时间桶的成功率。
+*/
+
+// AggregateLogs 方法按查询参数分组统计日志条数
+func (app *Config) AggregateLogs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter, err := filterFromQuery(q)
+	if err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
+	aggregation := data.Aggregation{
+		Filter:   filter,
+		Interval: q.Get("interval"),
+	}
+	for _, field := range strings.Split(q.Get("group_by"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			aggregation.GroupBy = append(aggregation.GroupBy, field)
+		}
+	}
+	if v := q.Get("top"); v != "" {
+		if aggregation.Top, err = strconv.Atoi(v); err != nil {
+			app.errorJson(w, fmt.Errorf("invalid top %q", v))
+			return
+		}
+	}
+
+	buckets, err := app.Service.Aggregate(r.Context(), aggregation)
+	if err != nil {
+		app.errorJson(w, err, httpStatus(err))
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("%d buckets", len(buckets)),
+		Data:    buckets,
+	}
+
+	app.writeJson(w, http.StatusOK, resp)
+}
+
+// AuthStats 方法返回登录的成功率
+func (app *Config) AuthStats(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var from, to time.Time
+	var err error
+	if v := q.Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			app.errorJson(w, fmt.Errorf("invalid from: %w", err))
+			return
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			app.errorJson(w, fmt.Errorf("invalid to: %w", err))
+			return
+		}
+	}
+
+	stats, err := app.Service.AuthStats(r.Context(), from, to, q.Get("interval"))
+	if err != nil {
+		app.errorJson(w, err, httpStatus(err))
+		return
+	}
+
+	resp := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("%d of %d logins succeeded", stats.Success, stats.Success+stats.Failure),
+		Data:    stats,
+	}
+
+	app.writeJson(w, http.StatusOK, resp)
+}
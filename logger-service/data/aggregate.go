@@ -0,0 +1,259 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+/**
+该代码定义了日志的聚合统计。
+Aggregation 描述一次统计：按 Filter 过滤日志，按 GroupBy 中的字段（name、severity、service、host 或 attributes.<key>）分组，
+按 Interval（minute、hour 或 day，UTC）把创建时间划分为时间桶，统计每组的日志条数。
+Top 大于 0 时只返回条数最多的 Top 组，用于找出日志最多的服务；否则按时间桶和分组的值排序。
+结果最多包含 MaxBuckets 组，超过时返回校验错误，调用方应缩小时间范围或使用更大的时间桶；
+FileStore 和 MemoryStore 在内存中统计，即使指定了 Top，分组超过 MaxBuckets 时同样返回错误。
+MongoStore 使用聚合管道在数据库中统计，FileStore 和 MemoryStore 在遍历日志时统计，结果的顺序相同。
+AuthStats 基于名称为 authentication 的日志统计登录的成功率：认证服务在日志的 attributes.outcome 中记录 success 或 failure，
+只统计 outcome 为 success 或 failure 的日志；没有 outcome 的旧日志是在认证服务记录 outcome 之前写入的，只可能是登录成功的日志，按成功统计；
+outcome 为其他值的日志不计入成功率。
+*/
+
+// MaxBuckets 是一次统计最多返回的分组数
+const MaxBuckets = 10000
+
+// 可以用于 GroupBy 的日志字段，另外还支持 attributes.<key>
+var groupFields = map[string]bool{
+	"name":     true,
+	"severity": true,
+	"service":  true,
+	"host":     true,
+}
+
+// 时间桶的长度
+var intervals = map[string]time.Duration{
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+}
+
+// Aggregation 是一次聚合统计的条件
+type Aggregation struct {
+	Filter   Filter   // 只统计匹配的日志，忽略 Cursor、Limit 和 Ascending
+	GroupBy  []string // 分组的字段
+	Interval string   // 时间桶：minute、hour 或 day，为空时不按时间划分
+	Top      int      // 大于 0 时只返回条数最多的 Top 组
+}
+
+// Bucket 是聚合统计中的一组
+type Bucket struct {
+	Time  *time.Time        `json:"time,omitempty"`  // 时间桶的开始时间
+	Group map[string]string `json:"group,omitempty"` // GroupBy 中每个字段的值
+	Count int64             `json:"count"`
+}
+
+// 检查统计条件
+func (a Aggregation) validate() error {
+	for _, field := range a.GroupBy {
+		key, isAttribute := strings.CutPrefix(field, "attributes.")
+		if groupFields[field] || (isAttribute && key != "" && !strings.ContainsAny(key, ".$")) {
+			continue
+		}
+		return &ValidationError{Field: "group_by", Reason: fmt.Sprintf("cannot group by %q, expected name, severity, service, host or attributes.<key>", field)}
+	}
+	if a.Interval != "" && intervals[a.Interval] == 0 {
+		return &ValidationError{Field: "interval", Reason: fmt.Sprintf("unknown interval %q, expected minute, hour or day", a.Interval)}
+	}
+	if a.Top < 0 {
+		return &ValidationError{Field: "top", Reason: "top must not be negative"}
+	}
+	return nil
+}
+
+// Aggregate 按条件聚合统计日志
+func (s *LogService) Aggregate(ctx context.Context, a Aggregation) ([]Bucket, error) {
+	if err := a.validate(); err != nil {
+		return nil, err
+	}
+	return s.models.Store.Aggregate(ctx, a)
+}
+
+var errTooManyBuckets = &ValidationError{Field: "interval", Reason: fmt.Sprintf("more than %d buckets, narrow the time range or use a larger interval", MaxBuckets)}
+
+// 使用 each 实现 LogStore.Aggregate
+func aggregateEntries(a Aggregation, each eachFunc) ([]Bucket, error) {
+	type groupKey struct {
+		time   time.Time
+		values string // 分组的值，以 \x00 分隔
+	}
+
+	counts := make(map[groupKey]*Bucket)
+	err := each(a.Filter, func(entry *LogEntry) (bool, error) {
+		values := make([]string, len(a.GroupBy))
+		for i, field := range a.GroupBy {
+			values[i] = groupValue(entry, field)
+		}
+
+		var key groupKey
+		if a.Interval != "" {
+			key.time = entry.CreatedAt.UTC().Truncate(intervals[a.Interval])
+		}
+		key.values = strings.Join(values, "\x00")
+
+		b, ok := counts[key]
+		if !ok {
+			if len(counts) >= MaxBuckets {
+				return false, errTooManyBuckets
+			}
+			b = &Bucket{}
+			if a.Interval != "" {
+				t := key.time
+				b.Time = &t
+			}
+			if len(a.GroupBy) > 0 {
+				b.Group = make(map[string]string, len(a.GroupBy))
+				for i, field := range a.GroupBy {
+					b.Group[field] = values[i]
+				}
+			}
+			counts[key] = b
+		}
+		b.Count++
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make([]Bucket, 0, len(counts))
+	for _, b := range counts {
+		buckets = append(buckets, *b)
+	}
+	sortBuckets(buckets, a)
+	if a.Top > 0 && len(buckets) > a.Top {
+		buckets = buckets[:a.Top]
+	}
+	return buckets, nil
+}
+
+// 日志中用于分组的字段的值
+func groupValue(entry *LogEntry, field string) string {
+	switch field {
+	case "name":
+		return entry.Name
+	case "severity":
+		return entry.Severity
+	case "service":
+		return entry.Service
+	case "host":
+		return entry.Host
+	}
+
+	key := strings.TrimPrefix(field, "attributes.")
+	v, ok := entry.Attributes[key]
+	if !ok || v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// 与 MongoStore 的聚合管道使用相同的顺序：Top 大于 0 时按条数降序，否则按时间桶升序，相同时按分组的值升序
+func sortBuckets(buckets []Bucket, a Aggregation) {
+	sort.Slice(buckets, func(i, j int) bool {
+		bi, bj := buckets[i], buckets[j]
+		if a.Top > 0 && bi.Count != bj.Count {
+			return bi.Count > bj.Count
+		}
+		if bi.Time != nil && bj.Time != nil && !bi.Time.Equal(*bj.Time) {
+			return bi.Time.Before(*bj.Time)
+		}
+		for _, field := range a.GroupBy {
+			if bi.Group[field] != bj.Group[field] {
+				return bi.Group[field] < bj.Group[field]
+			}
+		}
+		return false
+	})
+}
+
+// AuthStats 是登录成功率的统计
+type AuthStats struct {
+	Success     int64            `json:"success"`
+	Failure     int64            `json:"failure"`
+	SuccessRate float64          `json:"success_rate"` // 没有登录记录时为 0
+	Buckets     []AuthStatBucket `json:"buckets,omitempty"`
+}
+
+// AuthStatBucket 是一个时间桶内的登录成功率
+type AuthStatBucket struct {
+	Time        time.Time `json:"time"`
+	Success     int64     `json:"success"`
+	Failure     int64     `json:"failure"`
+	SuccessRate float64   `json:"success_rate"`
+}
+
+// AuthStats 统计 [from, to) 时间范围内登录的成功率，interval 不为空时同时返回每个时间桶的成功率
+func (s *LogService) AuthStats(ctx context.Context, from, to time.Time, interval string) (*AuthStats, error) {
+	buckets, err := s.Aggregate(ctx, Aggregation{
+		Filter:   Filter{Name: "authentication", From: from, To: to},
+		GroupBy:  []string{"attributes.outcome"},
+		Interval: interval,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &AuthStats{}
+	var byTime map[time.Time]*AuthStatBucket
+	if interval != "" {
+		byTime = make(map[time.Time]*AuthStatBucket)
+	}
+
+	for _, b := range buckets {
+		// 空字符串是没有 outcome 的旧日志
+		outcome := b.Group["attributes.outcome"]
+		if outcome != "success" && outcome != "failure" && outcome != "" {
+			continue
+		}
+		failed := outcome == "failure"
+		if failed {
+			stats.Failure += b.Count
+		} else {
+			stats.Success += b.Count
+		}
+
+		if b.Time == nil {
+			continue
+		}
+		tb, ok := byTime[*b.Time]
+		if !ok {
+			tb = &AuthStatBucket{Time: *b.Time}
+			byTime[*b.Time] = tb
+		}
+		if failed {
+			tb.Failure += b.Count
+		} else {
+			tb.Success += b.Count
+		}
+	}
+
+	stats.SuccessRate = successRate(stats.Success, stats.Failure)
+	for _, tb := range byTime {
+		tb.SuccessRate = successRate(tb.Success, tb.Failure)
+		stats.Buckets = append(stats.Buckets, *tb)
+	}
+	sort.Slice(stats.Buckets, func(i, j int) bool { return stats.Buckets[i].Time.Before(stats.Buckets[j].Time) })
+	return stats, nil
+}
+
+func successRate(success, failure int64) float64 {
+	if success+failure == 0 {
+		return 0
+	}
+	return float64(success) / float64(success+failure)
+}
@@ -0,0 +1,235 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAuthStats(t *testing.T) {
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	entries := []struct {
+		name    string
+		outcome any // nil 表示没有 outcome 的旧日志
+		at      time.Duration
+	}{
+		{"authentication", "success", 0},
+		{"authentication", "success", time.Minute},
+		{"authentication", "failure", 2 * time.Minute},
+		{"authentication", nil, 3 * time.Minute},
+		{"authentication", "locked", 4 * time.Minute},
+		{"password_reset", nil, 5 * time.Minute},
+		{"registration", "success", time.Hour},
+		{"authentication", "failure", time.Hour},
+	}
+
+	store := NewMemoryStore()
+	docs := make([]LogEntry, 0, len(entries))
+	for _, e := range entries {
+		doc := newDocument(LogEntry{Name: e.name}, base.Add(e.at))
+		doc.ID = primitive.NewObjectID().Hex()
+		if e.outcome != nil {
+			doc.Attributes = map[string]any{"outcome": e.outcome}
+		}
+		docs = append(docs, doc)
+	}
+	if err := store.InsertMany(context.Background(), docs); err != nil {
+		t.Fatal(err)
+	}
+	service := NewLogService(Models{Store: store}, ValidationRules{})
+
+	stats, err := service.AuthStats(context.Background(), base, base.Add(2*time.Hour), "hour")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Success != 3 || stats.Failure != 2 {
+		t.Errorf("success %d failure %d, want 3 and 2", stats.Success, stats.Failure)
+	}
+	if math.Abs(stats.SuccessRate-0.6) > 1e-9 {
+		t.Errorf("success rate = %v, want 0.6", stats.SuccessRate)
+	}
+
+	want := []AuthStatBucket{
+		{Time: base, Success: 3, Failure: 1, SuccessRate: 0.75},
+		{Time: base.Add(time.Hour), Success: 0, Failure: 1, SuccessRate: 0},
+	}
+	if len(stats.Buckets) != len(want) {
+		t.Fatalf("got %d buckets, want %d: %+v", len(stats.Buckets), len(want), stats.Buckets)
+	}
+	for i, b := range stats.Buckets {
+		if !b.Time.Equal(want[i].Time) || b.Success != want[i].Success || b.Failure != want[i].Failure || b.SuccessRate != want[i].SuccessRate {
+			t.Errorf("bucket %d = %+v, want %+v", i, b, want[i])
+		}
+	}
+}
+
+func TestSuccessRate(t *testing.T) {
+	tests := []struct {
+		success, failure int64
+		want             float64
+	}{
+		{0, 0, 0},
+		{1, 0, 1},
+		{0, 3, 0},
+		{3, 1, 0.75},
+	}
+	for _, tt := range tests {
+		if got := successRate(tt.success, tt.failure); got != tt.want {
+			t.Errorf("successRate(%d, %d) = %v, want %v", tt.success, tt.failure, got, tt.want)
+		}
+	}
+}
+
+func TestAggregateEntries(t *testing.T) {
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	entries := []LogEntry{
+		{Name: "auth", Severity: "INFO", Service: "broker", CreatedAt: base.Add(10 * time.Minute), Attributes: map[string]any{"code": 200}},
+		{Name: "auth", Severity: "ERROR", Service: "broker", CreatedAt: base.Add(20 * time.Minute), Attributes: map[string]any{"code": 500}},
+		{Name: "event", Severity: "INFO", Service: "listener", CreatedAt: base.Add(30 * time.Minute)},
+		{Name: "auth", Severity: "INFO", Service: "broker", CreatedAt: base.Add(70 * time.Minute), Attributes: map[string]any{"code": 200}},
+		{Name: "event", Severity: "INFO", Service: "listener", CreatedAt: base.Add(80 * time.Minute)},
+		{Name: "event", Severity: "INFO", Service: "listener", CreatedAt: base.Add(90 * time.Minute)},
+	}
+	// 遍历所有日志，过滤条件由 LogStore 处理，这里忽略
+	each := func(_ Filter, fn func(*LogEntry) (bool, error)) error {
+		for i := range entries {
+			if ok, err := fn(&entries[i]); err != nil || !ok {
+				return err
+			}
+		}
+		return nil
+	}
+	at := func(d time.Duration) *time.Time {
+		t := base.Add(d)
+		return &t
+	}
+
+	tests := []struct {
+		name string
+		a    Aggregation
+		want []Bucket
+	}{
+		{"count only", Aggregation{}, []Bucket{{Count: 6}}},
+		{
+			"group by name",
+			Aggregation{GroupBy: []string{"name"}},
+			[]Bucket{{Group: map[string]string{"name": "auth"}, Count: 3}, {Group: map[string]string{"name": "event"}, Count: 3}},
+		},
+		{
+			"hourly buckets",
+			Aggregation{Interval: "hour"},
+			[]Bucket{{Time: at(0), Count: 3}, {Time: at(time.Hour), Count: 3}},
+		},
+		{
+			"hourly by service",
+			Aggregation{GroupBy: []string{"service"}, Interval: "hour"},
+			[]Bucket{
+				{Time: at(0), Group: map[string]string{"service": "broker"}, Count: 2},
+				{Time: at(0), Group: map[string]string{"service": "listener"}, Count: 1},
+				{Time: at(time.Hour), Group: map[string]string{"service": "broker"}, Count: 1},
+				{Time: at(time.Hour), Group: map[string]string{"service": "listener"}, Count: 2},
+			},
+		},
+		{
+			"attribute values are formatted and missing ones are empty",
+			Aggregation{GroupBy: []string{"attributes.code"}},
+			[]Bucket{
+				{Group: map[string]string{"attributes.code": ""}, Count: 3},
+				{Group: map[string]string{"attributes.code": "200"}, Count: 2},
+				{Group: map[string]string{"attributes.code": "500"}, Count: 1},
+			},
+		},
+		{
+			"top sorts by count",
+			Aggregation{GroupBy: []string{"name", "severity"}, Top: 2},
+			[]Bucket{
+				{Group: map[string]string{"name": "event", "severity": "INFO"}, Count: 3},
+				{Group: map[string]string{"name": "auth", "severity": "INFO"}, Count: 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := aggregateEntries(tt.a, each)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("aggregateEntries = %s, want %s", formatBuckets(got), formatBuckets(tt.want))
+			}
+		})
+	}
+}
+
+func TestAggregateEntriesTooManyBuckets(t *testing.T) {
+	each := func(_ Filter, fn func(*LogEntry) (bool, error)) error {
+		for i := 0; i <= MaxBuckets; i++ {
+			entry := LogEntry{Attributes: map[string]any{"n": i}}
+			if ok, err := fn(&entry); err != nil || !ok {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// 即使指定了 Top，分组超过 MaxBuckets 时同样返回错误
+	_, err := aggregateEntries(Aggregation{GroupBy: []string{"attributes.n"}, Top: 1}, each)
+	if err != errTooManyBuckets {
+		t.Errorf("aggregateEntries = %v, want %v", err, errTooManyBuckets)
+	}
+}
+
+func TestAggregationValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		a         Aggregation
+		wantField string // 为空时应通过校验
+	}{
+		{"empty", Aggregation{}, ""},
+		{"all fields", Aggregation{GroupBy: []string{"name", "severity", "service", "host", "attributes.outcome"}, Interval: "day", Top: 5}, ""},
+		{"unknown field", Aggregation{GroupBy: []string{"data"}}, "group_by"},
+		{"empty attribute", Aggregation{GroupBy: []string{"attributes."}}, "group_by"},
+		{"nested attribute", Aggregation{GroupBy: []string{"attributes.a.b"}}, "group_by"},
+		{"operator in attribute", Aggregation{GroupBy: []string{"attributes.$where"}}, "group_by"},
+		{"unknown interval", Aggregation{Interval: "1h"}, "interval"},
+		{"negative top", Aggregation{Top: -1}, "top"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.a.validate()
+			if tt.wantField == "" {
+				if err != nil {
+					t.Errorf("validate = %v, want nil", err)
+				}
+				return
+			}
+			var ve *ValidationError
+			if !errors.As(err, &ve) || ve.Field != tt.wantField {
+				t.Errorf("validate = %v, want a validation error for %s", err, tt.wantField)
+			}
+		})
+	}
+}
+
+// 便于在失败信息中阅读的桶列表
+func formatBuckets(buckets []Bucket) string {
+	parts := make([]string, len(buckets))
+	for i, b := range buckets {
+		var at string
+		if b.Time != nil {
+			at = b.Time.Format(time.RFC3339) + " "
+		}
+		parts[i] = fmt.Sprintf("{%s%v %d}", at, b.Group, b.Count)
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
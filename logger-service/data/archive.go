@@ -0,0 +1,257 @@
+package data
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+/**
+该代码定义了日志的归档任务。
+Archiver 定期（Interval）把创建时间早于 After 的日志按创建时间顺序导出到 Dir 目录下 gzip 压缩的 NDJSON 文件中（每行一条日志），
+文件完整写入并同步到磁盘后才从日志存储中删除这些日志；导出失败时删除未完成的文件，日志保留在日志存储中等待下一次归档。
+After 应小于保留策略中的保留时间，否则日志会在归档之前被 TTL 索引删除。
+同一时间只有一个归档任务在运行，管理接口通过 Trigger 在后台手动触发一次归档（使用 Start 的 ctx，关闭服务时取消），Runs 返回最近的归档记录。
+*/
+
+const maxArchiveRuns = 20 // 保留的归档记录条数
+
+// ErrArchiveRunning 表示已经有归档任务在运行
+var ErrArchiveRunning = errors.New("an archival run is already in progress")
+
+// ArchiveRun 是一次归档的记录
+type ArchiveRun struct {
+	ID         int64     `json:"id"`
+	Trigger    string    `json:"trigger"` // schedule 或 manual
+	Before     time.Time `json:"before"`  // 归档创建时间早于该时间的日志
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	File       string    `json:"file,omitempty"`
+	Archived   int64     `json:"archived"` // 写入文件的日志条数
+	Deleted    int64     `json:"deleted"`  // 从日志存储中删除的日志条数
+	Error      string    `json:"error,omitempty"`
+}
+
+// Archiver 定期把旧日志归档到本地文件
+type Archiver struct {
+	store LogStore
+
+	Dir      string        // 归档文件所在目录
+	After    time.Duration // 创建时间早于 After 的日志会被归档
+	Interval time.Duration // 定期归档的间隔
+
+	mu      sync.Mutex
+	running bool
+	nextID  int64
+	runs    []ArchiveRun    // 最近的归档记录，最新的在前
+	ctx     context.Context // Start 的 ctx，Trigger 启动的归档在它被取消时停止
+	wg      sync.WaitGroup
+}
+
+// NewArchiver 创建一个归档 store 中日志的归档任务
+func NewArchiver(store LogStore, dir string, after, interval time.Duration) *Archiver {
+	return &Archiver{
+		store:    store,
+		Dir:      dir,
+		After:    after,
+		Interval: interval,
+		ctx:      context.Background(),
+	}
+}
+
+// Start 在后台定期归档，直到 ctx 被取消。Wait 等待后台任务退出
+func (a *Archiver) Start(ctx context.Context) {
+	a.mu.Lock()
+	a.ctx = ctx
+	a.mu.Unlock()
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+
+		ticker := time.NewTicker(a.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				run, err := a.Run(ctx, "schedule")
+				if err != nil && !errors.Is(err, ErrArchiveRunning) {
+					log.Println("Error archiving logs:", err)
+					continue
+				}
+				if err == nil && run.Archived > 0 {
+					log.Printf("Archived %d logs to %s", run.Archived, run.File)
+				}
+			}
+		}
+	}()
+}
+
+// Wait 等待后台归档任务以及 Trigger 启动的归档退出
+func (a *Archiver) Wait() {
+	a.wg.Wait()
+}
+
+// Runs 返回最近的归档记录，最新的在前
+func (a *Archiver) Runs() []ArchiveRun {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	out := make([]ArchiveRun, len(a.runs))
+	copy(out, a.runs)
+	return out
+}
+
+// Run 立即执行一次归档，已经有归档任务在运行时返回 ErrArchiveRunning
+func (a *Archiver) Run(ctx context.Context, trigger string) (ArchiveRun, error) {
+	run, err := a.begin(trigger)
+	if err != nil {
+		return ArchiveRun{}, err
+	}
+	return a.finish(ctx, run)
+}
+
+// Trigger 在后台启动一次归档并立即返回本次归档的记录，归档使用 Start 的 ctx 而不是调用方的 ctx，
+// 调用方断开连接不会中断归档；已经有归档任务在运行时返回 ErrArchiveRunning
+func (a *Archiver) Trigger(trigger string) (ArchiveRun, error) {
+	run, err := a.begin(trigger)
+	if err != nil {
+		return ArchiveRun{}, err
+	}
+
+	a.mu.Lock()
+	ctx := a.ctx
+	a.mu.Unlock()
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		done, err := a.finish(ctx, run)
+		if err != nil {
+			log.Println("Error archiving logs:", err)
+			return
+		}
+		log.Printf("Archived %d logs to %s", done.Archived, done.File)
+	}()
+	return run, nil
+}
+
+// 标记归档任务开始运行并创建本次归档的记录
+func (a *Archiver) begin(trigger string) (ArchiveRun, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.running {
+		return ArchiveRun{}, ErrArchiveRunning
+	}
+	a.running = true
+	a.nextID++
+	return ArchiveRun{
+		ID:        a.nextID,
+		Trigger:   trigger,
+		Before:    time.Now().Add(-a.After),
+		StartedAt: time.Now(),
+	}, nil
+}
+
+// 执行 begin 创建的归档并保存记录
+func (a *Archiver) finish(ctx context.Context, run ArchiveRun) (ArchiveRun, error) {
+	err := a.archive(ctx, &run)
+	run.FinishedAt = time.Now()
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	a.mu.Lock()
+	a.running = false
+	a.runs = append([]ArchiveRun{run}, a.runs...)
+	if len(a.runs) > maxArchiveRuns {
+		a.runs = a.runs[:maxArchiveRuns]
+	}
+	a.mu.Unlock()
+
+	return run, err
+}
+
+// 导出并删除创建时间早于 run.Before 的日志
+func (a *Archiver) archive(ctx context.Context, run *ArchiveRun) error {
+	filter := Filter{To: run.Before, Ascending: true}
+
+	count, err := a.store.Count(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(a.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("logs-%s.ndjson.gz", run.StartedAt.UTC().Format("20060102T150405Z"))
+	path := filepath.Join(a.Dir, name)
+	partial := path + ".partial"
+
+	n, err := a.exportLogs(ctx, partial, filter)
+	if err != nil {
+		_ = os.Remove(partial)
+		return err
+	}
+	if err := os.Rename(partial, path); err != nil {
+		_ = os.Remove(partial)
+		return err
+	}
+	run.File = path
+	run.Archived = n
+
+	// 创建时间早于 Before 的日志不会再有新的写入，删除的正是已经导出的日志
+	deleted, err := a.store.Delete(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("archived to %s but failed to delete: %w", path, err)
+	}
+	run.Deleted = deleted
+	return nil
+}
+
+// 把匹配 filter 的日志写入 gzip 压缩的 NDJSON 文件，返回写入的条数
+func (a *Archiver) exportLogs(ctx context.Context, path string, filter Filter) (int64, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+	enc := json.NewEncoder(zw)
+
+	var n int64
+	err = a.store.Scan(ctx, filter, func(entry *LogEntry) error {
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return n, err
+	}
+	if err := f.Sync(); err != nil {
+		return n, err
+	}
+	return n, f.Close()
+}
@@ -0,0 +1,607 @@
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/**
+该代码定义了把日志保存在本地文件中的 FileStore，不依赖外部服务，适合开发和 CI。
+日志以 JSON 行的形式追加写入 dir 目录下的段文件（00000001.seg、00000002.seg……），当前段超过 defaultSegmentSize 后写入新的段。
+每行是一条操作：put 写入或更新一条日志，del 删除一条日志，文件内容只追加不修改。
+内存中的索引记录每条日志所在的段和位置，以及用于过滤的名称、日志级别、服务、链路 ID 和过期时间，
+按 (created_at, _id) 排序，查询时只有匹配索引条件的日志才会从文件中读取。
+启动时按顺序重放所有段重建索引，进程在写入过程中退出时，最后一个不完整的行会被截断。
+从最旧的段开始，没有有效日志的段会被删除（删除操作所在的段只会在它之前的段都被删除后才被删除，因此重放时不会恢复已经删除的日志）。
+*/
+
+const defaultSegmentSize = 64 << 20 // 段文件的大小上限
+
+// 段文件中的一条操作
+type fileOp struct {
+	Op    string    `json:"op"` // put 或 del
+	Entry *LogEntry `json:"entry,omitempty"`
+	ID    string    `json:"id,omitempty"`
+}
+
+// 索引中的一条日志
+type fileRecord struct {
+	key      sortKey
+	segment  int   // 所在的段
+	offset   int64 // 所在行在段中的位置
+	size     int64 // 所在行的长度
+	name     string
+	severity string
+	service  string
+	traceID  string
+	expireAt *time.Time
+}
+
+// FileStore 把日志保存在本地的段文件中
+type FileStore struct {
+	dir string
+
+	mu         sync.RWMutex
+	records    []*fileRecord // 按 (created_at, _id) 升序排列
+	byID       map[string]*fileRecord
+	segments   map[int]*os.File // 所有段文件
+	live       map[int]int      // 每个段中有效日志的条数
+	active     int              // 当前追加写入的段
+	activeSize int64
+	lastPurge  time.Time
+}
+
+// NewFileStore 打开 dir 目录下的段文件并重建索引，目录不存在时创建
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &FileStore{
+		dir:       dir,
+		byID:      make(map[string]*fileRecord),
+		segments:  make(map[int]*os.File),
+		live:      make(map[int]int),
+		lastPurge: time.Now(),
+	}
+
+	ids, err := segmentIDs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		f, err := os.OpenFile(s.segmentPath(id), os.O_RDWR, 0)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.segments[id] = f
+
+		size, err := s.replay(id, f)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.active, s.activeSize = id, size
+	}
+
+	if len(ids) == 0 {
+		if err := s.rotateLocked(); err != nil {
+			return nil, err
+		}
+	}
+
+	s.records = make([]*fileRecord, 0, len(s.byID))
+	for _, rec := range s.byID {
+		s.records = append(s.records, rec)
+	}
+	sort.Slice(s.records, func(i, j int) bool { return s.records[i].key.less(s.records[j].key) })
+
+	s.removeDeadSegmentsLocked()
+	return s, nil
+}
+
+// 返回目录中所有段文件的编号，按从旧到新排列
+func segmentIDs(dir string) ([]int, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for _, file := range files {
+		name, ok := strings.CutSuffix(file.Name(), ".seg")
+		if !ok || file.IsDir() {
+			continue
+		}
+		id, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (s *FileStore) segmentPath(id int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%08d.seg", id))
+}
+
+// 重放一个段中的所有操作，返回段的有效长度
+func (s *FileStore) replay(id int, f *os.File) (int64, error) {
+	r := bufio.NewReader(f)
+
+	var offset int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				// 写入过程中退出留下的不完整的行
+				if err := f.Truncate(offset); err != nil {
+					return 0, err
+				}
+			}
+			return offset, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		var op fileOp
+		if err := json.Unmarshal(line, &op); err != nil {
+			return 0, fmt.Errorf("%s: corrupt record at offset %d: %w", s.segmentPath(id), offset, err)
+		}
+
+		switch {
+		case op.Op == "put" && op.Entry != nil:
+			s.putLocked(newFileRecord(op.Entry, id, offset, int64(len(line))))
+		case op.Op == "del":
+			if old, ok := s.byID[op.ID]; ok {
+				s.live[old.segment]--
+				delete(s.byID, op.ID)
+			}
+		}
+		offset += int64(len(line))
+	}
+}
+
+func newFileRecord(entry *LogEntry, segment int, offset, size int64) *fileRecord {
+	return &fileRecord{
+		key:      entryKey(entry),
+		segment:  segment,
+		offset:   offset,
+		size:     size,
+		name:     entry.Name,
+		severity: entry.Severity,
+		service:  entry.Service,
+		traceID:  entry.TraceID,
+		expireAt: entry.ExpireAt,
+	}
+}
+
+// 在 byID 中加入或替换一条日志，并更新段中有效日志的条数
+func (s *FileStore) putLocked(rec *fileRecord) {
+	if old, ok := s.byID[rec.key.id]; ok {
+		s.live[old.segment]--
+	}
+	s.byID[rec.key.id] = rec
+	s.live[rec.segment]++
+}
+
+// 开始写入新的段
+func (s *FileStore) rotateLocked() error {
+	id := s.active + 1
+	f, err := os.OpenFile(s.segmentPath(id), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if cur, ok := s.segments[s.active]; ok {
+		if err := cur.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	s.segments[id] = f
+	s.active, s.activeSize = id, 0
+	return nil
+}
+
+// 把一组操作追加写入当前段并同步到磁盘，返回每个操作所在的位置和长度
+func (s *FileStore) appendLocked(ops []fileOp) (segment int, offsets, sizes []int64, err error) {
+	var buf bytes.Buffer
+	offsets = make([]int64, len(ops))
+	sizes = make([]int64, len(ops))
+	for i := range ops {
+		start := buf.Len()
+		line, err := json.Marshal(&ops[i])
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+		offsets[i] = int64(start)
+		sizes[i] = int64(buf.Len() - start)
+	}
+
+	if s.activeSize > 0 && s.activeSize+int64(buf.Len()) > defaultSegmentSize {
+		if err := s.rotateLocked(); err != nil {
+			return 0, nil, nil, err
+		}
+	}
+
+	f := s.segments[s.active]
+	if _, err := f.WriteAt(buf.Bytes(), s.activeSize); err != nil {
+		_ = f.Truncate(s.activeSize)
+		return 0, nil, nil, err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Truncate(s.activeSize)
+		return 0, nil, nil, err
+	}
+
+	for i := range offsets {
+		offsets[i] += s.activeSize
+	}
+	s.activeSize += int64(buf.Len())
+	return s.active, offsets, sizes, nil
+}
+
+// 从最旧的段开始删除没有有效日志的段
+func (s *FileStore) removeDeadSegmentsLocked() {
+	ids := make([]int, 0, len(s.segments))
+	for id := range s.segments {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		if id == s.active || s.live[id] > 0 {
+			return
+		}
+		s.segments[id].Close()
+		if err := os.Remove(s.segmentPath(id)); err != nil {
+			return
+		}
+		delete(s.segments, id)
+		delete(s.live, id)
+	}
+}
+
+// Init 不需要做任何准备
+func (s *FileStore) Init(ctx context.Context) error {
+	return nil
+}
+
+// InsertMany 写入一批日志，忽略 ID 已经存在的日志
+func (s *FileStore) InsertMany(ctx context.Context, entries []LogEntry) error {
+	for i := range entries {
+		if _, err := primitive.ObjectIDFromHex(entries[i].ID); err != nil {
+			return ErrInvalidID
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[string]struct{}, len(entries))
+	ops := make([]fileOp, 0, len(entries))
+	for i := range entries {
+		id := entries[i].ID
+		if _, ok := s.byID[id]; ok {
+			continue
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		ops = append(ops, fileOp{Op: "put", Entry: &entries[i]})
+	}
+
+	if len(ops) > 0 {
+		segment, offsets, sizes, err := s.appendLocked(ops)
+		if err != nil {
+			return err
+		}
+		for i, op := range ops {
+			rec := newFileRecord(op.Entry, segment, offsets[i], sizes[i])
+			s.putLocked(rec)
+			s.insertRecordLocked(rec)
+		}
+	}
+
+	if time.Since(s.lastPurge) >= purgeInterval {
+		return s.purgeLocked(time.Now())
+	}
+	return nil
+}
+
+// 按排序位置插入一条索引记录，新日志通常排在最后
+func (s *FileStore) insertRecordLocked(rec *fileRecord) {
+	n := len(s.records)
+	if n == 0 || s.records[n-1].key.less(rec.key) {
+		s.records = append(s.records, rec)
+		return
+	}
+	i := sort.Search(n, func(i int) bool { return rec.key.less(s.records[i].key) })
+	s.records = append(s.records, nil)
+	copy(s.records[i+1:], s.records[i:])
+	s.records[i] = rec
+}
+
+// 删除过期的日志
+func (s *FileStore) purgeLocked(now time.Time) error {
+	var recs []*fileRecord
+	for _, rec := range s.records {
+		if expired(rec.expireAt, now) {
+			recs = append(recs, rec)
+		}
+	}
+	s.lastPurge = now
+	return s.removeLocked(recs)
+}
+
+// 写入删除操作并从索引中删除这些日志
+func (s *FileStore) removeLocked(recs []*fileRecord) error {
+	if len(recs) == 0 {
+		return nil
+	}
+
+	ops := make([]fileOp, len(recs))
+	removed := make(map[*fileRecord]struct{}, len(recs))
+	for i, rec := range recs {
+		ops[i] = fileOp{Op: "del", ID: rec.key.id}
+		removed[rec] = struct{}{}
+	}
+	if _, _, _, err := s.appendLocked(ops); err != nil {
+		return err
+	}
+
+	for _, rec := range recs {
+		s.live[rec.segment]--
+		delete(s.byID, rec.key.id)
+	}
+
+	kept := s.records[:0]
+	for _, rec := range s.records {
+		if _, ok := removed[rec]; !ok {
+			kept = append(kept, rec)
+		}
+	}
+	for i := len(kept); i < len(s.records); i++ {
+		s.records[i] = nil
+	}
+	s.records = kept
+
+	s.removeDeadSegmentsLocked()
+	return nil
+}
+
+// 从段文件中读取一条日志
+func (s *FileStore) readLocked(rec *fileRecord) (*LogEntry, error) {
+	f, ok := s.segments[rec.segment]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	line := make([]byte, rec.size)
+	if _, err := f.ReadAt(line, rec.offset); err != nil {
+		return nil, err
+	}
+
+	var op fileOp
+	if err := json.Unmarshal(line, &op); err != nil {
+		return nil, err
+	}
+	if op.Entry == nil {
+		return nil, fmt.Errorf("%s: no log entry at offset %d", s.segmentPath(rec.segment), rec.offset)
+	}
+	return op.Entry, nil
+}
+
+// Get 按 ID 查询一条日志
+func (s *FileStore) Get(ctx context.Context, id string) (*LogEntry, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rec, ok := s.byID[id]
+	if !ok || expired(rec.expireAt, time.Now()) {
+		return nil, ErrNotFound
+	}
+	return s.readLocked(rec)
+}
+
+// Update 追加写入修改了名称和内容的日志
+func (s *FileStore) Update(ctx context.Context, entry *LogEntry) error {
+	if _, err := primitive.ObjectIDFromHex(entry.ID); err != nil {
+		return ErrInvalidID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.byID[entry.ID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	updated, err := s.readLocked(old)
+	if err != nil {
+		return err
+	}
+	updated.Name = entry.Name
+	updated.Data = entry.Data
+	updated.UpdatedAt = time.Now()
+
+	segment, offsets, sizes, err := s.appendLocked([]fileOp{{Op: "put", Entry: updated}})
+	if err != nil {
+		return err
+	}
+
+	// 排序键没有变化，原位置替换
+	rec := newFileRecord(updated, segment, offsets[0], sizes[0])
+	s.putLocked(rec)
+	i := sort.Search(len(s.records), func(i int) bool { return !s.records[i].key.less(rec.key) })
+	s.records[i] = rec
+
+	s.removeDeadSegmentsLocked()
+	return nil
+}
+
+// Find 按条件分页查询日志
+func (s *FileStore) Find(ctx context.Context, f Filter) (*Page, error) {
+	return findPage(f, s.each)
+}
+
+// Scan 按条件遍历所有匹配的日志
+func (s *FileStore) Scan(ctx context.Context, f Filter, fn func(*LogEntry) error) error {
+	return scanEntries(ctx, f, s.each, fn)
+}
+
+// Count 返回匹配条件的日志条数
+func (s *FileStore) Count(ctx context.Context, f Filter) (int64, error) {
+	return countEntries(f, s.each)
+}
+
+// Aggregate 遍历日志并统计
+func (s *FileStore) Aggregate(ctx context.Context, a Aggregation) ([]Bucket, error) {
+	return aggregateEntries(a, s.each)
+}
+
+// Delete 删除匹配条件的日志
+func (s *FileStore) Delete(ctx context.Context, f Filter) (int64, error) {
+	ids := make(map[string]struct{})
+	err := s.each(f, func(entry *LogEntry) (bool, error) {
+		ids[entry.ID] = struct{}{}
+		return true, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 遍历之后可能已经被删除的日志不再重复删除
+	recs := make([]*fileRecord, 0, len(ids))
+	for id := range ids {
+		if rec, ok := s.byID[id]; ok {
+			recs = append(recs, rec)
+		}
+	}
+	if err := s.removeLocked(recs); err != nil {
+		return 0, err
+	}
+	return int64(len(recs)), nil
+}
+
+// Drop 删除所有段文件
+func (s *FileStore) Drop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, f := range s.segments {
+		f.Close()
+		if err := os.Remove(s.segmentPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		delete(s.segments, id)
+	}
+
+	s.records = nil
+	s.byID = make(map[string]*fileRecord)
+	s.live = make(map[int]int)
+	return s.rotateLocked()
+}
+
+// Ping 检查当前段文件是否可以访问
+func (s *FileStore) Ping(ctx context.Context) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f, ok := s.segments[s.active]
+	if !ok {
+		return errors.New("file store is closed")
+	}
+	_, err := f.Stat()
+	return err
+}
+
+// Close 关闭所有段文件
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for id, f := range s.segments {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(s.segments, id)
+	}
+	return err
+}
+
+// 按条件遍历日志：先用索引过滤，再读取匹配的日志
+func (s *FileStore) each(f Filter, fn func(*LogEntry) (bool, error)) error {
+	s.mu.RLock()
+	records := make([]*fileRecord, len(s.records))
+	copy(records, s.records)
+	s.mu.RUnlock()
+
+	now := time.Now()
+	return scanRange(f, len(records), func(i int) sortKey {
+		return records[i].key
+	}, func(i int) (bool, error) {
+		rec := records[i]
+		if expired(rec.expireAt, now) || !rec.matches(f) {
+			return true, nil
+		}
+
+		// 复制索引之后日志可能被更新或删除，读取最新的记录
+		s.mu.RLock()
+		cur, ok := s.byID[rec.key.id]
+		if !ok {
+			s.mu.RUnlock()
+			return true, nil
+		}
+		entry, err := s.readLocked(cur)
+		s.mu.RUnlock()
+		if err != nil {
+			return false, err
+		}
+
+		if !f.matches(entry) {
+			return true, nil
+		}
+		return fn(entry)
+	})
+}
+
+// 判断索引中的字段是否匹配条件，data 中的关键字需要读取日志后才能判断
+func (r *fileRecord) matches(f Filter) bool {
+	return (f.Name == "" || r.name == f.Name) &&
+		(f.Severity == "" || r.severity == f.Severity) &&
+		(f.Service == "" || r.service == f.Service) &&
+		(f.TraceID == "" || r.traceID == f.TraceID)
+}
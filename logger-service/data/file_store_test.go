@@ -0,0 +1,159 @@
+package data
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileStoreReplay(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := testEntries(3, "event")
+	if err := s.InsertMany(ctx, entries); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(ctx, &LogEntry{ID: entries[0].ID, Name: "renamed", Data: "changed"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Delete(ctx, Filter{From: entries[2].CreatedAt}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打开后通过重放段文件恢复更新和删除
+	s, err = NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if n, _ := s.Count(ctx, Filter{}); n != 2 {
+		t.Errorf("Count = %d, want 2", n)
+	}
+	got, err := s.Get(ctx, entries[0].ID)
+	if err != nil || got.Name != "renamed" || got.Data != "changed" {
+		t.Errorf("Get = %+v, %v, want the updated log", got, err)
+	}
+	if _, err := s.Get(ctx, entries[2].ID); err == nil {
+		t.Error("deleted log was restored by the replay")
+	}
+}
+
+func TestFileStoreOpenDamagedSegment(t *testing.T) {
+	tests := []struct {
+		name      string
+		tail      string // 追加到段文件末尾的内容
+		wantCount int64
+		wantErr   string
+	}{
+		{"incomplete last line is truncated", `{"op":"put","entry":{"name":"half`, 2, ""},
+		{"clean segment", "", 2, ""},
+		{"corrupt complete line", "not json\n", 0, "corrupt record"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+
+			s, err := NewFileStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.InsertMany(ctx, testEntries(2, "event")); err != nil {
+				t.Fatal(err)
+			}
+			s.Close()
+
+			path := filepath.Join(dir, "00000001.seg")
+			before, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = f.WriteString(tt.tail)
+			f.Close()
+
+			s, err = NewFileStore(dir)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewFileStore = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			if n, _ := s.Count(ctx, Filter{}); n != tt.wantCount {
+				t.Errorf("Count = %d, want %d", n, tt.wantCount)
+			}
+			after, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if after.Size() != before.Size() {
+				t.Errorf("segment size = %d, want %d after truncating the incomplete line", after.Size(), before.Size())
+			}
+
+			// 截断后继续追加写入的日志在下一次重放时可以读取
+			if err := s.InsertMany(ctx, testEntries(1, "event")); err != nil {
+				t.Fatal(err)
+			}
+			if n, _ := s.Count(ctx, Filter{}); n != tt.wantCount+1 {
+				t.Errorf("Count after insert = %d, want %d", n, tt.wantCount+1)
+			}
+		})
+	}
+}
+
+func TestFileStoreRemovesDeadSegments(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	entries := testEntries(2, "event")
+	if err := s.InsertMany(ctx, entries[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	// 手动切换到新的段，旧段中的日志全部删除后旧段被删除
+	s.mu.Lock()
+	if err := s.rotateLocked(); err != nil {
+		s.mu.Unlock()
+		t.Fatal(err)
+	}
+	s.mu.Unlock()
+	if err := s.InsertMany(ctx, entries[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Delete(ctx, Filter{To: entries[1].CreatedAt}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "00000001.seg")); !os.IsNotExist(err) {
+		t.Errorf("first segment should be removed, stat = %v", err)
+	}
+	if n, _ := s.Count(ctx, Filter{}); n != 1 {
+		t.Errorf("Count = %d, want 1", n)
+	}
+}
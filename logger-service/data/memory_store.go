@@ -0,0 +1,232 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/**
+该代码定义了把日志保存在内存中的 MemoryStore，进程退出后日志丢失，适合测试。
+日志按 (created_at, _id) 升序保存在切片中，并按 ID 建立索引。
+保存的日志不会被原地修改，Update 用修改后的副本替换原来的日志，因此遍历时只需要复制切片，不需要在遍历期间持有锁。
+*/
+
+// MemoryStore 把日志保存在内存中
+type MemoryStore struct {
+	mu        sync.RWMutex
+	entries   []*LogEntry // 按 (created_at, _id) 升序排列
+	byID      map[string]*LogEntry
+	lastPurge time.Time
+}
+
+// NewMemoryStore 创建一个空的 MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		byID:      make(map[string]*LogEntry),
+		lastPurge: time.Now(),
+	}
+}
+
+// Init 不需要做任何准备
+func (m *MemoryStore) Init(ctx context.Context) error {
+	return nil
+}
+
+// InsertMany 写入一批日志，忽略 ID 已经存在的日志
+func (m *MemoryStore) InsertMany(ctx context.Context, entries []LogEntry) error {
+	for i := range entries {
+		if _, err := primitive.ObjectIDFromHex(entries[i].ID); err != nil {
+			return ErrInvalidID
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range entries {
+		if _, ok := m.byID[entries[i].ID]; ok {
+			continue
+		}
+		entry := entries[i]
+		m.insertLocked(&entry)
+	}
+
+	if time.Since(m.lastPurge) >= purgeInterval {
+		m.purgeLocked(time.Now())
+	}
+	return nil
+}
+
+// 按排序位置插入一条日志，新日志通常排在最后
+func (m *MemoryStore) insertLocked(entry *LogEntry) {
+	key := entryKey(entry)
+	n := len(m.entries)
+	if n == 0 || entryKey(m.entries[n-1]).less(key) {
+		m.entries = append(m.entries, entry)
+	} else {
+		i := sort.Search(n, func(i int) bool { return key.less(entryKey(m.entries[i])) })
+		m.entries = append(m.entries, nil)
+		copy(m.entries[i+1:], m.entries[i:])
+		m.entries[i] = entry
+	}
+	m.byID[entry.ID] = entry
+}
+
+// 删除过期的日志
+func (m *MemoryStore) purgeLocked(now time.Time) {
+	m.removeLocked(func(entry *LogEntry) bool { return expired(entry.ExpireAt, now) })
+	m.lastPurge = now
+}
+
+// 删除 remove 返回 true 的日志，返回删除的条数
+func (m *MemoryStore) removeLocked(remove func(*LogEntry) bool) int64 {
+	var n int64
+	kept := m.entries[:0]
+	for _, entry := range m.entries {
+		if remove(entry) {
+			delete(m.byID, entry.ID)
+			n++
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	// 清空尾部的指针，以便被删除的日志可以被回收
+	for i := len(kept); i < len(m.entries); i++ {
+		m.entries[i] = nil
+	}
+	m.entries = kept
+	return n
+}
+
+// Get 按 ID 查询一条日志
+func (m *MemoryStore) Get(ctx context.Context, id string) (*LogEntry, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entry, ok := m.byID[id]
+	if !ok || expired(entry.ExpireAt, time.Now()) {
+		return nil, ErrNotFound
+	}
+	out := *entry
+	return &out, nil
+}
+
+// Update 更新日志的名称和内容
+func (m *MemoryStore) Update(ctx context.Context, entry *LogEntry) error {
+	if _, err := primitive.ObjectIDFromHex(entry.ID); err != nil {
+		return ErrInvalidID
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old, ok := m.byID[entry.ID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	updated := *old
+	updated.Name = entry.Name
+	updated.Data = entry.Data
+	updated.UpdatedAt = time.Now()
+
+	// 排序键没有变化，原位置替换
+	key := entryKey(old)
+	i := sort.Search(len(m.entries), func(i int) bool { return !entryKey(m.entries[i]).less(key) })
+	m.entries[i] = &updated
+	m.byID[entry.ID] = &updated
+	return nil
+}
+
+// Find 按条件分页查询日志
+func (m *MemoryStore) Find(ctx context.Context, f Filter) (*Page, error) {
+	return findPage(f, m.each)
+}
+
+// Scan 按条件遍历所有匹配的日志
+func (m *MemoryStore) Scan(ctx context.Context, f Filter, fn func(*LogEntry) error) error {
+	return scanEntries(ctx, f, m.each, fn)
+}
+
+// Count 返回匹配条件的日志条数
+func (m *MemoryStore) Count(ctx context.Context, f Filter) (int64, error) {
+	return countEntries(f, m.each)
+}
+
+// Aggregate 遍历日志并统计
+func (m *MemoryStore) Aggregate(ctx context.Context, a Aggregation) ([]Bucket, error) {
+	return aggregateEntries(a, m.each)
+}
+
+// Delete 删除匹配条件的日志
+func (m *MemoryStore) Delete(ctx context.Context, f Filter) (int64, error) {
+	ids := make(map[string]struct{})
+	err := m.each(f, func(entry *LogEntry) (bool, error) {
+		ids[entry.ID] = struct{}{}
+		return true, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.removeLocked(func(entry *LogEntry) bool {
+		_, ok := ids[entry.ID]
+		return ok
+	}), nil
+}
+
+// Drop 删除所有日志
+func (m *MemoryStore) Drop(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries = nil
+	m.byID = make(map[string]*LogEntry)
+	return nil
+}
+
+// Ping 总是返回 nil
+func (m *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close 不需要释放任何资源
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// 按条件遍历日志，传给 fn 的是日志的副本
+func (m *MemoryStore) each(f Filter, fn func(*LogEntry) (bool, error)) error {
+	m.mu.RLock()
+	entries := make([]*LogEntry, len(m.entries))
+	copy(entries, m.entries)
+	m.mu.RUnlock()
+
+	now := time.Now()
+	return scanRange(f, len(entries), func(i int) sortKey {
+		return entryKey(entries[i])
+	}, func(i int) (bool, error) {
+		entry := entries[i]
+		if expired(entry.ExpireAt, now) || !f.matches(entry) {
+			return true, nil
+		}
+		out := *entry
+		return fn(&out)
+	})
+}
+
+// 日志的排序键
+func entryKey(entry *LogEntry) sortKey {
+	return sortKey{createdAt: entry.CreatedAt, id: entry.ID}
+}
@@ -2,82 +2,109 @@ package data
 
 import (
 	"context"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
 	"time"
 )
 
-var client *mongo.Client
+// 当前使用的日志存储，由 New 设置
+var store LogStore
 
-func New(mongo *mongo.Client) Models {
-	client = mongo
+// New 使用 s 作为日志存储创建数据模型
+func New(s LogStore) Models {
+	store = s
 
 	return Models{
 		LogEntry: LogEntry{},
+		Store:    s,
 	}
 }
 
 type Models struct {
 	LogEntry LogEntry
+	Store    LogStore
+	Writer   *Writer // 批量写入日志，由 main 创建
 }
 
+// 未指定日志级别时使用的默认值，兼容只发送 name 和 data 的旧客户端
+const DefaultSeverity = "INFO"
+
 type LogEntry struct {
-	ID        string    `bson:"_id,omitempty" json:"id,omitempty"`
-	Name      string    `bson:"name" json:"name"`
-	Data      string    `bson:"data" json:"data"`
-	CreatedAt time.Time `bson:"created_at" json:"created_at"`
-	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+	ID         string         `bson:"_id,omitempty" json:"id,omitempty"`
+	Name       string         `bson:"name" json:"name"`
+	Data       string         `bson:"data" json:"data"`
+	Severity   string         `bson:"severity,omitempty" json:"severity,omitempty"`     // 日志级别：INFO、WARNING 或 ERROR
+	Flagged    bool           `bson:"flagged,omitempty" json:"flagged,omitempty"`       // 需要关注的日志，例如 WARNING
+	Service    string         `bson:"service,omitempty" json:"service,omitempty"`       // 产生日志的服务
+	Host       string         `bson:"host,omitempty" json:"host,omitempty"`             // 产生日志的主机
+	TraceID    string         `bson:"trace_id,omitempty" json:"trace_id,omitempty"`     // 请求或链路 ID，用于关联同一个请求的日志
+	Attributes map[string]any `bson:"attributes,omitempty" json:"attributes,omitempty"` // 任意的结构化字段
+	CreatedAt  time.Time      `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time      `bson:"updated_at" json:"updated_at"`
+	ExpireAt   *time.Time     `bson:"expire_at,omitempty" json:"expire_at,omitempty"` // 到期后由 TTL 索引删除，为空表示永久保留
 }
 
+// Insert 立即插入一条日志。高并发写入应使用 Writer，它把多条日志合并为一次写入
 func (l *LogEntry) Insert(entry LogEntry) error {
-	collection := client.Database("logs").Collection("logs")
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
 
-	_, err := collection.InsertOne(context.TODO(), LogEntry{
-		Name:      entry.Name,
-		Data:      entry.Data,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	})
-	if err != nil {
+	doc := newDocument(entry, time.Now())
+	doc.ID = primitive.NewObjectID().Hex()
+	if err := store.InsertMany(ctx, []LogEntry{doc}); err != nil {
 		log.Println("Error inserting into logs:", err)
 		return err
 	}
 
+	// 推送给正在 tail 的订阅者
+	tail.publish(&doc)
+
 	return nil
 }
 
+// 根据写入的日志生成要保存的文档：设置创建时间、默认日志级别和过期时间
+// 创建时间精确到毫秒，与 MongoDB 保存的精度和游标的精度一致
+func newDocument(entry LogEntry, now time.Time) LogEntry {
+	now = now.Truncate(time.Millisecond)
+	doc := LogEntry{
+		Name:       entry.Name,
+		Data:       entry.Data,
+		Severity:   entry.Severity,
+		Flagged:    entry.Flagged,
+		Service:    entry.Service,
+		Host:       entry.Host,
+		TraceID:    entry.TraceID,
+		Attributes: entry.Attributes,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if doc.Severity == "" {
+		doc.Severity = DefaultSeverity
+	}
+	if expireAt := retention.expireAt(&doc, now); !expireAt.IsZero() {
+		doc.ExpireAt = &expireAt
+	}
+	return doc
+}
+
+// CreateIndexes 准备日志存储，例如创建查询使用的索引以及保留策略使用的 TTL 索引
+func (l *LogEntry) CreateIndexes(ctx context.Context) error {
+	return store.Init(ctx)
+}
+
 func (l *LogEntry) All() ([]*LogEntry, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
-	collection := client.Database("logs").Collection("logs")
-
-	opts := options.Find()
-	opts.SetSort(bson.D{{"created_at", -1}})
-
-	cursor, err := collection.Find(context.TODO(), bson.D{}, opts)
+	var logs []*LogEntry
+	err := store.Scan(ctx, Filter{}, func(entry *LogEntry) error {
+		logs = append(logs, entry)
+		return nil
+	})
 	if err != nil {
 		log.Println("Finding all docs error:", err)
 		return nil, err
 	}
-	defer cursor.Close(ctx)
-
-	var logs []*LogEntry
-
-	for cursor.Next(ctx) {
-		var item LogEntry
-
-		err := cursor.Decode(&item)
-		if err != nil {
-			log.Println("Error decoding log into slice:", err)
-			return nil, err
-		} else {
-			logs = append(logs, &item)
-		}
-	}
 	return logs, nil
 }
 
@@ -85,60 +112,20 @@ func (l *LogEntry) GetOne(id string) (*LogEntry, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
-	collection := client.Database("logs").Collection("logs")
-
-	docID, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		return nil, err
-	}
-
-	var entry LogEntry
-	err = collection.FindOne(ctx, bson.M{"_id": docID}).Decode(&entry)
-	if err != nil {
-		return nil, err
-	}
-
-	return &entry, nil
+	return store.Get(ctx, id)
 }
 
 func (l *LogEntry) DropCollection() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
-	collection := client.Database("logs").Collection("logs")
-
-	if err := collection.Drop(ctx); err != nil {
-		return err
-	}
-	return nil
+	return store.Drop(ctx)
 }
 
-func (l *LogEntry) Update() (*mongo.UpdateResult, error) {
+// Update 更新日志的名称和内容
+func (l *LogEntry) Update() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
-	collection := client.Database("logs").Collection("logs")
-
-	docID, err := primitive.ObjectIDFromHex(l.ID)
-	if err != nil {
-		return nil, err
-	}
-
-	result, err := collection.UpdateOne(
-		ctx,
-		bson.M{"_id": docID},
-		bson.D{
-			{"$set", bson.D{
-				{"name", l.Name},
-				{"data", l.Data},
-				{"updated_at", time.Now()},
-			}},
-		},
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return result, nil
+	return store.Update(ctx, l)
 }
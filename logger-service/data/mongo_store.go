@@ -0,0 +1,400 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/**
+该代码定义了使用 MongoDB 保存日志的 MongoStore。
+日志保存在 database 数据库的 collection 集合中，_id 是 ObjectID，过期的日志由 expire_at 上的 TTL 索引自动删除。
+InsertMany 使用无序写入，并忽略 _id 重复的错误，因此重试已经部分写入的批次不会产生重复日志。
+Close 断开 MongoDB 客户端连接。
+*/
+
+// MongoStore 把日志保存在 MongoDB 中
+type MongoStore struct {
+	client     *mongo.Client
+	collection *mongo.Collection
+}
+
+// NewMongoStore 创建一个使用 database 数据库中 collection 集合的 MongoStore
+func NewMongoStore(client *mongo.Client, database, collection string) *MongoStore {
+	return &MongoStore{
+		client:     client,
+		collection: client.Database(database).Collection(collection),
+	}
+}
+
+// Init 创建查询使用的索引以及保留策略使用的 TTL 索引，索引已经存在时不做任何操作
+func (m *MongoStore) Init(ctx context.Context) error {
+	_, err := m.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "name", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "severity", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "service", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "trace_id", Value: 1}}, Options: options.Index().SetSparse(true)},
+		// TTL 索引：expire_at 到期后自动删除日志，没有 expire_at 的日志永久保留
+		{Keys: bson.D{{Key: "expire_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// InsertMany 使用 InsertMany 写入一批日志，忽略 _id 重复（之前的尝试已经写入）的错误
+func (m *MongoStore) InsertMany(ctx context.Context, entries []LogEntry) error {
+	docs := make([]any, 0, len(entries))
+	for i := range entries {
+		doc, err := withObjectID(&entries[i])
+		if err != nil {
+			return err
+		}
+		docs = append(docs, doc)
+	}
+
+	_, err := m.collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		for _, e := range bulkErr.WriteErrors {
+			if !mongo.IsDuplicateKeyError(e) {
+				return err
+			}
+		}
+		return nil
+	}
+	return err
+}
+
+// LogEntry 的 ID 是字符串，保存时需要转换为 ObjectID，与 InsertOne 生成的 _id 类型一致
+func withObjectID(entry *LogEntry) (bson.D, error) {
+	id, err := primitive.ObjectIDFromHex(entry.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	withoutID := *entry
+	withoutID.ID = ""
+	raw, err := bson.Marshal(&withoutID)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc bson.D
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	return append(bson.D{{Key: "_id", Value: id}}, doc...), nil
+}
+
+// Get 按 ID 查询一条日志
+func (m *MongoStore) Get(ctx context.Context, id string) (*LogEntry, error) {
+	docID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrInvalidID
+	}
+
+	var entry LogEntry
+	err = m.collection.FindOne(ctx, bson.M{"_id": docID}).Decode(&entry)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// Update 更新日志的名称和内容
+func (m *MongoStore) Update(ctx context.Context, entry *LogEntry) error {
+	docID, err := primitive.ObjectIDFromHex(entry.ID)
+	if err != nil {
+		return ErrInvalidID
+	}
+
+	result, err := m.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": docID},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "name", Value: entry.Name},
+				{Key: "data", Value: entry.Data},
+				{Key: "updated_at", Value: time.Now()},
+			}},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Find 按条件分页查询日志
+func (m *MongoStore) Find(ctx context.Context, f Filter) (*Page, error) {
+	limit := pageLimit(f.Limit)
+
+	query, err := f.query()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find()
+	opts.SetSort(f.sort())
+	opts.SetLimit(int64(limit) + 1) // 多取一条用于判断是否还有下一页
+
+	cursor, err := m.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	logs := make([]*LogEntry, 0, limit)
+	if err := cursor.All(ctx, &logs); err != nil {
+		return nil, err
+	}
+
+	page := &Page{Logs: logs}
+	if len(logs) > limit {
+		page.Logs = logs[:limit]
+		page.NextCursor = encodeCursor(page.Logs[limit-1])
+	}
+	return page, nil
+}
+
+// Scan 按条件遍历所有匹配的日志
+func (m *MongoStore) Scan(ctx context.Context, f Filter, fn func(*LogEntry) error) error {
+	query, err := f.query()
+	if err != nil {
+		return err
+	}
+
+	cursor, err := m.collection.Find(ctx, query, options.Find().SetSort(f.sort()))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var entry LogEntry
+		if err := cursor.Decode(&entry); err != nil {
+			return err
+		}
+		if err := fn(&entry); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// Count 返回匹配条件的日志条数
+func (m *MongoStore) Count(ctx context.Context, f Filter) (int64, error) {
+	query, err := f.query()
+	if err != nil {
+		return 0, err
+	}
+	return m.collection.CountDocuments(ctx, query)
+}
+
+// Delete 删除匹配条件的日志
+func (m *MongoStore) Delete(ctx context.Context, f Filter) (int64, error) {
+	query, err := f.query()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := m.collection.DeleteMany(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// Aggregate 使用聚合管道统计日志
+func (m *MongoStore) Aggregate(ctx context.Context, a Aggregation) ([]Bucket, error) {
+	f := a.Filter
+	f.Cursor = ""
+	query, err := f.query()
+	if err != nil {
+		return nil, err
+	}
+
+	// 分组的键：时间桶 t 以及每个分组字段 k0、k1……（$group 的键中不能有 "."）
+	id := bson.D{}
+	sortBy := bson.D{}
+	if a.Top > 0 {
+		sortBy = append(sortBy, bson.E{Key: "count", Value: -1})
+	}
+	if a.Interval != "" {
+		// created_at 减去它对时间桶长度取模的余数，即时间桶的开始时间（UTC）
+		ms := intervals[a.Interval].Milliseconds()
+		id = append(id, bson.E{Key: "t", Value: bson.D{{Key: "$subtract", Value: bson.A{
+			"$created_at",
+			bson.D{{Key: "$mod", Value: bson.A{bson.D{{Key: "$toLong", Value: "$created_at"}}, ms}}},
+		}}}})
+		sortBy = append(sortBy, bson.E{Key: "_id.t", Value: 1})
+	}
+	for i, field := range a.GroupBy {
+		var value any = "$" + field
+		if strings.HasPrefix(field, "attributes.") {
+			// 属性可以是任意类型，统一转换为字符串
+			value = bson.D{{Key: "$convert", Value: bson.D{
+				{Key: "input", Value: "$" + field},
+				{Key: "to", Value: "string"},
+				{Key: "onError", Value: ""},
+				{Key: "onNull", Value: ""},
+			}}}
+		}
+		key := fmt.Sprintf("k%d", i)
+		id = append(id, bson.E{Key: key, Value: value})
+		sortBy = append(sortBy, bson.E{Key: "_id." + key, Value: 1})
+	}
+
+	limit := MaxBuckets + 1 // 多取一条用于判断是否超过上限
+	if a.Top > 0 && a.Top < limit {
+		limit = a.Top
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: query}},
+		{{Key: "$group", Value: bson.D{{Key: "_id", Value: id}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+	}
+	if len(sortBy) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: sortBy}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+
+	cursor, err := m.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		ID    bson.M `bson:"_id"`
+		Count int64  `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) > MaxBuckets {
+		return nil, errTooManyBuckets
+	}
+
+	buckets := make([]Bucket, 0, len(rows))
+	for _, row := range rows {
+		b := Bucket{Count: row.Count}
+		if t, ok := row.ID["t"].(primitive.DateTime); ok {
+			bt := t.Time().UTC()
+			b.Time = &bt
+		}
+		if len(a.GroupBy) > 0 {
+			b.Group = make(map[string]string, len(a.GroupBy))
+			for i, field := range a.GroupBy {
+				b.Group[field] = stringValue(row.ID[fmt.Sprintf("k%d", i)])
+			}
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, nil
+}
+
+// 分组的值，字段不存在时为空字符串
+func stringValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Drop 删除日志集合
+func (m *MongoStore) Drop(ctx context.Context) error {
+	return m.collection.Drop(ctx)
+}
+
+// Ping 检查 MongoDB 是否可用
+func (m *MongoStore) Ping(ctx context.Context) error {
+	return m.client.Ping(ctx, nil)
+}
+
+// Close 断开 MongoDB 客户端连接
+func (m *MongoStore) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	return m.client.Disconnect(ctx)
+}
+
+// 把过滤条件转换为 MongoDB 查询
+func (f Filter) query() (bson.D, error) {
+	query := bson.D{}
+
+	for _, field := range []struct{ key, value string }{
+		{"name", f.Name},
+		{"severity", f.Severity},
+		{"service", f.Service},
+		{"trace_id", f.TraceID},
+	} {
+		if field.value != "" {
+			query = append(query, bson.E{Key: field.key, Value: field.value})
+		}
+	}
+
+	createdAt := bson.D{}
+	if !f.From.IsZero() {
+		createdAt = append(createdAt, bson.E{Key: "$gte", Value: f.From})
+	}
+	if !f.To.IsZero() {
+		createdAt = append(createdAt, bson.E{Key: "$lt", Value: f.To})
+	}
+	if len(createdAt) > 0 {
+		query = append(query, bson.E{Key: "created_at", Value: createdAt})
+	}
+
+	if f.Query != "" {
+		query = append(query, bson.E{Key: "data", Value: primitive.Regex{Pattern: regexp.QuoteMeta(f.Query), Options: "i"}})
+	}
+
+	if f.Cursor != "" {
+		createdAt, id, err := decodeCursor(f.Cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		// 从游标之后开始：创建时间更晚（或更早），或者创建时间相同但 ID 更大（或更小）
+		op := "$lt"
+		if f.Ascending {
+			op = "$gt"
+		}
+		query = append(query, bson.E{Key: "$or", Value: bson.A{
+			bson.D{{Key: "created_at", Value: bson.D{{Key: op, Value: createdAt}}}},
+			bson.D{{Key: "created_at", Value: createdAt}, {Key: "_id", Value: bson.D{{Key: op, Value: id}}}},
+		}})
+	}
+
+	return query, nil
+}
+
+// 按 (created_at, _id) 排序，方向由 Ascending 决定
+func (f Filter) sort() bson.D {
+	order := -1
+	if f.Ascending {
+		order = 1
+	}
+	return bson.D{{Key: "created_at", Value: order}, {Key: "_id", Value: order}}
+}
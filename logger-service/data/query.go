@@ -0,0 +1,98 @@
+package data
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/**
+该代码定义了日志的查询功能。
+Filter 描述查询条件：按名称、日志级别、服务和链路 ID 精确匹配、按创建时间范围过滤、在 data 中按关键字不区分大小写地搜索，以及排序方向和分页参数。
+Find 使用基于游标的分页：结果按 (created_at, _id) 排序，游标记录上一页最后一条日志的创建时间和 ID，
+下一页从游标之后开始查询，因此翻页期间新写入的日志不会导致结果重复或遗漏。
+游标对调用方是不透明的字符串，只能原样传回。
+*/
+
+const (
+	DefaultPageSize = 50  // 未指定每页数量时的默认值
+	MaxPageSize     = 500 // 每页数量的上限
+)
+
+var (
+	ErrNotFound      = errors.New("log entry not found")
+	ErrInvalidID     = errors.New("invalid log entry id")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Filter 是查询日志的条件
+type Filter struct {
+	Name      string    // 按名称精确匹配
+	Severity  string    // 按日志级别精确匹配
+	Service   string    // 按产生日志的服务精确匹配
+	TraceID   string    // 按链路 ID 精确匹配
+	From      time.Time // 创建时间不早于 From
+	To        time.Time // 创建时间早于 To
+	Query     string    // 在 data 中搜索的关键字
+	Cursor    string    // 上一页返回的 NextCursor
+	Limit     int       // 每页数量
+	Ascending bool      // 是否按创建时间升序排列，默认降序
+}
+
+// Page 是一页查询结果
+type Page struct {
+	Logs       []*LogEntry `json:"logs"`
+	NextCursor string      `json:"next_cursor,omitempty"` // 为空表示没有下一页
+}
+
+// Find 按条件分页查询日志
+func (l *LogEntry) Find(ctx context.Context, f Filter) (*Page, error) {
+	return store.Find(ctx, f)
+}
+
+// 每页数量，未指定时使用默认值，超过上限时使用上限
+func pageLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		return MaxPageSize
+	}
+	return limit
+}
+
+// 游标的格式为 "<创建时间的毫秒数>:<ID>" 的 base64 编码
+func encodeCursor(entry *LogEntry) string {
+	raw := fmt.Sprintf("%d:%s", entry.CreatedAt.UnixMilli(), entry.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (time.Time, primitive.ObjectID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	ms, hex, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return time.Time{}, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	millis, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	return time.UnixMilli(millis).UTC(), id, nil
+}
@@ -0,0 +1,118 @@
+package data
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	id := primitive.NewObjectID()
+	createdAt := time.Date(2023, 11, 14, 10, 30, 0, 123_000_000, time.UTC)
+
+	gotTime, gotID, err := decodeCursor(encodeCursor(&LogEntry{ID: id.Hex(), CreatedAt: createdAt}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gotTime.Equal(createdAt) || gotID != id {
+		t.Errorf("decodeCursor = %s, %s, want %s, %s", gotTime, gotID.Hex(), createdAt, id.Hex())
+	}
+}
+
+func TestDecodeInvalidCursor(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "!!!"},
+		{"missing separator", encode("1700000000000")},
+		{"invalid time", encode("yesterday:6553f100ba7816bf8f01cfea")},
+		{"invalid id", encode("1700000000000:not-an-object-id")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := decodeCursor(tt.cursor); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("decodeCursor = %v, want %v", err, ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestPageLimit(t *testing.T) {
+	tests := []struct{ limit, want int }{
+		{0, DefaultPageSize},
+		{-1, DefaultPageSize},
+		{10, 10},
+		{MaxPageSize + 1, MaxPageSize},
+	}
+
+	for _, tt := range tests {
+		if got := pageLimit(tt.limit); got != tt.want {
+			t.Errorf("pageLimit(%d) = %d, want %d", tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestScanRange(t *testing.T) {
+	// 五条记录，每分钟一条，第三分钟有两条 ID 不同的记录
+	base := time.Date(2023, 11, 14, 10, 0, 0, 0, time.UTC)
+	ids := []primitive.ObjectID{
+		primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(),
+	}
+	keys := []sortKey{
+		{base, ids[0].Hex()},
+		{base.Add(time.Minute), ids[1].Hex()},
+		{base.Add(2 * time.Minute), ids[2].Hex()},
+		{base.Add(2 * time.Minute), ids[3].Hex()},
+		{base.Add(3 * time.Minute), ids[4].Hex()},
+	}
+	cursorAt := func(i int) string {
+		return encodeCursor(&LogEntry{ID: keys[i].id, CreatedAt: keys[i].createdAt})
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		limit  int // 大于 0 时最多取 limit 条
+		want   []int
+	}{
+		{"all ascending", Filter{Ascending: true}, 0, []int{0, 1, 2, 3, 4}},
+		{"all descending", Filter{}, 0, []int{4, 3, 2, 1, 0}},
+		{"from is inclusive", Filter{From: base.Add(2 * time.Minute), Ascending: true}, 0, []int{2, 3, 4}},
+		{"to is exclusive", Filter{To: base.Add(2 * time.Minute), Ascending: true}, 0, []int{0, 1}},
+		{"from and to", Filter{From: base.Add(time.Minute), To: base.Add(3 * time.Minute)}, 0, []int{3, 2, 1}},
+		{"cursor ascending", Filter{Cursor: cursorAt(2), Ascending: true}, 0, []int{3, 4}},
+		{"cursor descending", Filter{Cursor: cursorAt(3)}, 0, []int{2, 1, 0}},
+		{"cursor before from", Filter{Cursor: cursorAt(0), From: base.Add(2 * time.Minute), Ascending: true}, 0, []int{2, 3, 4}},
+		{"cursor at the end", Filter{Cursor: cursorAt(4), Ascending: true}, 0, nil},
+		{"stops when fn returns false", Filter{}, 2, []int{4, 3}},
+		{"empty range", Filter{From: base.Add(time.Hour)}, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			err := scanRange(tt.filter, len(keys), func(i int) sortKey { return keys[i] }, func(i int) (bool, error) {
+				got = append(got, i)
+				return tt.limit == 0 || len(got) < tt.limit, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scanRange = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if err := scanRange(Filter{Cursor: "!!!"}, len(keys), func(i int) sortKey { return keys[i] }, nil); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("scanRange with an invalid cursor = %v, want %v", err, ErrInvalidCursor)
+	}
+}
@@ -0,0 +1,105 @@
+package data
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+该代码定义了日志的保留策略。
+每条日志在写入时根据保留策略计算 expire_at 字段，到期后由日志存储删除：MongoStore 使用 TTL 索引（expireAfterSeconds 为 0），FileStore 和 MemoryStore 定期清理。
+保留时间按以下优先级匹配：按日志名称配置的保留时间、按日志级别配置的保留时间、默认保留时间；保留时间为 0 表示永久保留。
+修改保留策略只影响之后写入的日志，已经写入的日志保留原来的 expire_at。
+ParseRetention 解析形如 "default=30d;severity:ERROR=90d;name:auth=7d" 的配置。
+*/
+
+// Retention 是日志的保留策略
+type Retention struct {
+	Default    time.Duration            // 默认保留时间，0 表示永久保留
+	ByName     map[string]time.Duration // 按日志名称配置的保留时间
+	BySeverity map[string]time.Duration // 按日志级别配置的保留时间
+}
+
+// 当前使用的保留策略
+var retention Retention
+
+// SetRetention 设置之后写入的日志使用的保留策略
+func SetRetention(r Retention) {
+	retention = r
+}
+
+// 返回日志的过期时间，永久保留时返回零值
+func (r Retention) expireAt(entry *LogEntry, createdAt time.Time) time.Time {
+	keep, ok := r.ByName[entry.Name]
+	if !ok {
+		keep, ok = r.BySeverity[entry.Severity]
+	}
+	if !ok {
+		keep = r.Default
+	}
+
+	if keep <= 0 {
+		return time.Time{}
+	}
+	return createdAt.Add(keep)
+}
+
+// ParseRetention 解析保留策略，例如 "default=30d;severity:ERROR=90d;name:auth=7d"
+func ParseRetention(s string) (Retention, error) {
+	r := Retention{
+		ByName:     make(map[string]time.Duration),
+		BySeverity: make(map[string]time.Duration),
+	}
+
+	for _, item := range strings.Split(s, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return r, fmt.Errorf("invalid retention rule %q", item)
+		}
+
+		keep, err := ParseDays(strings.TrimSpace(value))
+		if err != nil {
+			return r, fmt.Errorf("invalid retention rule %q: %w", item, err)
+		}
+
+		key = strings.TrimSpace(key)
+		switch {
+		case key == "default":
+			r.Default = keep
+		case strings.HasPrefix(key, "name:"):
+			r.ByName[strings.TrimPrefix(key, "name:")] = keep
+		case strings.HasPrefix(key, "severity:"):
+			r.BySeverity[strings.ToUpper(strings.TrimPrefix(key, "severity:"))] = keep
+		default:
+			return r, fmt.Errorf("invalid retention rule %q: expected default, name:<name> or severity:<severity>", item)
+		}
+	}
+	return r, nil
+}
+
+// ParseDays 解析时间间隔，除 time.ParseDuration 支持的格式外还支持以天为单位，例如 "30d"
+func ParseDays(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number of days %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %q", s)
+	}
+	return d, nil
+}
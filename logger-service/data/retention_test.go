@@ -0,0 +1,103 @@
+package data
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+func TestParseRetention(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    Retention
+		wantErr string
+	}{
+		{
+			name: "empty keeps everything",
+			in:   "",
+			want: Retention{ByName: map[string]time.Duration{}, BySeverity: map[string]time.Duration{}},
+		},
+		{
+			name: "all rule kinds",
+			in:   "default=30d;severity:ERROR=90d;name:auth=7d",
+			want: Retention{
+				Default:    30 * day,
+				ByName:     map[string]time.Duration{"auth": 7 * day},
+				BySeverity: map[string]time.Duration{"ERROR": 90 * day},
+			},
+		},
+		{
+			name: "whitespace, empty rules and lower-case severities",
+			in:   " default = 12h ;; severity:warning=1d ; ",
+			want: Retention{
+				Default:    12 * time.Hour,
+				ByName:     map[string]time.Duration{},
+				BySeverity: map[string]time.Duration{"WARNING": day},
+			},
+		},
+		{
+			name: "zero keeps forever",
+			in:   "default=0d;name:audit=0s",
+			want: Retention{ByName: map[string]time.Duration{"audit": 0}, BySeverity: map[string]time.Duration{}},
+		},
+		{name: "missing value", in: "default", wantErr: `invalid retention rule "default"`},
+		{name: "unknown key", in: "service:broker=1d", wantErr: "expected default, name:<name> or severity:<severity>"},
+		{name: "invalid days", in: "default=xd", wantErr: `invalid number of days "xd"`},
+		{name: "negative days", in: "default=-1d", wantErr: "invalid number of days"},
+		{name: "negative duration", in: "default=-1h", wantErr: "negative duration"},
+		{name: "invalid duration", in: "default=forever", wantErr: "invalid retention rule"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRetention(tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseRetention = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRetention: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRetention = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetentionExpireAt(t *testing.T) {
+	r, err := ParseRetention("default=30d;severity:ERROR=90d;name:auth=7d;name:audit=0d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		entry LogEntry
+		want  time.Time
+	}{
+		{"default", LogEntry{Name: "event", Severity: "INFO"}, now.Add(30 * day)},
+		{"by severity", LogEntry{Name: "event", Severity: "ERROR"}, now.Add(90 * day)},
+		{"name wins over severity", LogEntry{Name: "auth", Severity: "ERROR"}, now.Add(7 * day)},
+		{"zero keeps forever", LogEntry{Name: "audit"}, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.expireAt(&tt.entry, now); !got.Equal(tt.want) {
+				t.Errorf("expireAt = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if got := (Retention{}).expireAt(&LogEntry{Name: "event"}, now); !got.IsZero() {
+		t.Errorf("without a policy expireAt = %s, want forever", got)
+	}
+}
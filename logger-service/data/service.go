@@ -0,0 +1,120 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/**
+该代码定义了日志服务 LogService，HTTP、net/rpc 和 gRPC 三种传输方式都通过它写入和查询日志，因此校验规则和行为完全一致。
+Write 先规范化日志（去掉名称两端的空白、日志级别转换为大写），再按 ValidationRules 校验：名称必填、data 不能超过 MaxDataSize 字节、
+配置了 AllowedNames 时名称必须在其中、客户端指定的 ID 必须是有效的 ObjectID；校验失败时返回 *ValidationError，可以用 errors.Is(err, ErrInvalidLog) 判断。
+校验通过的日志放入 Writer 的写入队列，创建时间、更新时间、默认日志级别和过期时间统一在写入时设置。
+各传输方式把返回的错误转换为各自的状态码。
+*/
+
+// DefaultMaxDataSize 是 data 默认的最大字节数
+const DefaultMaxDataSize = 256 << 10
+
+// ErrInvalidLog 表示日志没有通过校验
+var ErrInvalidLog = errors.New("invalid log entry")
+
+// ValidationError 描述日志没有通过校验的原因
+type ValidationError struct {
+	Field  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Reason)
+}
+
+// Is 使 errors.Is(err, ErrInvalidLog) 对所有校验错误成立
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidLog
+}
+
+// ValidationRules 是写入日志的校验规则
+type ValidationRules struct {
+	MaxDataSize  int      // data 的最大字节数，0 表示使用 DefaultMaxDataSize
+	AllowedNames []string // 允许的日志名称，为空时允许任意名称
+}
+
+// LogService 是所有传输方式共用的日志服务
+type LogService struct {
+	models       Models
+	maxDataSize  int
+	allowedNames map[string]struct{}
+}
+
+// NewLogService 创建一个使用 models 读写日志的 LogService，models.Writer 不能为空
+func NewLogService(models Models, rules ValidationRules) *LogService {
+	s := &LogService{
+		models:      models,
+		maxDataSize: rules.MaxDataSize,
+	}
+	if s.maxDataSize <= 0 {
+		s.maxDataSize = DefaultMaxDataSize
+	}
+	if len(rules.AllowedNames) > 0 {
+		s.allowedNames = make(map[string]struct{}, len(rules.AllowedNames))
+		for _, name := range rules.AllowedNames {
+			s.allowedNames[name] = struct{}{}
+		}
+	}
+	return s
+}
+
+// Write 校验一条日志并放入写入队列
+func (s *LogService) Write(ctx context.Context, entry LogEntry) error {
+	entry = normalize(entry)
+	if err := s.Validate(entry); err != nil {
+		return err
+	}
+	return s.models.Writer.Write(ctx, entry)
+}
+
+// 规范化客户端发送的字段
+func normalize(entry LogEntry) LogEntry {
+	entry.Name = strings.TrimSpace(entry.Name)
+	entry.Severity = strings.ToUpper(strings.TrimSpace(entry.Severity))
+	return entry
+}
+
+// Validate 按校验规则检查一条日志
+func (s *LogService) Validate(entry LogEntry) error {
+	if entry.ID != "" && !primitive.IsValidObjectID(entry.ID) {
+		return &ValidationError{Field: "id", Reason: "id must be a 24 character hex object id"}
+	}
+	if entry.Name == "" {
+		return &ValidationError{Field: "name", Reason: "name is required"}
+	}
+	if s.allowedNames != nil {
+		if _, ok := s.allowedNames[entry.Name]; !ok {
+			return &ValidationError{Field: "name", Reason: fmt.Sprintf("name %q is not allowed", entry.Name)}
+		}
+	}
+	if len(entry.Data) > s.maxDataSize {
+		return &ValidationError{Field: "data", Reason: fmt.Sprintf("data is %d bytes, the limit is %d", len(entry.Data), s.maxDataSize)}
+	}
+	return nil
+}
+
+// Find 按条件分页查询日志
+func (s *LogService) Find(ctx context.Context, f Filter) (*Page, error) {
+	return s.models.Store.Find(ctx, f)
+}
+
+// Export 按条件和排序方向逐条遍历匹配的日志，不会把结果全部加载到内存中，fn 返回错误时停止并返回该错误
+func (s *LogService) Export(ctx context.Context, f Filter, fn func(*LogEntry) error) error {
+	return s.models.Store.Scan(ctx, f, fn)
+}
+
+// Get 按 ID 查询一条日志
+func (s *LogService) Get(ctx context.Context, id string) (*LogEntry, error) {
+	return s.models.Store.Get(ctx, id)
+}
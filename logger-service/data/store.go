@@ -0,0 +1,153 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+/**
+该代码定义了日志的存储接口 LogStore，data 包中的模型、批量写入和归档都只通过该接口访问日志。
+目前有三种实现：MongoStore 把日志保存在 MongoDB 中；FileStore 把日志追加写入本地的段文件，不依赖外部服务，适合开发和 CI；
+MemoryStore 把日志保存在内存中，进程退出后丢失，适合测试。
+所有实现都使用 ObjectID 作为日志 ID，并按 (created_at, _id) 排序，因此游标、查询条件和保留策略在不同实现之间的行为一致。
+MongoStore 通过 TTL 索引删除过期的日志，FileStore 和 MemoryStore 在读取时跳过过期的日志，并在写入时定期清理。
+*/
+
+// LogStore 是日志的存储
+type LogStore interface {
+	// Init 准备存储，例如创建索引，已经准备好时不做任何操作
+	Init(ctx context.Context) error
+	// InsertMany 写入一批已经分配了 ID 的日志，ID 已经存在的日志会被忽略，因此可以安全地重试
+	InsertMany(ctx context.Context, entries []LogEntry) error
+	// Get 按 ID 查询一条日志，ID 无效时返回 ErrInvalidID，不存在时返回 ErrNotFound
+	Get(ctx context.Context, id string) (*LogEntry, error)
+	// Update 更新日志的名称和内容，不存在时返回 ErrNotFound
+	Update(ctx context.Context, entry *LogEntry) error
+	// Find 按条件分页查询日志
+	Find(ctx context.Context, f Filter) (*Page, error)
+	// Scan 按条件和排序方向遍历所有匹配的日志，忽略 Limit，fn 返回错误时停止遍历并返回该错误
+	Scan(ctx context.Context, f Filter, fn func(*LogEntry) error) error
+	// Count 返回匹配条件的日志条数
+	Count(ctx context.Context, f Filter) (int64, error)
+	// Aggregate 按条件分组统计日志条数，a 已经通过校验
+	Aggregate(ctx context.Context, a Aggregation) ([]Bucket, error)
+	// Delete 删除匹配条件的日志，返回删除的条数
+	Delete(ctx context.Context, f Filter) (int64, error)
+	// Drop 删除所有日志
+	Drop(ctx context.Context) error
+	// Ping 检查存储是否可用
+	Ping(ctx context.Context) error
+	// Close 释放存储占用的资源
+	Close() error
+}
+
+// 清理过期日志的间隔，用于 FileStore 和 MemoryStore
+const purgeInterval = time.Minute
+
+// 内存和文件存储使用的排序键，顺序与 MongoStore 的 (created_at, _id) 排序一致
+type sortKey struct {
+	createdAt time.Time
+	id        string // ObjectID 的十六进制表示，字符串顺序与 ObjectID 的顺序相同
+}
+
+func (k sortKey) less(o sortKey) bool {
+	if !k.createdAt.Equal(o.createdAt) {
+		return k.createdAt.Before(o.createdAt)
+	}
+	return k.id < o.id
+}
+
+// 在按 sortKey 升序排列的 n 条记录中，按 f 的时间范围、游标和排序方向依次调用 fn(i)，fn 返回 false 时停止
+func scanRange(f Filter, n int, keyAt func(i int) sortKey, fn func(i int) (bool, error)) error {
+	lo, hi := 0, n
+	if !f.From.IsZero() {
+		lo = sort.Search(n, func(i int) bool { return !keyAt(i).createdAt.Before(f.From) })
+	}
+	if !f.To.IsZero() {
+		hi = sort.Search(n, func(i int) bool { return !keyAt(i).createdAt.Before(f.To) })
+	}
+
+	if f.Cursor != "" {
+		createdAt, id, err := decodeCursor(f.Cursor)
+		if err != nil {
+			return err
+		}
+		cursor := sortKey{createdAt: createdAt, id: id.Hex()}
+
+		// 从游标之后开始：升序时是排在游标后面的记录，降序时是排在游标前面的记录
+		if f.Ascending {
+			if after := sort.Search(n, func(i int) bool { return cursor.less(keyAt(i)) }); after > lo {
+				lo = after
+			}
+		} else {
+			if before := sort.Search(n, func(i int) bool { return !keyAt(i).less(cursor) }); before < hi {
+				hi = before
+			}
+		}
+	}
+
+	if f.Ascending {
+		for i := lo; i < hi; i++ {
+			if ok, err := fn(i); err != nil || !ok {
+				return err
+			}
+		}
+		return nil
+	}
+	for i := hi - 1; i >= lo; i-- {
+		if ok, err := fn(i); err != nil || !ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// 按条件遍历日志的函数，由 FileStore 和 MemoryStore 实现，只传入匹配条件且没有过期的日志
+type eachFunc func(f Filter, fn func(*LogEntry) (bool, error)) error
+
+// 使用 each 实现 LogStore.Find
+func findPage(f Filter, each eachFunc) (*Page, error) {
+	limit := pageLimit(f.Limit)
+
+	logs := make([]*LogEntry, 0, limit)
+	err := each(f, func(entry *LogEntry) (bool, error) {
+		logs = append(logs, entry)
+		return len(logs) <= limit, nil // 多取一条用于判断是否还有下一页
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{Logs: logs}
+	if len(logs) > limit {
+		page.Logs = logs[:limit]
+		page.NextCursor = encodeCursor(page.Logs[limit-1])
+	}
+	return page, nil
+}
+
+// 使用 each 实现 LogStore.Scan
+func scanEntries(ctx context.Context, f Filter, each eachFunc, fn func(*LogEntry) error) error {
+	return each(f, func(entry *LogEntry) (bool, error) {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		return true, fn(entry)
+	})
+}
+
+// 使用 each 实现 LogStore.Count
+func countEntries(f Filter, each eachFunc) (int64, error) {
+	var n int64
+	err := each(f, func(*LogEntry) (bool, error) {
+		n++
+		return true, nil
+	})
+	return n, err
+}
+
+// 判断日志是否已经过期
+func expired(expireAt *time.Time, now time.Time) bool {
+	return expireAt != nil && !expireAt.After(now)
+}
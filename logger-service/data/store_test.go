@@ -0,0 +1,204 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 每种 LogStore 实现都应满足的行为，MongoStore 需要数据库，不在这里测试
+var storeFactories = []struct {
+	name string
+	open func(t *testing.T) LogStore
+}{
+	{"memory", func(t *testing.T) LogStore { return NewMemoryStore() }},
+	{"file", func(t *testing.T) LogStore {
+		s, err := NewFileStore(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = s.Close() })
+		return s
+	}},
+}
+
+// 创建 n 条日志，每条间隔一秒，name 依次为 names 中的值
+func testEntries(n int, names ...string) []LogEntry {
+	base := time.Date(2023, 11, 14, 10, 0, 0, 0, time.UTC)
+	entries := make([]LogEntry, n)
+	for i := range entries {
+		entries[i] = LogEntry{
+			ID:        primitive.NewObjectID().Hex(),
+			Name:      names[i%len(names)],
+			Data:      "data",
+			Severity:  DefaultSeverity,
+			CreatedAt: base.Add(time.Duration(i) * time.Second),
+			UpdatedAt: base.Add(time.Duration(i) * time.Second),
+		}
+	}
+	return entries
+}
+
+func TestStoreInsertAndGet(t *testing.T) {
+	for _, sf := range storeFactories {
+		t.Run(sf.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := sf.open(t)
+			entries := testEntries(3, "event")
+
+			// 重复写入同一批日志以及批次内重复的 ID 都被忽略
+			if err := s.InsertMany(ctx, entries); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.InsertMany(ctx, append(entries, entries[0])); err != nil {
+				t.Fatal(err)
+			}
+			if n, _ := s.Count(ctx, Filter{}); n != 3 {
+				t.Errorf("Count = %d, want 3", n)
+			}
+
+			got, err := s.Get(ctx, entries[1].ID)
+			if err != nil || got.Name != "event" || !got.CreatedAt.Equal(entries[1].CreatedAt) {
+				t.Errorf("Get = %+v, %v", got, err)
+			}
+
+			tests := []struct {
+				id   string
+				want error
+			}{
+				{"not-an-id", ErrInvalidID},
+				{primitive.NewObjectID().Hex(), ErrNotFound},
+			}
+			for _, tt := range tests {
+				if _, err := s.Get(ctx, tt.id); !errors.Is(err, tt.want) {
+					t.Errorf("Get(%s) = %v, want %v", tt.id, err, tt.want)
+				}
+			}
+
+			if err := s.InsertMany(ctx, []LogEntry{{ID: "bad"}}); !errors.Is(err, ErrInvalidID) {
+				t.Errorf("InsertMany with an invalid id = %v, want %v", err, ErrInvalidID)
+			}
+		})
+	}
+}
+
+func TestStoreFindPages(t *testing.T) {
+	for _, sf := range storeFactories {
+		t.Run(sf.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := sf.open(t)
+			entries := testEntries(7, "auth", "event")
+			if err := s.InsertMany(ctx, entries); err != nil {
+				t.Fatal(err)
+			}
+
+			tests := []struct {
+				name   string
+				filter Filter
+				want   []int // 所有页中日志在 entries 中的下标
+			}{
+				{"descending", Filter{Limit: 3}, []int{6, 5, 4, 3, 2, 1, 0}},
+				{"ascending", Filter{Limit: 3, Ascending: true}, []int{0, 1, 2, 3, 4, 5, 6}},
+				{"by name", Filter{Limit: 2, Name: "auth"}, []int{6, 4, 2, 0}},
+				{"time range", Filter{Limit: 2, From: entries[2].CreatedAt, To: entries[5].CreatedAt, Ascending: true}, []int{2, 3, 4}},
+			}
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					var got []string
+					f := tt.filter
+					for pages := 0; pages < 10; pages++ {
+						page, err := s.Find(ctx, f)
+						if err != nil {
+							t.Fatal(err)
+						}
+						for _, entry := range page.Logs {
+							got = append(got, entry.ID)
+						}
+						if page.NextCursor == "" {
+							break
+						}
+						f.Cursor = page.NextCursor
+					}
+
+					if len(got) != len(tt.want) {
+						t.Fatalf("got %d logs, want %d", len(got), len(tt.want))
+					}
+					for i, idx := range tt.want {
+						if got[i] != entries[idx].ID {
+							t.Errorf("log %d = %s, want entries[%d]", i, got[i], idx)
+						}
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestStoreUpdateAndDelete(t *testing.T) {
+	for _, sf := range storeFactories {
+		t.Run(sf.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := sf.open(t)
+			entries := testEntries(4, "auth", "event")
+			if err := s.InsertMany(ctx, entries); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := s.Update(ctx, &LogEntry{ID: entries[0].ID, Name: "renamed", Data: "changed"}); err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.Get(ctx, entries[0].ID)
+			if err != nil || got.Name != "renamed" || got.Data != "changed" || !got.CreatedAt.Equal(entries[0].CreatedAt) {
+				t.Errorf("after Update Get = %+v, %v", got, err)
+			}
+			if err := s.Update(ctx, &LogEntry{ID: primitive.NewObjectID().Hex()}); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Update of a missing log = %v, want %v", err, ErrNotFound)
+			}
+
+			n, err := s.Delete(ctx, Filter{Name: "event"})
+			if err != nil || n != 2 {
+				t.Errorf("Delete = %d, %v, want 2", n, err)
+			}
+			if n, _ := s.Count(ctx, Filter{}); n != 2 {
+				t.Errorf("Count after Delete = %d, want 2", n)
+			}
+
+			if err := s.Drop(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if n, _ := s.Count(ctx, Filter{}); n != 0 {
+				t.Errorf("Count after Drop = %d, want 0", n)
+			}
+			if err := s.Ping(ctx); err != nil {
+				t.Errorf("Ping after Drop: %v", err)
+			}
+		})
+	}
+}
+
+func TestStoreSkipsExpiredLogs(t *testing.T) {
+	for _, sf := range storeFactories {
+		t.Run(sf.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := sf.open(t)
+
+			entries := testEntries(2, "event")
+			past := time.Now().Add(-time.Minute)
+			entries[0].ExpireAt = &past
+			if err := s.InsertMany(ctx, entries); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := s.Get(ctx, entries[0].ID); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get of an expired log = %v, want %v", err, ErrNotFound)
+			}
+			if n, _ := s.Count(ctx, Filter{}); n != 1 {
+				t.Errorf("Count = %d, want 1", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package data
+
+import (
+	"strings"
+	"sync"
+)
+
+/**
+该代码定义了日志的进程内广播，用于实时推送新写入的日志（TailLogs）。
+每次 Insert 成功后，新日志会被推送给所有条件匹配的订阅者。
+条件与 Find 相同：Name、Severity、Service 和 TraceID 精确匹配，Query 在 data 中不区分大小写地搜索，其余字段被忽略。
+推送不会阻塞写入：订阅者的缓冲区满时，新日志会被丢弃并计入 Dropped。
+CloseSubscriptions 在服务关闭时结束所有订阅，使正在进行的 TailLogs 调用返回。
+广播只在当前进程内进行，部署多个副本时，订阅者只能收到写入到同一个副本的日志。
+*/
+
+// Subscription 是一个日志订阅
+type Subscription struct {
+	C <-chan *LogEntry // 新写入的日志
+
+	ch      chan *LogEntry
+	filter  Filter
+	mu      sync.Mutex
+	dropped int64
+	closed  bool
+}
+
+// Dropped 返回因为缓冲区已满而丢弃的日志条数
+func (s *Subscription) Dropped() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+type broadcaster struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+var tail = &broadcaster{subs: make(map[*Subscription]struct{})}
+
+// Subscribe 订阅之后写入的、匹配 filter 的日志，buffer 是缓冲区大小。使用完后必须调用 Unsubscribe
+func (l *LogEntry) Subscribe(filter Filter, buffer int) *Subscription {
+	ch := make(chan *LogEntry, buffer)
+	s := &Subscription{C: ch, ch: ch, filter: filter}
+
+	tail.mu.Lock()
+	defer tail.mu.Unlock()
+	if tail.closed {
+		s.closed = true
+		close(ch)
+		return s
+	}
+	tail.subs[s] = struct{}{}
+	return s
+}
+
+// Unsubscribe 取消订阅并关闭 s.C
+func (l *LogEntry) Unsubscribe(s *Subscription) {
+	tail.mu.Lock()
+	delete(tail.subs, s)
+	tail.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
+
+// CloseSubscriptions 结束所有订阅，之后的订阅会立即结束
+func (l *LogEntry) CloseSubscriptions() {
+	tail.mu.Lock()
+	subs := tail.subs
+	tail.subs = make(map[*Subscription]struct{})
+	tail.closed = true
+	tail.mu.Unlock()
+
+	for s := range subs {
+		l.Unsubscribe(s)
+	}
+}
+
+// 把新写入的日志推送给所有匹配的订阅者
+func (b *broadcaster) publish(entry *LogEntry) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for s := range b.subs {
+		if !s.filter.matches(entry) {
+			continue
+		}
+
+		s.mu.Lock()
+		if !s.closed {
+			select {
+			case s.ch <- entry:
+			default:
+				s.dropped++
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// 判断日志是否匹配订阅条件
+func (f Filter) matches(entry *LogEntry) bool {
+	if f.Name != "" && entry.Name != f.Name {
+		return false
+	}
+	if f.Severity != "" && entry.Severity != f.Severity {
+		return false
+	}
+	if f.Service != "" && entry.Service != f.Service {
+		return false
+	}
+	if f.TraceID != "" && entry.TraceID != f.TraceID {
+		return false
+	}
+	if f.Query != "" && !strings.Contains(strings.ToLower(entry.Data), strings.ToLower(f.Query)) {
+		return false
+	}
+	return true
+}
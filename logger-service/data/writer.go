@@ -0,0 +1,315 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/**
+该代码定义了日志的批量写入器 Writer（write-behind 缓冲区）。
+Write 把日志放入有界队列后立即返回，后台协程把队列中的日志合并为一次 LogStore.InsertMany：
+攒够 BatchSize 条或距离上次写入超过 FlushInterval 时写入一批。
+队列已满时 Write 会阻塞，直到队列有空位、ctx 被取消或超过 EnqueueTimeout，从而对调用方施加背压。
+每条日志在进入队列时分配 ID（调用方指定了 ID 时使用该 ID），写入失败后按指数退避（从 RetryBackoff 开始，最长 MaxBackoff）一直重试整批日志，
+已经写入的日志会因为 ID 已经存在被存储忽略，因此重试不会产生重复日志。
+重试期间后台协程不再从队列中取日志，队列满后 Write 返回 ErrQueueFull，调用方（HTTP 返回 503）可以稍后重试，日志不会在确认之后被丢弃。
+Close 停止接收新日志，把队列中剩余的日志全部写入后返回；超过 Close 的等待时间后放弃仍未写入的日志并计入 Failed。
+Stats 返回写入统计：批次数、日志条数、批次大小和写入耗时。
+*/
+
+// ErrWriterClosed 表示 Writer 已经关闭
+var ErrWriterClosed = errors.New("log writer is closed")
+
+// ErrQueueFull 表示在等待时间内队列一直是满的
+var ErrQueueFull = errors.New("log write queue is full")
+
+// WriterConfig 是 Writer 的配置
+type WriterConfig struct {
+	BatchSize      int           // 每批最多写入的日志条数
+	FlushInterval  time.Duration // 队列中的日志最多等待多久写入
+	QueueSize      int           // 队列容量
+	EnqueueTimeout time.Duration // 队列满时 Write 最多等待的时间
+	WriteTimeout   time.Duration // 单次 InsertMany 的超时时间
+	RetryBackoff   time.Duration // 写入失败后第一次重试前的等待时间，之后每次翻倍
+	MaxBackoff     time.Duration // 重试等待时间的上限
+}
+
+// DefaultWriterConfig 返回默认配置
+func DefaultWriterConfig() WriterConfig {
+	return WriterConfig{
+		BatchSize:      100,
+		FlushInterval:  time.Second,
+		QueueSize:      10000,
+		EnqueueTimeout: 5 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		RetryBackoff:   100 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+	}
+}
+
+// WriterStats 是写入统计
+type WriterStats struct {
+	Queued        int           `json:"queued"`   // 当前在队列中等待的日志条数
+	Batches       int64         `json:"batches"`  // 写入的批次数
+	Written       int64         `json:"written"`  // 写入成功的日志条数
+	Failed        int64         `json:"failed"`   // 关闭时仍未写入、被丢弃的日志条数
+	Retries       int64         `json:"retries"`  // 写入失败后重试的次数
+	Rejected      int64         `json:"rejected"` // 队列满或已关闭时被拒绝的日志条数
+	LastBatchSize int           `json:"last_batch_size"`
+	MaxBatchSize  int           `json:"max_batch_size"`
+	AvgBatchSize  float64       `json:"avg_batch_size"`
+	LastLatency   time.Duration `json:"last_latency_ns"` // 最近一批的写入耗时，包括重试
+	MaxLatency    time.Duration `json:"max_latency_ns"`
+	AvgLatency    time.Duration `json:"avg_latency_ns"`
+}
+
+// Writer 把日志合并为批次写入日志存储
+type Writer struct {
+	store  LogStore
+	config WriterConfig
+	queue  chan LogEntry
+	done   chan struct{}
+
+	// Close 的等待时间用完时取消，停止重试并放弃剩余的日志
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	closeMu sync.RWMutex // Write 持有读锁发送，Close 持有写锁关闭队列
+	closed  bool
+
+	statsMu      sync.Mutex
+	stats        WriterStats
+	totalLatency time.Duration
+}
+
+// NewWriter 创建一个写入 store 的 Writer 并在后台开始写入
+func NewWriter(store LogStore, config WriterConfig) *Writer {
+	def := DefaultWriterConfig()
+	if config.BatchSize <= 0 {
+		config.BatchSize = def.BatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = def.FlushInterval
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = def.QueueSize
+	}
+	if config.EnqueueTimeout <= 0 {
+		config.EnqueueTimeout = def.EnqueueTimeout
+	}
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = def.WriteTimeout
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = def.RetryBackoff
+	}
+	if config.MaxBackoff < config.RetryBackoff {
+		config.MaxBackoff = def.MaxBackoff
+		if config.MaxBackoff < config.RetryBackoff {
+			config.MaxBackoff = config.RetryBackoff
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Writer{
+		store:  store,
+		config: config,
+		queue:  make(chan LogEntry, config.QueueSize),
+		done:   make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	go w.run()
+	return w
+}
+
+// Write 把一条日志放入队列，队列满时等待
+func (w *Writer) Write(ctx context.Context, entry LogEntry) error {
+	w.closeMu.RLock()
+	defer w.closeMu.RUnlock()
+
+	if w.closed {
+		w.reject()
+		return ErrWriterClosed
+	}
+
+	// 调用方指定了 ID 时使用它，重复写入同一个 ID 的日志会被存储忽略
+	doc := newDocument(entry, time.Now())
+	doc.ID = entry.ID
+	if doc.ID == "" {
+		doc.ID = primitive.NewObjectID().Hex()
+	}
+
+	select {
+	case w.queue <- doc:
+		return nil
+	default:
+	}
+
+	// 队列已满，等待空位
+	timer := time.NewTimer(w.config.EnqueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case w.queue <- doc:
+		return nil
+	case <-timer.C:
+		w.reject()
+		return ErrQueueFull
+	case <-ctx.Done():
+		w.reject()
+		return ctx.Err()
+	}
+}
+
+// Close 停止接收新日志，并等待队列中的日志全部写入；ctx 被取消时放弃仍未写入的日志
+func (w *Writer) Close(ctx context.Context) error {
+	w.closeMu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.closeMu.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		// 停止重试，剩余的日志计入 Failed
+		w.cancel()
+		<-w.done
+		return ctx.Err()
+	}
+}
+
+// Stats 返回写入统计
+func (w *Writer) Stats() WriterStats {
+	w.statsMu.Lock()
+	defer w.statsMu.Unlock()
+
+	stats := w.stats
+	stats.Queued = len(w.queue)
+	if stats.Batches > 0 {
+		stats.AvgLatency = w.totalLatency / time.Duration(stats.Batches)
+	}
+	return stats
+}
+
+// 后台协程：按批次大小或时间间隔写入
+func (w *Writer) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]LogEntry, 0, w.config.BatchSize)
+	for {
+		select {
+		case doc, ok := <-w.queue:
+			if !ok {
+				// 队列已关闭，写入剩余的日志后退出
+				w.flush(batch)
+				return
+			}
+			batch = append(batch, doc)
+			if len(batch) < w.config.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		w.flush(batch)
+		batch = make([]LogEntry, 0, w.config.BatchSize)
+		ticker.Reset(w.config.FlushInterval)
+	}
+}
+
+// 写入一批日志，失败时按指数退避一直重试，直到写入成功或 Close 放弃
+func (w *Writer) flush(batch []LogEntry) {
+	if len(batch) == 0 {
+		return
+	}
+
+	start := time.Now()
+	backOff := w.config.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := w.insertMany(batch)
+		if err == nil {
+			break
+		}
+		if w.ctx.Err() != nil {
+			log.Printf("Dropping batch of %d logs after %d attempts: %v", len(batch), attempt, err)
+			w.record(len(batch), time.Since(start), err)
+			return
+		}
+
+		log.Printf("Error writing batch of %d logs (attempt %d), retrying in %s: %v", len(batch), attempt, backOff, err)
+		w.retry()
+		select {
+		case <-time.After(backOff):
+		case <-w.ctx.Done():
+		}
+		if backOff *= 2; backOff > w.config.MaxBackoff {
+			backOff = w.config.MaxBackoff
+		}
+	}
+	w.record(len(batch), time.Since(start), nil)
+
+	// 推送给正在 tail 的订阅者
+	for i := range batch {
+		tail.publish(&batch[i])
+	}
+}
+
+// 写入一批日志，之前的尝试已经写入的日志会被存储忽略
+func (w *Writer) insertMany(batch []LogEntry) error {
+	ctx, cancel := context.WithTimeout(w.ctx, w.config.WriteTimeout)
+	defer cancel()
+
+	return w.store.InsertMany(ctx, batch)
+}
+
+func (w *Writer) record(size int, latency time.Duration, err error) {
+	w.statsMu.Lock()
+	defer w.statsMu.Unlock()
+
+	s := &w.stats
+	s.Batches++
+	if err != nil {
+		s.Failed += int64(size)
+	} else {
+		s.Written += int64(size)
+	}
+
+	s.LastBatchSize = size
+	if size > s.MaxBatchSize {
+		s.MaxBatchSize = size
+	}
+	s.AvgBatchSize = float64(s.Written+s.Failed) / float64(s.Batches)
+
+	s.LastLatency = latency
+	if latency > s.MaxLatency {
+		s.MaxLatency = latency
+	}
+	w.totalLatency += latency
+}
+
+func (w *Writer) retry() {
+	w.statsMu.Lock()
+	w.stats.Retries++
+	w.statsMu.Unlock()
+}
+
+func (w *Writer) reject() {
+	w.statsMu.Lock()
+	w.stats.Rejected++
+	w.statsMu.Unlock()
+}
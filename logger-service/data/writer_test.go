@@ -0,0 +1,182 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyStore 在前 failures 次 InsertMany 时返回错误，之后写入内存存储
+type flakyStore struct {
+	*MemoryStore
+
+	mu       sync.Mutex
+	failures int // 剩余的失败次数，小于 0 时一直失败
+	calls    int
+}
+
+func (s *flakyStore) InsertMany(ctx context.Context, entries []LogEntry) error {
+	s.mu.Lock()
+	s.calls++
+	fail := s.failures != 0
+	if s.failures > 0 {
+		s.failures--
+	}
+	s.mu.Unlock()
+
+	if fail {
+		return errors.New("store unavailable")
+	}
+	return s.MemoryStore.InsertMany(ctx, entries)
+}
+
+func testWriterConfig() WriterConfig {
+	return WriterConfig{
+		BatchSize:     10,
+		FlushInterval: 10 * time.Millisecond,
+		QueueSize:     100,
+		RetryBackoff:  time.Millisecond,
+		MaxBackoff:    5 * time.Millisecond,
+	}
+}
+
+func TestWriterBatches(t *testing.T) {
+	tests := []struct {
+		name        string
+		entries     int
+		wantBatches int64
+	}{
+		{"partial batch flushed on close", 3, 1},
+		{"full batches", 20, 2},
+		{"full batches and a remainder", 25, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			config := testWriterConfig()
+			config.FlushInterval = time.Hour // 只按批次大小和关闭时写入
+			w := NewWriter(store, config)
+
+			for i := 0; i < tt.entries; i++ {
+				if err := w.Write(context.Background(), LogEntry{Name: "test", Data: "data"}); err != nil {
+					t.Fatalf("Write: %v", err)
+				}
+			}
+			if err := w.Close(context.Background()); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			stats := w.Stats()
+			if stats.Written != int64(tt.entries) || stats.Failed != 0 {
+				t.Errorf("written %d failed %d, want %d and 0", stats.Written, stats.Failed, tt.entries)
+			}
+			if stats.Batches != tt.wantBatches {
+				t.Errorf("batches = %d, want %d", stats.Batches, tt.wantBatches)
+			}
+			if n, _ := store.Count(context.Background(), Filter{}); n != int64(tt.entries) {
+				t.Errorf("stored %d logs, want %d", n, tt.entries)
+			}
+		})
+	}
+}
+
+func TestWriterRetriesUntilWritten(t *testing.T) {
+	store := &flakyStore{MemoryStore: NewMemoryStore(), failures: 5}
+	w := NewWriter(store, testWriterConfig())
+
+	for i := 0; i < 3; i++ {
+		if err := w.Write(context.Background(), LogEntry{Name: "test"}); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	stats := w.Stats()
+	if stats.Written != 3 || stats.Failed != 0 {
+		t.Errorf("written %d failed %d, want 3 and 0", stats.Written, stats.Failed)
+	}
+	if stats.Retries != 5 {
+		t.Errorf("retries = %d, want 5", stats.Retries)
+	}
+	if n, _ := store.Count(context.Background(), Filter{}); n != 3 {
+		t.Errorf("stored %d logs, want 3", n)
+	}
+}
+
+func TestWriterCloseGivesUpAtDeadline(t *testing.T) {
+	store := &flakyStore{MemoryStore: NewMemoryStore(), failures: -1}
+	w := NewWriter(store, testWriterConfig())
+
+	for i := 0; i < 4; i++ {
+		if err := w.Write(context.Background(), LogEntry{Name: "test"}); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := w.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Close = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	stats := w.Stats()
+	if stats.Failed != 4 || stats.Written != 0 {
+		t.Errorf("written %d failed %d, want 0 and 4", stats.Written, stats.Failed)
+	}
+	if stats.Retries == 0 {
+		t.Error("expected the batch to be retried before giving up")
+	}
+}
+
+func TestWriterQueueFullPushesBack(t *testing.T) {
+	store := &flakyStore{MemoryStore: NewMemoryStore(), failures: -1}
+	config := testWriterConfig()
+	config.BatchSize = 1
+	config.QueueSize = 2
+	config.EnqueueTimeout = 20 * time.Millisecond
+	w := NewWriter(store, config)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_ = w.Close(ctx)
+	}()
+
+	// 后台协程在重试第一条日志，队列满后 Write 返回 ErrQueueFull
+	var err error
+	for i := 0; i < 10 && err == nil; i++ {
+		err = w.Write(context.Background(), LogEntry{Name: "test"})
+	}
+	if !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Write = %v, want %v", err, ErrQueueFull)
+	}
+	if w.Stats().Rejected == 0 {
+		t.Error("expected the rejected write to be counted")
+	}
+}
+
+func TestWriterKeepsCallerID(t *testing.T) {
+	store := NewMemoryStore()
+	w := NewWriter(store, testWriterConfig())
+
+	const id = "6553f100ba7816bf8f01cfea"
+	for i := 0; i < 3; i++ {
+		if err := w.Write(context.Background(), LogEntry{ID: id, Name: "test"}); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if n, _ := store.Count(context.Background(), Filter{}); n != 1 {
+		t.Errorf("stored %d logs, want 1", n)
+	}
+	if _, err := store.Get(context.Background(), id); err != nil {
+		t.Errorf("Get(%s): %v", id, err)
+	}
+}
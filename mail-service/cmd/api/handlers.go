@@ -12,7 +12,7 @@ import (
 然后，创建一个 requestPayload 变量，用于接收请求中的 JSON 数据。
 通过调用 app.readJson 方法将请求中的 JSON 数据解码并存储到 requestPayload 中。
 如果解码过程中发生错误，则打印错误信息并返回错误的 JSON 响应。
-创建一个 Message 对象，使用 requestPayload 的字段填充邮件消息。
+创建一个 Message 对象，使用 requestPayload 的字段填充邮件消息；template 指定使用的模板（不存在时返回错误），data 是模板中使用的字段。
 调用 app.Mailer.SendSMTPMessage 方法发送邮件消息。
 如果发送过程中发生错误，则打印错误信息并返回错误的 JSON 响应。
 创建一个 payload 对象，表示成功发送邮件的 JSON 响应。
@@ -26,6 +26,9 @@ func (app *Config) SendMail(w http.ResponseWriter, r *http.Request) {
 		To      string `json:"to"`
 		Subject string `json:"subject"`
 		Message string `json:"message"`
+
+		Template string         `json:"template,omitempty"` // 模板名称，为空时使用 mail 模板
+		Data     map[string]any `json:"data,omitempty"`     // 模板中使用的字段
 	}
 
 	// 创建 mailMessage 对象
@@ -39,12 +42,20 @@ func (app *Config) SendMail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 检查模板是否存在
+	if err := CheckTemplate(requestPayload.Template); err != nil {
+		app.errorJson(w, err)
+		return
+	}
+
 	// 创建邮件消息对象
 	msg := Message{
-		From:    requestPayload.From,
-		To:      requestPayload.To,
-		Subject: requestPayload.Subject,
-		Data:    requestPayload.Message,
+		From:     requestPayload.From,
+		To:       requestPayload.To,
+		Subject:  requestPayload.Subject,
+		Data:     requestPayload.Message,
+		DataMap:  requestPayload.Data,
+		Template: requestPayload.Template,
 	}
 
 	// 发送邮件消息
@@ -2,9 +2,12 @@ package main
 
 import (
 	"bytes"
+	"fmt"
 	"github.com/vanng822/go-premailer/premailer"
 	mail "github.com/xhit/go-simple-mail/v2"
 	"html/template"
+	"os"
+	"regexp"
 	"time"
 )
 
@@ -16,6 +19,8 @@ Mail 结构体包含了一个 SendSMTPMessage 方法，用于发送使用 SMTP 
 方法根据 Message 的字段构建邮件消息，并通过 SMTP 客户端发送邮件。
 buildPlainTextMessage 方法根据模板构建纯文本格式的邮件消息。
 buildHTMLMessage 方法根据模板构建 HTML 格式的邮件消息。
+Message.Template 是使用的模板名称，对应 /templates/<名称>.html.gohtml 和 /templates/<名称>.plain.gohtml，为空时使用 mail 模板；
+模板中可以使用 DataMap 中的字段，message 字段是 Data 的内容。
 inlineCSS 方法将 CSS 样式嵌入 HTML 消息中。
 getEncryption 方法根据加密方式的字符串值获取对应的枚举值。
 通过这些方法，可以实现构建和发送邮件的功能。
@@ -40,6 +45,39 @@ type Message struct {
 	Attachments []string
 	Data        any
 	DataMap     map[string]any
+	Template    string // 模板名称，为空时使用 defaultTemplate
+}
+
+const (
+	templateDir     = "/templates"
+	defaultTemplate = "mail"
+)
+
+// 模板名称只能包含小写字母、数字和连字符，避免读取模板目录以外的文件
+var templateName = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// 返回模板对应的文件路径
+func templatePath(name, format string) string {
+	if name == "" {
+		name = defaultTemplate
+	}
+	return fmt.Sprintf("%s/%s.%s.gohtml", templateDir, name, format)
+}
+
+// CheckTemplate 检查模板是否存在
+func CheckTemplate(name string) error {
+	if name == "" {
+		return nil
+	}
+	if !templateName.MatchString(name) {
+		return fmt.Errorf("invalid template name %q", name)
+	}
+	for _, format := range []string{"html", "plain"} {
+		if _, err := os.Stat(templatePath(name, format)); err != nil {
+			return fmt.Errorf("unknown template %q", name)
+		}
+	}
+	return nil
 }
 
 func (m *Mail) SendSMTPMessage(msg Message) error {
@@ -54,9 +92,11 @@ func (m *Mail) SendSMTPMessage(msg Message) error {
 	}
 
 	// 创建数据映射，用于渲染邮件模板
-	data := map[string]any{
-		"message": msg.Data,
+	data := map[string]any{}
+	for k, v := range msg.DataMap {
+		data[k] = v
 	}
+	data["message"] = msg.Data
 
 	msg.DataMap = data
 
@@ -112,7 +152,7 @@ func (m *Mail) SendSMTPMessage(msg Message) error {
 
 // 构建纯文本格式的邮件消息
 func (m *Mail) buildPlainTextMessage(msg Message) (string, error) {
-	templateToRender := "/templates/mail.plain.gohtml"
+	templateToRender := templatePath(msg.Template, "plain")
 
 	t, err := template.New("email-plain").ParseFiles(templateToRender)
 	if err != nil {
@@ -131,7 +171,7 @@ func (m *Mail) buildPlainTextMessage(msg Message) (string, error) {
 
 // 构建 HTML 格式的邮件消息
 func (m *Mail) buildHTMLMessage(msg Message) (string, error) {
-	templateToRender := "/templates/mail.html.gohtml"
+	templateToRender := templatePath(msg.Template, "html")
 
 	t, err := template.New("email-html").ParseFiles(templateToRender)
 	if err != nil {
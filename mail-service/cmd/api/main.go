@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 )
 
 /**
@@ -15,8 +20,8 @@ main 函数是程序的入口函数。
 在 main 函数中，创建了一个 Config 对象 app，并初始化其 Mailer 字段为通过 createMail 函数创建的邮件配置对象。
 输出日志信息，表示开始在指定端口上启动邮件服务。
 创建一个 HTTP 服务器实例 srv，设置其监听地址为 webPort，处理器为 app.routes()。
-使用 ListenAndServe 方法启动服务器，并处理请求。
-如果发生错误，打印错误信息。
+在后台使用 ListenAndServe 方法启动服务器，并处理请求。
+收到 SIGTERM 或 SIGINT 信号或者服务器出错后调用 Shutdown，等待正在发送的邮件完成（最长 SHUTDOWN_TIMEOUT），服务器的错误由 run 返回。
 createMail 函数用于创建邮件配置对象。
 通过读取环境变量获取邮件相关的配置信息，并构建 Mail 对象。
 返回构建好的 Mail 对象。
@@ -29,6 +34,17 @@ type Config struct {
 const webPort = "80"
 
 func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run 启动邮件服务，收到退出信号或者服务器出错时优雅关闭，返回导致退出的错误
+func run() error {
+	// 最先注册退出信号
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// 创建配置对象并初始化邮件配置
 	app := Config{
 		Mailer: createMail(),
@@ -41,11 +57,38 @@ func main() {
 		Handler: app.routes(),
 	}
 
-	// 启动服务器监听并处理请求
-	err := srv.ListenAndServe()
-	if err != nil {
-		fmt.Println(err)
+	// 在后台启动服务器监听并处理请求，服务器出错时通过 serverErr 通知
+	serverErr := make(chan error, 1)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- fmt.Errorf("web server: %w", err)
+		}
+	}()
+
+	// 等待退出信号或者服务器出错
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-serverErr:
+	}
+
+	// 等待正在发送的邮件完成
+	log.Println("Shutting down mail service")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Println("Error shutting down web server:", err)
+	}
+	return err
+}
+
+// 返回优雅关闭时等待进行中请求完成的最长时间，可通过 SHUTDOWN_TIMEOUT 环境变量配置
+func shutdownTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil && d > 0 {
+		return d
 	}
+	return 20 * time.Second
 }
 
 // 创建邮件配置对象
@@ -0,0 +1,221 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+/**
+该代码定义了 ConnectionManager，用于维护一条到 RabbitMQ 的长连接。
+Start 在启动时拨号（最多尝试 startupAttempts 次，ctx 被取消时停止重试），成功后在后台通过 NotifyClose 监听连接状态。
+连接意外断开后，ConnectionManager 按指数退避不断重连，并在每次连接成功后执行 OnConnect 注册的回调，
+用于重新声明交换机等拓扑结构；在已经连接后注册的回调会立即执行一次。
+Connection 返回当前可用的连接，正在重连时会一直等待直到连接恢复或 ctx 被取消。
+broker-service 发布事件和 listener-service 消费事件都使用这里的 ConnectionManager，两个模块通过 go.mod 中的 replace 指令引用本模块。
+*/
+
+const (
+	startupAttempts = 6                // 启动时最多尝试连接的次数
+	maxBackOff      = 30 * time.Second // 重连等待时间的上限
+)
+
+var errManagerClosed = errors.New("rabbitmq connection manager is closed")
+
+// ConnectionManager 维护一条会自动重连的 RabbitMQ 连接
+type ConnectionManager struct {
+	url func() (string, error) // 每次拨号时获取 RabbitMQ 地址
+
+	mu        sync.RWMutex
+	conn      *amqp.Connection
+	ready     chan struct{} // 连接可用时被关闭，断开后替换为新的通道
+	onConnect []func(*amqp.Connection) error
+	closed    bool
+	done      chan struct{}
+}
+
+// NewConnectionManager 创建一个连接管理器，url 在每次拨号时调用
+func NewConnectionManager(url func() (string, error)) *ConnectionManager {
+	return &ConnectionManager{
+		url:   url,
+		ready: make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// OnConnect 注册一个在每次连接（包括重连）成功后执行的回调，已经连接时立即在当前连接上执行一次
+func (m *ConnectionManager) OnConnect(fn func(*amqp.Connection) error) error {
+	m.mu.Lock()
+	m.onConnect = append(m.onConnect, fn)
+	conn := m.conn
+	m.mu.Unlock()
+
+	if conn != nil && !conn.IsClosed() {
+		return fn(conn)
+	}
+	return nil
+}
+
+// Start 建立第一次连接，并在后台监听连接状态
+func (m *ConnectionManager) Start(ctx context.Context) error {
+	var counts int64
+	for {
+		conn, err := m.dial()
+		if err == nil {
+			m.setConnection(conn)
+			go m.watch(conn)
+			return nil
+		}
+
+		log.Println("Rabbitmq not yet ready", err)
+		counts++
+		if counts >= startupAttempts {
+			return err
+		}
+
+		backOff := time.Duration(math.Pow(float64(counts), 2)) * time.Second
+		log.Println("Backing off......")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backOff):
+		}
+	}
+}
+
+// 拨号并执行所有 OnConnect 回调
+func (m *ConnectionManager) dial() (*amqp.Connection, error) {
+	url, err := m.url()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	hooks := m.onConnect
+	m.mu.RUnlock()
+
+	for _, fn := range hooks {
+		if err := fn(conn); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// 保存新的连接，并唤醒所有等待连接的调用方
+func (m *ConnectionManager) setConnection(conn *amqp.Connection) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.conn = conn
+	close(m.ready)
+}
+
+// 监听连接断开，并在断开后重连
+func (m *ConnectionManager) watch(conn *amqp.Connection) {
+	for {
+		closeErr := <-conn.NotifyClose(make(chan *amqp.Error, 1))
+
+		m.mu.Lock()
+		if m.closed {
+			// 连接是被 Close 主动关闭的
+			m.mu.Unlock()
+			return
+		}
+		m.conn = nil
+		m.ready = make(chan struct{})
+		m.mu.Unlock()
+
+		log.Println("Rabbitmq connection lost:", closeErr)
+
+		conn = m.reconnect()
+		if conn == nil {
+			return
+		}
+		m.setConnection(conn)
+		log.Println("Reconnected to RabbitMQ")
+	}
+}
+
+// 按指数退避不断重连，直到成功或管理器被关闭
+func (m *ConnectionManager) reconnect() *amqp.Connection {
+	backOff := time.Second
+	for {
+		select {
+		case <-m.done:
+			return nil
+		case <-time.After(backOff):
+		}
+
+		conn, err := m.dial()
+		if err == nil {
+			return conn
+		}
+
+		log.Println("Rabbitmq reconnect failed:", err)
+		backOff *= 2
+		if backOff > maxBackOff {
+			backOff = maxBackOff
+		}
+	}
+}
+
+// Connection 返回当前可用的连接，正在重连时等待连接恢复
+func (m *ConnectionManager) Connection(ctx context.Context) (*amqp.Connection, error) {
+	for {
+		m.mu.RLock()
+		conn, ready, closed := m.conn, m.ready, m.closed
+		m.mu.RUnlock()
+
+		if closed {
+			return nil, errManagerClosed
+		}
+		if conn != nil && !conn.IsClosed() {
+			return conn, nil
+		}
+
+		var retry <-chan time.Time
+		if conn != nil {
+			// 连接刚刚断开，watch 还没有开始重连，稍后再检查
+			ready = nil
+			retry = time.After(100 * time.Millisecond)
+		}
+
+		select {
+		case <-retry:
+		case <-ready:
+		case <-m.done:
+			return nil, errManagerClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Close 关闭连接并停止重连
+func (m *ConnectionManager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	close(m.done)
+
+	if m.conn != nil {
+		return m.conn.Close()
+	}
+	return nil
+}